@@ -0,0 +1,65 @@
+// Command callbacksim posts signed, encrypted sample DingTalk events to the
+// callback receiver so it can be exercised locally without a DingTalk tenant.
+//
+//	go run ./cmd/callbacksim -instance <process_instance_id> -event bpms_instance_change -type finish [-source ncr]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"dingtalk-dashboard/internal/config"
+	"dingtalk-dashboard/internal/dingtalk"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load config:", err)
+		os.Exit(1)
+	}
+
+	target := flag.String("url", "http://localhost:"+cfg.Port+"/api/v1/dingtalk/callback", "callback receiver URL")
+	eventType := flag.String("event", dingtalk.EventBpmsInstanceChange, "event type (bpms_instance_change, bpms_task_change, check_url)")
+	instanceID := flag.String("instance", "", "process instance ID")
+	changeType := flag.String("type", "start", "change type (start, finish, terminate, ...)")
+	sourceName := flag.String("source", cfg.Sources[0].Name, "source whose app signs the event")
+	processCode := flag.String("process-code", "", "process code (default: the source's)")
+	flag.Parse()
+
+	var source *config.Source
+	for i := range cfg.Sources {
+		if cfg.Sources[i].Name == *sourceName {
+			source = &cfg.Sources[i]
+		}
+	}
+	if source == nil {
+		fmt.Fprintln(os.Stderr, "unknown source:", *sourceName)
+		os.Exit(1)
+	}
+	if *processCode == "" {
+		*processCode = source.ProcessCode
+	}
+
+	crypto, err := dingtalk.NewCallbackCrypto(source.CallbackToken, source.CallbackAESKey, source.AppKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid callback config:", err)
+		os.Exit(1)
+	}
+
+	ack, err := dingtalk.PostCallbackEvent(context.Background(), *target, crypto, &dingtalk.CallbackEvent{
+		EventType:         *eventType,
+		ProcessInstanceID: *instanceID,
+		ProcessCode:       *processCode,
+		Type:              *changeType,
+		CreateTime:        time.Now().UnixMilli(),
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("ack: %s\n", ack)
+}
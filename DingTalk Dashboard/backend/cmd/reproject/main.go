@@ -0,0 +1,81 @@
+// Command reproject re-runs the NCR field mapping over the archived DingTalk payloads
+// in ncr_raw_payloads and rewrites ncr_approvals, without calling the DingTalk API.
+//
+//	go run ./cmd/reproject [-process-code PROC-...]
+package main
+
+import (
+	"context"
+	"flag"
+
+	"dingtalk-dashboard/internal/config"
+	"dingtalk-dashboard/internal/database"
+	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/domain/approval"
+	"dingtalk-dashboard/internal/domain/directory"
+	"dingtalk-dashboard/internal/lease"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	zapLogger, _ := zap.NewProduction()
+	defer zapLogger.Sync()
+
+	processCode := flag.String("process-code", "", "only re-project instances of this process code")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		zapLogger.Fatal("Failed to load config", zap.Error(err))
+	}
+
+	db, err := database.Connect(cfg, zapLogger)
+	if err != nil {
+		zapLogger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+
+	// An empty replay source guarantees no DingTalk API calls are made
+	approvalRepo := approval.NewRepository(db)
+	replay := dingtalk.NewReplaySource()
+	approvalService := approval.NewService(approvalRepo, replay, 1, zapLogger)
+	// Take the sync locks, so a running server doesn't sync the NCRs being rewritten
+	approvalService.SetLeases(lease.NewManager(db))
+
+	// Register the sources so NCRs keep their source name and its field mappings apply
+	for _, source := range cfg.Sources {
+		approvalService.AddSource(approval.Source{
+			Name:          source.Name,
+			Label:         source.Label,
+			ProcessCode:   source.ProcessCode,
+			FieldMappings: approval.SourceFieldMappings(source),
+		}, approval.SourceClients{Approvals: replay})
+	}
+
+	// Department names and paths come from the stored user directory, as in a sync. Re-projection
+	// only reads stored departments, so the apps' contact APIs are never called.
+	var contacts []dingtalk.ContactSource
+	seen := make(map[string]bool)
+	for _, source := range cfg.Sources {
+		if !seen[source.AppKey] {
+			seen[source.AppKey] = true
+			contacts = append(contacts, dingtalk.NewClient(source.AppKey, source.AppSecret, cfg.DingTalkQPS))
+		}
+	}
+	directoryService := directory.NewService(directory.NewRepository(db), contacts[0], cfg.DirectoryTTL, zapLogger)
+	for _, app := range contacts[1:] {
+		directoryService.AddContacts(app)
+	}
+	approvalService.SetDirectory(directoryService)
+
+	syncLog, err := approvalService.ReprojectArchive(context.Background(), *processCode)
+	if err != nil {
+		zapLogger.Fatal("Re-projection failed", zap.Error(err))
+	}
+
+	zapLogger.Info("Re-projection finished",
+		zap.String("sync_id", syncLog.ID.String()),
+		zap.Int("processed", syncLog.RecordsProcessed),
+		zap.Int("created", syncLog.RecordsCreated),
+		zap.Int("updated", syncLog.RecordsUpdated))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,10 +12,14 @@ import (
 	"dingtalk-dashboard/internal/database"
 	"dingtalk-dashboard/internal/dingtalk"
 	"dingtalk-dashboard/internal/domain/approval"
+	"dingtalk-dashboard/internal/domain/directory"
 	"dingtalk-dashboard/internal/handler"
+	"dingtalk-dashboard/internal/lease"
 	"dingtalk-dashboard/internal/middleware"
 	"dingtalk-dashboard/internal/ranking"
+	"dingtalk-dashboard/internal/report"
 	"dingtalk-dashboard/internal/scheduler"
+	"dingtalk-dashboard/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -39,20 +44,96 @@ func main() {
 		zapLogger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 
-	// Initialize DingTalk client
-	dtClient := dingtalk.NewClient(cfg.DingTalkAppKey, cfg.DingTalkAppSecret)
+	// Initialize DingTalk clients, one per app (or a recorder/replay stand-in for offline development)
+	apps, err := newDingTalkApps(cfg)
+	if err != nil {
+		zapLogger.Fatal("Failed to initialize DingTalk clients", zap.Error(err))
+	}
+	if cfg.DingTalkReplayDir != "" {
+		zapLogger.Info("Serving DingTalk data from replay fixtures", zap.String("dir", cfg.DingTalkReplayDir))
+	} else if cfg.DingTalkRecordDir != "" {
+		zapLogger.Info("Recording DingTalk responses", zap.String("dir", cfg.DingTalkRecordDir))
+	}
+	if cfg.DingTalkAPIVersion == "v1" {
+		zapLogger.Info("Reading approval instances through the v1.0 workflow API")
+	}
+
+	sourceClients := make([]approval.SourceClients, len(cfg.Sources))
+	sourceFiles := make([]dingtalk.FileSource, len(cfg.Sources))
+	for i, source := range cfg.Sources {
+		if sourceClients[i], sourceFiles[i], err = apps.sourceClients(source); err != nil {
+			zapLogger.Fatal("Failed to initialize DingTalk clients", zap.String("source", source.Name), zap.Error(err))
+		}
+	}
+	// User and department lookups go through every source's app
+	dtContacts := apps.contacts(cfg.Sources)
 
 	// Initialize services
 	approvalRepo := approval.NewRepository(db)
-	approvalService := approval.NewService(approvalRepo, dtClient, zapLogger)
+	approvalService := approval.NewService(approvalRepo, sourceClients[0].Approvals, cfg.SyncWorkers, zapLogger)
+	leaseManager := lease.NewManager(db)
+	approvalService.SetLeases(leaseManager)
+	for i, source := range cfg.Sources {
+		approvalService.AddSource(approval.Source{
+			Name:          source.Name,
+			Label:         source.Label,
+			ProcessCode:   source.ProcessCode,
+			FieldMappings: approval.SourceFieldMappings(source),
+		}, sourceClients[i])
+		zapLogger.Info("Approval source configured",
+			zap.String("source", source.Name),
+			zap.String("process_code", source.ProcessCode))
+	}
+
+	// Resolve users and departments from the persistent directory (not available in replay mode)
+	var directoryService *directory.Service
+	if len(dtContacts) > 0 {
+		directoryService = directory.NewService(directory.NewRepository(db), dtContacts[0], cfg.DirectoryTTL, zapLogger)
+		for _, contacts := range dtContacts[1:] {
+			directoryService.AddContacts(contacts)
+		}
+		approvalService.SetDirectory(directoryService)
+	}
+
+	// Initialize attachment storage and download job
+	attachmentStore, err := newAttachmentStore(cfg)
+	if err != nil {
+		zapLogger.Fatal("Failed to initialize attachment storage", zap.Error(err))
+	}
+	attachmentDownloader := approval.NewAttachmentDownloader(approvalRepo, sourceFiles[0], attachmentStore, zapLogger)
+	for i, source := range cfg.Sources {
+		attachmentDownloader.SetSourceFiles(source.Name, sourceFiles[i])
+	}
+
+	rankingService := ranking.NewService(db)
+	reportService := report.NewService(db, rankingService, cfg.Location, zapLogger)
 
-	// Initialize scheduler
+	// Initialize scheduler and register its jobs
+	schedulerRepo := scheduler.NewRepository(db)
 	syncScheduler := scheduler.NewScheduler(
+		schedulerRepo,
 		approvalService,
-		cfg.ApprovalProcessCode,
+		cfg.JobSchedules,
 		cfg.Location,
 		zapLogger,
 	)
+	syncScheduler.SetLeases(leaseManager)
+	jobs := []scheduler.Job{
+		scheduler.ApprovalSyncJob(approvalService),
+		scheduler.ReconciliationJob(approvalService),
+		scheduler.AttachmentDownloadJob(attachmentDownloader),
+		scheduler.RankingPrecomputeJob(rankingService),
+		scheduler.ReportDigestJob(reportService),
+		scheduler.RetentionCleanupJob(approvalService, schedulerRepo, leaseManager, cfg.Retention),
+	}
+	if directoryService != nil {
+		jobs = append(jobs, scheduler.DirectoryRefreshJob(directoryService, approvalService))
+	}
+	for _, job := range jobs {
+		if err := syncScheduler.Register(job); err != nil {
+			zapLogger.Fatal("Failed to register job", zap.Error(err))
+		}
+	}
 
 	// Start scheduler
 	if err := syncScheduler.Start(); err != nil {
@@ -63,6 +144,7 @@ func main() {
 	app := fiber.New(fiber.Config{
 		AppName:      "DingTalk Dashboard API",
 		ErrorHandler: customErrorHandler,
+		BodyLimit:    25 << 20, // Room for files attached to comments
 	})
 
 	// Global middleware
@@ -79,11 +161,23 @@ func main() {
 	v1 := app.Group("/api/v1")
 
 	// Initialize handlers
-	approvalHandler := handler.NewApprovalHandler(approvalService, syncScheduler)
+	approvalHandler := handler.NewApprovalHandler(approvalService, syncScheduler, cfg.Location)
 	authHandler := handler.NewAuthHandler(cfg.AuthAPIBaseURL)
-	rankingService := ranking.NewService(db)
 	rankingHandler := handler.NewRankingHandler(rankingService)
 	exportHandler := handler.NewExportHandler(approvalService)
+	attachmentHandler := handler.NewAttachmentHandler(approvalService, attachmentStore)
+	jobHandler := handler.NewJobHandler(syncScheduler)
+	reportHandler := handler.NewReportHandler(reportService)
+
+	// Comments and new NCRs are posted as the DingTalk user matching the signed-in account's email
+	var userResolver handler.UserResolver
+	if directoryService != nil {
+		userResolver = directoryService
+	}
+	dingTalkUsers := handler.NewDingTalkUsers(userResolver, cfg.DingTalkUserMap)
+	commentHandler := handler.NewCommentHandler(approvalService, dingTalkUsers)
+	createHandler := handler.NewCreateHandler(approvalService, dingTalkUsers)
+	refreshHandler := handler.NewRefreshHandler(approvalService)
 
 	// Initialize AI components
 	ollamaClient := ai.NewOllamaClient(cfg.OllamaBaseURL, cfg.OllamaModel)
@@ -109,19 +203,44 @@ func main() {
 	auth.Post("/refresh", authHandler.RefreshToken)
 	auth.Post("/logout", authHandler.Logout)
 
+	// DingTalk event callback (public - authenticated by the callback signature of each source's app)
+	callbackKeys, err := callbackKeyring(cfg.Sources)
+	if err != nil {
+		zapLogger.Fatal("Invalid DingTalk callback config", zap.Error(err))
+	}
+	if callbackKeys != nil {
+		callbackHandler := handler.NewCallbackHandler(callbackKeys, approvalService, zapLogger)
+		v1.Post("/dingtalk/callback", callbackHandler.HandleEvent)
+		zapLogger.Info("DingTalk callback receiver enabled")
+	}
+
 	// Approval routes (protected)
 	approvals := v1.Group("/approvals")
 	if jwtSecret != "" {
 		approvals.Use(authMiddleware.Authenticate())
 	}
 	approvals.Get("/", approvalHandler.ListApprovals)
+	approvals.Post("/", createHandler.CreateApproval)
+	approvals.Get("/form-schema", createHandler.GetFormSchema)
 	approvals.Get("/stats", approvalHandler.GetStats)
 	approvals.Get("/filter-options", approvalHandler.GetFilterOptions)
 	approvals.Get("/problem-ranking", rankingHandler.GetProblemRanking)
 	approvals.Get("/word-cloud", rankingHandler.GetWordCloud)
 	approvals.Get("/ranking-debug", rankingHandler.GetRankingDebug)
 	approvals.Get("/export", exportHandler.ExportApprovals)
+	approvals.Get("/unmapped-fields", approvalHandler.ListUnmappedFields)
 	approvals.Get("/:id", approvalHandler.GetApproval)
+	approvals.Get("/:id/timeline", approvalHandler.GetTimeline)
+	approvals.Get("/:id/history", approvalHandler.GetHistory)
+	approvals.Post("/:id/comments", commentHandler.AddComment)
+	approvals.Post("/:id/refresh", refreshHandler.RefreshApproval)
+
+	// Attachment routes (protected)
+	attachments := v1.Group("/attachments")
+	if jwtSecret != "" {
+		attachments.Use(authMiddleware.Authenticate())
+	}
+	attachments.Get("/:id", attachmentHandler.GetAttachment)
 
 	// Sync routes (protected)
 	sync := v1.Group("/sync")
@@ -129,7 +248,35 @@ func main() {
 		sync.Use(authMiddleware.Authenticate())
 	}
 	sync.Get("/logs", approvalHandler.ListSyncLogs)
+	sync.Get("/logs/:id/changes", approvalHandler.ListSyncChanges)
 	sync.Post("/trigger", approvalHandler.TriggerSync)
+	sync.Post("/instances", refreshHandler.RefreshInstances)
+	sync.Get("/jobs/:id/events", approvalHandler.GetSyncJobEvents)
+	sync.Delete("/jobs/:id", approvalHandler.CancelSyncJob)
+	sync.Get("/reconciliations", approvalHandler.ListReconciliationReports)
+	sync.Get("/reconciliations/:id", approvalHandler.GetReconciliationReport)
+	sync.Get("/failures", approvalHandler.ListSyncFailures)
+	sync.Post("/failures/retry", approvalHandler.RetrySyncFailures)
+
+	// Scheduled job routes (protected)
+	jobRoutes := v1.Group("/jobs")
+	if jwtSecret != "" {
+		jobRoutes.Use(authMiddleware.Authenticate())
+	}
+	jobRoutes.Get("/", jobHandler.ListJobs)
+	jobRoutes.Get("/:name/runs", jobHandler.ListJobRuns)
+	jobRoutes.Put("/:name/schedule", jobHandler.UpdateJobSchedule)
+	jobRoutes.Post("/:name/pause", jobHandler.PauseJob)
+	jobRoutes.Post("/:name/resume", jobHandler.ResumeJob)
+	jobRoutes.Post("/:name/run", jobHandler.RunJob)
+
+	// Report routes (protected)
+	reports := v1.Group("/reports")
+	if jwtSecret != "" {
+		reports.Use(authMiddleware.Authenticate())
+	}
+	reports.Get("/digests", reportHandler.ListDigests)
+	reports.Get("/digests/:id", reportHandler.GetDigest)
 
 	// AI routes (protected)
 	aiRoutes := v1.Group("/ai")
@@ -157,6 +304,129 @@ func main() {
 	}
 }
 
+// dingTalkApps creates the DingTalk clients of the configured sources. Sources of the same app
+// share one client, and so its token and rate limit.
+type dingTalkApps struct {
+	cfg      *config.Config
+	clients  map[string]*dingtalk.Client // By app key
+	replay   *dingtalk.ReplaySource
+	recorder *dingtalk.Recorder
+}
+
+// newDingTalkApps checks the API version and loads the replay fixtures if configured
+func newDingTalkApps(cfg *config.Config) (*dingTalkApps, error) {
+	if cfg.DingTalkAPIVersion != "topapi" && cfg.DingTalkAPIVersion != "v1" {
+		return nil, fmt.Errorf("invalid DINGTALK_API_VERSION %q, expected topapi or v1", cfg.DingTalkAPIVersion)
+	}
+
+	apps := &dingTalkApps{cfg: cfg, clients: make(map[string]*dingtalk.Client)}
+	if cfg.DingTalkReplayDir != "" {
+		replay, err := dingtalk.LoadReplaySource(cfg.DingTalkReplayDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load replay fixtures: %w", err)
+		}
+		apps.replay = replay
+	}
+	return apps, nil
+}
+
+// client returns the client of a source's app
+func (a *dingTalkApps) client(source config.Source) *dingtalk.Client {
+	client, ok := a.clients[source.AppKey]
+	if !ok {
+		client = dingtalk.NewClient(source.AppKey, source.AppSecret, a.cfg.DingTalkQPS)
+		a.clients[source.AppKey] = client
+	}
+	return client
+}
+
+// sourceClients returns the clients a source is read and written through, and where its drive
+// files are resolved (nil in replay mode)
+func (a *dingTalkApps) sourceClients(source config.Source) (approval.SourceClients, dingtalk.FileSource, error) {
+	if a.replay != nil {
+		return approval.SourceClients{Approvals: a.replay, Comments: a.replay, Creator: a.replay}, nil, nil
+	}
+
+	client := a.client(source)
+	var approvals dingtalk.ApprovalSource = client
+	var files dingtalk.FileSource = client
+	if a.cfg.DingTalkAPIVersion == "v1" {
+		workflowClient := dingtalk.NewWorkflowClient(client, a.cfg.Location)
+		approvals, files = workflowClient, workflowClient
+	}
+
+	if a.cfg.DingTalkRecordDir != "" {
+		if a.recorder == nil {
+			recorder, err := dingtalk.NewRecorder(approvals, a.cfg.DingTalkRecordDir)
+			if err != nil {
+				return approval.SourceClients{}, nil, fmt.Errorf("failed to create recorder: %w", err)
+			}
+			a.recorder = recorder
+			approvals = recorder
+		} else {
+			approvals = a.recorder.Wrap(approvals)
+		}
+	}
+
+	return approval.SourceClients{Approvals: approvals, Comments: client, Creator: client}, files, nil
+}
+
+// contacts returns the contact API of each app the sources use, once per app (none in replay mode)
+func (a *dingTalkApps) contacts(sources []config.Source) []dingtalk.ContactSource {
+	if a.replay != nil {
+		return nil
+	}
+	var contacts []dingtalk.ContactSource
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		if !seen[source.AppKey] {
+			seen[source.AppKey] = true
+			contacts = append(contacts, a.client(source))
+		}
+	}
+	return contacts
+}
+
+// callbackKeyring builds the callback crypto of each app the sources use, so events from any of
+// them are accepted. Returns nil if no source has a callback token and AES key.
+func callbackKeyring(sources []config.Source) (*dingtalk.CallbackKeyring, error) {
+	var cryptos []*dingtalk.CallbackCrypto
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		if source.CallbackToken == "" || source.CallbackAESKey == "" || seen[source.AppKey] {
+			continue
+		}
+		seen[source.AppKey] = true
+		crypto, err := dingtalk.NewCallbackCrypto(source.CallbackToken, source.CallbackAESKey, source.AppKey)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", source.Name, err)
+		}
+		cryptos = append(cryptos, crypto)
+	}
+	if len(cryptos) == 0 {
+		return nil, nil
+	}
+	return dingtalk.NewCallbackKeyring(cryptos...), nil
+}
+
+// newAttachmentStore creates the configured attachment storage backend
+func newAttachmentStore(cfg *config.Config) (storage.Store, error) {
+	switch cfg.AttachmentStorage {
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	case "filesystem", "":
+		return storage.NewFileStore(cfg.AttachmentDir)
+	default:
+		return nil, fmt.Errorf("unknown attachment storage %q", cfg.AttachmentStorage)
+	}
+}
+
 func customErrorHandler(c *fiber.Ctx, err error) error {
 	code := fiber.StatusInternalServerError
 	if e, ok := err.(*fiber.Error); ok {
@@ -101,6 +101,7 @@ func (s *Service) getRecentProblems(ctx context.Context, params approval.StatsPa
 	listParams := approval.ListParams{
 		Page:            1,
 		PageSize:        20, // Get top 20 recent problems for context
+		Source:          params.Source,
 		Status:          params.Status,
 		Search:          params.Search,
 		Department:      params.Department,
@@ -220,6 +221,9 @@ func (s *Service) buildAnalysisContext(stats map[string]interface{}, params appr
 
 	// Build filter context
 	var filters []string
+	if params.Source != "" {
+		filters = append(filters, "Source: "+params.Source)
+	}
 	if params.Department != "" {
 		filters = append(filters, "Department: "+params.Department)
 	}
@@ -0,0 +1,11 @@
+-- Migration 002: Persisted incremental sync watermark
+
+-- High-water mark per DingTalk process code
+CREATE TABLE IF NOT EXISTS sync_state (
+    process_code VARCHAR(100) PRIMARY KEY,
+    high_water_mark TIMESTAMPTZ NOT NULL,   -- End of the last fully processed listing window
+    last_sync_id UUID REFERENCES sync_logs(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS records_skipped INT DEFAULT 0;
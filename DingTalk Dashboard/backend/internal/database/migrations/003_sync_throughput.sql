@@ -0,0 +1,5 @@
+-- Migration 003: Sync throughput metrics
+
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS api_calls INT DEFAULT 0;
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS duration_ms BIGINT DEFAULT 0;
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS throughput DOUBLE PRECISION DEFAULT 0;  -- instances/sec
@@ -0,0 +1,15 @@
+-- Migration 004: Configurable form field mapping
+-- When no rows exist for a process code the built-in defaults (approval.DefaultFieldMappings) apply.
+
+CREATE TABLE IF NOT EXISTS form_field_mappings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    process_code VARCHAR(100) NOT NULL DEFAULT '',  -- Empty applies to every form
+    column_name VARCHAR(100) NOT NULL,              -- Target ncr_approvals column
+    component_id VARCHAR(200),                      -- DingTalk component id (matched first)
+    biz_alias VARCHAR(200),                         -- DingTalk biz_alias (matched second)
+    label VARCHAR(300),                             -- Label, matched after normalizing case/spaces/colons
+    field_type VARCHAR(50) NOT NULL DEFAULT 'text', -- text, date, multiselect
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_form_field_mappings_process ON form_field_mappings(process_code);
@@ -0,0 +1,9 @@
+-- Migration 005: Unmapped form fields and form schema drift
+
+ALTER TABLE ncr_approvals ADD COLUMN IF NOT EXISTS extra_fields JSONB;  -- Unmapped form values keyed by label
+
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS process_code VARCHAR(100);
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS form_labels JSONB;       -- Labels seen in this sync
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS form_drift JSONB;        -- Appeared/disappeared/unmapped labels
+
+CREATE INDEX IF NOT EXISTS idx_sync_logs_process_code ON sync_logs(process_code, started_at);
@@ -0,0 +1,16 @@
+-- Migration 006: Raw DingTalk payload archive
+
+-- Versioned instance detail responses, one row per distinct payload
+CREATE TABLE IF NOT EXISTS ncr_raw_payloads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    process_instance_id VARCHAR(100) NOT NULL,
+    process_code VARCHAR(100),
+    version INT NOT NULL,
+    payload JSONB NOT NULL,            -- Detail response without volatile fields (request_id)
+    payload_hash VARCHAR(64) NOT NULL, -- SHA-256 of the canonical payload
+    user_names JSONB,                  -- User ID -> name resolved at fetch time
+    fetched_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (process_instance_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ncr_raw_payloads_process_code ON ncr_raw_payloads(process_code);
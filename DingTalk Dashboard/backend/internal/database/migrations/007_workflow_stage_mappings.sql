@@ -0,0 +1,18 @@
+-- Migration 007: Map workflow stages by activity instead of operation order
+-- When no rows exist for a process code, stages are still assigned by operation order.
+
+CREATE TABLE IF NOT EXISTS workflow_stage_mappings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    process_code VARCHAR(100) NOT NULL DEFAULT '',  -- Empty applies to every form
+    activity_id VARCHAR(200) NOT NULL,              -- Task activity_id of the workflow node
+    column_name VARCHAR(100) NOT NULL,              -- analisis_penyebab_masalah, nama_yang_melakukan_masalah,
+                                                    -- tindakan_perbaikan or tindakan_pencegahan
+    stage_name VARCHAR(300),                        -- Human readable node name
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (process_code, activity_id)
+);
+
+ALTER TABLE ncr_approvals ADD COLUMN IF NOT EXISTS needs_review BOOLEAN DEFAULT FALSE;
+ALTER TABLE ncr_approvals ADD COLUMN IF NOT EXISTS review_reason TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_ncr_approvals_needs_review ON ncr_approvals(needs_review) WHERE needs_review;
@@ -0,0 +1,36 @@
+-- Migration 008: Normalized workflow operation records and tasks
+
+-- Operation records of each NCR, in DingTalk's order
+CREATE TABLE IF NOT EXISTS ncr_operation_records (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ncr_approval_id UUID REFERENCES ncr_approvals(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    user_id VARCHAR(100),
+    user_name VARCHAR(200),
+    operation_type VARCHAR(100),
+    operation_result VARCHAR(50),
+    remark TEXT,
+    activity_id VARCHAR(200),   -- Resolved from the matching task when DingTalk omits it
+    operated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ncr_operation_records_approval ON ncr_operation_records(ncr_approval_id);
+
+-- Workflow tasks of each NCR (who held it and for how long)
+CREATE TABLE IF NOT EXISTS ncr_tasks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ncr_approval_id UUID REFERENCES ncr_approvals(id) ON DELETE CASCADE,
+    task_id VARCHAR(100),
+    user_id VARCHAR(100),
+    user_name VARCHAR(200),
+    status VARCHAR(50),
+    result VARCHAR(50),
+    activity_id VARCHAR(200),
+    assigned_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ncr_tasks_approval ON ncr_tasks(ncr_approval_id);
+CREATE INDEX IF NOT EXISTS idx_ncr_tasks_user ON ncr_tasks(user_id);
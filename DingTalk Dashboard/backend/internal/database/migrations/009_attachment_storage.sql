@@ -0,0 +1,10 @@
+-- Migration 009: Local copies of NCR attachments
+
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS checksum VARCHAR(64);        -- SHA-256 of the content
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS storage_key VARCHAR(200);    -- Content-addressed key in the attachment store
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS content_type VARCHAR(200);
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS downloaded_at TIMESTAMPTZ;
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS download_attempts INT DEFAULT 0;
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS download_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_ncr_attachments_pending ON ncr_attachments(id) WHERE downloaded_at IS NULL;
@@ -0,0 +1,5 @@
+-- Migration 010: Attachments added to workflow operations
+
+-- operation_photo / operation_file rows point at the operation record they were attached to
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS operation_seq INT;
+ALTER TABLE ncr_attachments ADD COLUMN IF NOT EXISTS activity_id VARCHAR(200);
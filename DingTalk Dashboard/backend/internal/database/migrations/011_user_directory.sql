@@ -0,0 +1,28 @@
+-- Migration 011: Persistent DingTalk user and department directory
+
+CREATE TABLE IF NOT EXISTS dt_departments (
+    dept_id BIGINT PRIMARY KEY,
+    name VARCHAR(200),
+    parent_id BIGINT,
+    path TEXT,                  -- Names from the root down, e.g. "Company / Produksi / Welding"
+    refreshed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_dt_departments_parent ON dt_departments(parent_id);
+
+CREATE TABLE IF NOT EXISTS dt_users (
+    user_id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(200),
+    title VARCHAR(200),
+    dept_ids JSONB,
+    main_dept_id BIGINT,
+    active BOOLEAN DEFAULT TRUE,  -- False once the user no longer appears in the directory
+    refreshed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Parent departments of the originator, for hierarchy-aware department filters
+ALTER TABLE ncr_approvals ADD COLUMN IF NOT EXISTS originator_dept_path TEXT;
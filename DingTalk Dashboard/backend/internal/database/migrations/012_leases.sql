@@ -0,0 +1,10 @@
+-- Migration 012: Expiring locks shared by all server replicas
+
+CREATE TABLE IF NOT EXISTS leases (
+    name VARCHAR(200) PRIMARY KEY,  -- e.g. approval-sync:<process_code>
+    holder VARCHAR(200) NOT NULL,   -- Server instance (and sync) holding the lease
+    meta TEXT,                      -- e.g. the ID of the running sync
+    acquired_at TIMESTAMPTZ NOT NULL,
+    renewed_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
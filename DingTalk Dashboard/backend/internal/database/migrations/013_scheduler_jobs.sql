@@ -0,0 +1,47 @@
+-- Migration 013: Scheduled job registry, run history, ranking snapshots and report digests
+
+-- Admin overrides per job; an empty schedule falls back to JOB_SCHEDULES or the default
+CREATE TABLE IF NOT EXISTS scheduler_jobs (
+    name VARCHAR(100) PRIMARY KEY,
+    schedule VARCHAR(100),
+    paused BOOLEAN DEFAULT FALSE,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS scheduler_job_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_name VARCHAR(100) NOT NULL,
+    trigger VARCHAR(20) NOT NULL,   -- scheduled, manual, startup
+    status VARCHAR(20) NOT NULL,    -- running, succeeded, failed, skipped
+    instance VARCHAR(200),          -- Server process that ran the job
+    result JSONB,
+    error_message TEXT,
+    duration_ms BIGINT DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduler_job_runs_job ON scheduler_job_runs(job_name, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS ranking_snapshots (
+    name VARCHAR(100) PRIMARY KEY,
+    problems JSONB,
+    stats JSONB,
+    word_cloud JSONB,
+    computed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS report_digests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    period VARCHAR(20) NOT NULL,    -- weekly
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    created_count BIGINT DEFAULT 0,
+    completed_count BIGINT DEFAULT 0,
+    terminated_count BIGINT DEFAULT 0,
+    open_count BIGINT DEFAULT 0,
+    departments JSONB,
+    top_problems JSONB,
+    generated_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (period, period_start)
+);
@@ -0,0 +1,30 @@
+-- Migration 014: Tombstones for instances removed from DingTalk and reconciliation reports
+
+ALTER TABLE ncr_approvals ADD COLUMN IF NOT EXISTS tombstoned_at TIMESTAMPTZ;
+ALTER TABLE ncr_approvals ADD COLUMN IF NOT EXISTS tombstone_reason VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_ncr_approvals_tombstoned ON ncr_approvals(tombstoned_at) WHERE tombstoned_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS reconciliation_reports (
+    id UUID PRIMARY KEY,
+    process_code VARCHAR(100),
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    status VARCHAR(50) NOT NULL,    -- running, completed, failed
+    listed INTEGER DEFAULT 0,       -- Instance IDs DingTalk lists for the window
+    stored INTEGER DEFAULT 0,       -- Stored NCRs created in the window
+    rechecked INTEGER DEFAULT 0,
+    added INTEGER DEFAULT 0,
+    tombstoned INTEGER DEFAULT 0,
+    restored INTEGER DEFAULT 0,
+    unlisted INTEGER DEFAULT 0,
+    status_changed INTEGER DEFAULT 0,
+    errors INTEGER DEFAULT 0,
+    items JSONB,                    -- One entry per discrepancy and the action taken
+    error_message TEXT,
+    duration_ms BIGINT DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_reports_started ON reconciliation_reports(started_at DESC);
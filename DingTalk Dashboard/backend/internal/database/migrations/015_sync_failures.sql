@@ -0,0 +1,16 @@
+-- Migration 015: Dead-letter queue for instances that failed to sync
+
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS records_failed INTEGER DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS sync_failures (
+    process_instance_id VARCHAR(100) PRIMARY KEY,
+    process_code VARCHAR(100),
+    error_message TEXT,
+    transient BOOLEAN DEFAULT FALSE, -- Throttling, network or timeout rather than a permanent error
+    attempts INTEGER DEFAULT 1,
+    last_sync_id UUID,
+    first_failed_at TIMESTAMPTZ NOT NULL,
+    last_attempt_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_failures_process_code ON sync_failures(process_code, attempts);
@@ -0,0 +1,13 @@
+-- Migration 016: Field-level change history of NCRs
+
+CREATE TABLE IF NOT EXISTS ncr_approval_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ncr_approval_id UUID REFERENCES ncr_approvals(id) ON DELETE CASCADE,
+    process_instance_id VARCHAR(100),
+    sync_id UUID,                   -- Sync log of the sync that made the change, if any
+    changes JSONB,                  -- [{"field", "old", "new"}, ...]
+    changed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ncr_approval_revisions_approval ON ncr_approval_revisions(ncr_approval_id, changed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ncr_approval_revisions_sync ON ncr_approval_revisions(sync_id);
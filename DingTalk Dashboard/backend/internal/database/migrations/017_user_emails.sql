@@ -0,0 +1,7 @@
+-- Migration 017: User emails, to post comments as the DingTalk user of a dashboard account
+
+ALTER TABLE dt_users ADD COLUMN IF NOT EXISTS email VARCHAR(200);
+ALTER TABLE dt_users ADD COLUMN IF NOT EXISTS org_email VARCHAR(200);
+
+CREATE INDEX IF NOT EXISTS idx_dt_users_email ON dt_users(LOWER(email));
+CREATE INDEX IF NOT EXISTS idx_dt_users_org_email ON dt_users(LOWER(org_email));
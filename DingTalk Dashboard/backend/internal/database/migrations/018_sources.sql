@@ -0,0 +1,20 @@
+-- Migration 018: Sources, to sync several approval forms (and DingTalk apps) side by side
+--
+-- Rows stored before sources existed came from the single configured form. Adding each column
+-- with the default source's name attributes them to it once; new rows default to ''. Replace
+-- 'ncr' below if SOURCE_NAME is set to something else.
+
+ALTER TABLE ncr_approvals ADD COLUMN IF NOT EXISTS source VARCHAR(100) NOT NULL DEFAULT 'ncr';
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS source VARCHAR(100) NOT NULL DEFAULT 'ncr';
+ALTER TABLE sync_failures ADD COLUMN IF NOT EXISTS source VARCHAR(100) NOT NULL DEFAULT 'ncr';
+ALTER TABLE reconciliation_reports ADD COLUMN IF NOT EXISTS source VARCHAR(100) NOT NULL DEFAULT 'ncr';
+
+ALTER TABLE ncr_approvals ALTER COLUMN source SET DEFAULT '';
+ALTER TABLE sync_logs ALTER COLUMN source SET DEFAULT '';
+ALTER TABLE sync_failures ALTER COLUMN source SET DEFAULT '';
+ALTER TABLE reconciliation_reports ALTER COLUMN source SET DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_ncr_approvals_source ON ncr_approvals(source);
+CREATE INDEX IF NOT EXISTS idx_sync_logs_source ON sync_logs(source, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_sync_failures_source ON sync_failures(source);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_reports_source ON reconciliation_reports(source, started_at DESC);
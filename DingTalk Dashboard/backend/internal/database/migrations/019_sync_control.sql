@@ -0,0 +1,4 @@
+-- Migration 019: Sync progress and cancellation visible to every replica
+
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS progress JSONB;                   -- Latest progress snapshot of the running sync
+ALTER TABLE sync_logs ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMPTZ;  -- Set by DELETE /sync/jobs/:id on any replica
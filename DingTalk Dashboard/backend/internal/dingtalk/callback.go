@@ -0,0 +1,249 @@
+package dingtalk
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Callback event types we care about
+const (
+	EventCheckURL            = "check_url"
+	EventBpmsInstanceChange  = "bpms_instance_change"
+	EventBpmsTaskChange      = "bpms_task_change"
+	callbackSuccessPlaintext = "success"
+)
+
+// callbackMaxSkew is how far a callback's timestamp may be from now, bounding how long a
+// captured callback can be replayed
+const callbackMaxSkew = 5 * time.Minute
+
+// ErrInvalidSignature is returned when a callback signature does not match
+var ErrInvalidSignature = errors.New("invalid callback signature")
+
+// ErrStaleTimestamp is returned when a callback's timestamp is too far from now
+var ErrStaleTimestamp = errors.New("callback timestamp out of range")
+
+// CallbackEvent represents a decrypted DingTalk event callback payload
+type CallbackEvent struct {
+	EventType         string `json:"EventType"`
+	ProcessInstanceID string `json:"processInstanceId"`
+	ProcessCode       string `json:"processCode"`
+	CorpID            string `json:"corpId"`
+	Type              string `json:"type"`
+	Result            string `json:"result"`
+	StaffID           string `json:"staffId"`
+	CreateTime        int64  `json:"createTime"`
+	FinishTime        int64  `json:"finishTime"`
+}
+
+// CallbackRequest is the body DingTalk posts to the callback URL
+type CallbackRequest struct {
+	Encrypt string `json:"encrypt"`
+}
+
+// CallbackResponse is the encrypted acknowledgement returned to DingTalk
+type CallbackResponse struct {
+	MsgSignature string `json:"msg_signature"`
+	TimeStamp    string `json:"timeStamp"`
+	Nonce        string `json:"nonce"`
+	Encrypt      string `json:"encrypt"`
+}
+
+// CallbackCrypto signs, encrypts and decrypts DingTalk event callbacks
+// (AES-256-CBC with the IV taken from the first 16 bytes of the key)
+type CallbackCrypto struct {
+	token    string
+	aesKey   []byte
+	ownerKey string
+}
+
+// NewCallbackCrypto creates a callback crypto helper. encodingAESKey is the
+// 43-character key configured in the developer console and ownerKey is the
+// app key (or corp ID) the payloads are bound to.
+func NewCallbackCrypto(token, encodingAESKey, ownerKey string) (*CallbackCrypto, error) {
+	if len(encodingAESKey) != 43 {
+		return nil, fmt.Errorf("invalid callback AES key length: %d", len(encodingAESKey))
+	}
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode callback AES key: %w", err)
+	}
+	return &CallbackCrypto{
+		token:    token,
+		aesKey:   key,
+		ownerKey: ownerKey,
+	}, nil
+}
+
+// OwnerKey returns the app key (or corp ID) payloads are bound to
+func (c *CallbackCrypto) OwnerKey() string {
+	return c.ownerKey
+}
+
+// Sign computes the callback signature over token, timestamp, nonce and encrypted payload
+func (c *CallbackCrypto) Sign(timestamp, nonce, encrypt string) string {
+	parts := []string{c.token, timestamp, nonce, encrypt}
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySignature checks the signature DingTalk sent with a callback and that its timestamp
+// (Unix milliseconds) is within callbackMaxSkew of now
+func (c *CallbackCrypto) VerifySignature(signature, timestamp, nonce, encrypt string) error {
+	if err := checkTimestamp(timestamp, time.Now()); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Sign(timestamp, nonce, encrypt)), []byte(signature)) != 1 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// checkTimestamp returns ErrStaleTimestamp unless timestamp, in Unix milliseconds, is within
+// callbackMaxSkew of now
+func checkTimestamp(timestamp string, now time.Time) error {
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrStaleTimestamp, timestamp)
+	}
+	if skew := now.Sub(time.UnixMilli(ms)); skew > callbackMaxSkew || skew < -callbackMaxSkew {
+		return fmt.Errorf("%w: %s from now", ErrStaleTimestamp, skew.Round(time.Second))
+	}
+	return nil
+}
+
+// Decrypt decrypts an encrypted callback payload and returns the plaintext message
+func (c *CallbackCrypto) Decrypt(encrypt string) ([]byte, error) {
+	cipherText, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode callback payload: %w", err)
+	}
+	if len(cipherText) == 0 || len(cipherText)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid callback payload length: %d", len(cipherText))
+	}
+
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(cipherText))
+	cipher.NewCBCDecrypter(block, c.aesKey[:aes.BlockSize]).CryptBlocks(plain, cipherText)
+
+	// Strip PKCS#7 padding (DingTalk pads to 32 bytes)
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > 32 || pad > len(plain) {
+		return nil, errors.New("invalid callback payload padding")
+	}
+	plain = plain[:len(plain)-pad]
+
+	// Layout: random(16) | msg length(4, big endian) | msg | owner key
+	if len(plain) < 20 {
+		return nil, errors.New("callback payload too short")
+	}
+	msgLen := int(binary.BigEndian.Uint32(plain[16:20]))
+	if 20+msgLen > len(plain) {
+		return nil, errors.New("invalid callback message length")
+	}
+	msg := plain[20 : 20+msgLen]
+	if owner := string(plain[20+msgLen:]); c.ownerKey != "" && owner != c.ownerKey {
+		return nil, fmt.Errorf("callback owner mismatch: %s", owner)
+	}
+
+	return msg, nil
+}
+
+// Encrypt encrypts a plaintext message in the callback wire format
+func (c *CallbackCrypto) Encrypt(msg []byte) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(random)
+	lenBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBytes, uint32(len(msg)))
+	buf.Write(lenBytes)
+	buf.Write(msg)
+	buf.WriteString(c.ownerKey)
+
+	// PKCS#7 padding to 32 bytes
+	pad := 32 - buf.Len()%32
+	buf.Write(bytes.Repeat([]byte{byte(pad)}, pad))
+
+	block, err := aes.NewCipher(c.aesKey)
+	if err != nil {
+		return "", err
+	}
+	cipherText := make([]byte, buf.Len())
+	cipher.NewCBCEncrypter(block, c.aesKey[:aes.BlockSize]).CryptBlocks(cipherText, buf.Bytes())
+
+	return base64.StdEncoding.EncodeToString(cipherText), nil
+}
+
+// SealMessage encrypts and signs a message, producing the body shape used on both
+// sides of the callback (DingTalk's request and our acknowledgement)
+func (c *CallbackCrypto) SealMessage(msg []byte, timestamp, nonce string) (*CallbackResponse, error) {
+	encrypt, err := c.Encrypt(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &CallbackResponse{
+		MsgSignature: c.Sign(timestamp, nonce, encrypt),
+		TimeStamp:    timestamp,
+		Nonce:        nonce,
+		Encrypt:      encrypt,
+	}, nil
+}
+
+// SuccessResponse builds the encrypted "success" acknowledgement DingTalk expects
+func (c *CallbackCrypto) SuccessResponse(timestamp, nonce string) (*CallbackResponse, error) {
+	return c.SealMessage([]byte(callbackSuccessPlaintext), timestamp, nonce)
+}
+
+// CallbackKeyring opens callbacks addressed to any of several apps, each with its own crypto
+type CallbackKeyring struct {
+	cryptos []*CallbackCrypto
+}
+
+// NewCallbackKeyring creates a keyring of the given apps' callback cryptos
+func NewCallbackKeyring(cryptos ...*CallbackCrypto) *CallbackKeyring {
+	return &CallbackKeyring{cryptos: cryptos}
+}
+
+// Open verifies and decrypts a callback with the crypto of the app it is addressed to: the one
+// whose token signed it and whose owner key (app key or corp ID) the payload carries. Returns
+// ErrStaleTimestamp if the timestamp is too far from now, or ErrInvalidSignature if no app's
+// token produced the signature.
+func (k *CallbackKeyring) Open(signature, timestamp, nonce, encrypt string) (*CallbackCrypto, []byte, error) {
+	if err := checkTimestamp(timestamp, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	err := ErrInvalidSignature
+	for _, crypto := range k.cryptos {
+		if crypto.VerifySignature(signature, timestamp, nonce, encrypt) != nil {
+			continue
+		}
+		msg, decryptErr := crypto.Decrypt(encrypt)
+		if decryptErr != nil {
+			err = decryptErr // Signed with a shared token but meant for another app, or corrupt
+			continue
+		}
+		return crypto, msg, nil
+	}
+	return nil, nil, err
+}
@@ -0,0 +1,68 @@
+package dingtalk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PostCallbackEvent stands in for DingTalk's event push: it seals the event with crypto, posts
+// it to the callback receiver at target and checks the encrypted acknowledgement the way
+// DingTalk would. Returns the decrypted acknowledgement ("success").
+func PostCallbackEvent(ctx context.Context, target string, crypto *CallbackCrypto, event *CallbackEvent) ([]byte, error) {
+	msg, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	nonce := uuid.NewString()[:8]
+	sealed, err := crypto.SealMessage(msg, timestamp, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt event: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("signature", sealed.MsgSignature)
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", nonce)
+
+	body, _ := json.Marshal(CallbackRequest{Encrypt: sealed.Encrypt})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("callback receiver returned HTTP %d: %s", resp.StatusCode, respBody)
+	}
+
+	var ack CallbackResponse
+	if err := json.Unmarshal(respBody, &ack); err != nil || ack.Encrypt == "" {
+		return nil, fmt.Errorf("response is not an encrypted ack: %s", respBody)
+	}
+	if err := crypto.VerifySignature(ack.MsgSignature, ack.TimeStamp, ack.Nonce, ack.Encrypt); err != nil {
+		return nil, fmt.Errorf("ack signature invalid: %w", err)
+	}
+	plain, err := crypto.Decrypt(ack.Encrypt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt ack: %w", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,165 @@
+package dingtalk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testAESKey returns a 43-character encoding AES key derived from seed
+func testAESKey(seed byte) string {
+	key := bytes.Repeat([]byte{seed}, 32)
+	return base64.StdEncoding.EncodeToString(key)[:43]
+}
+
+// testTimestamp returns the current time as a callback timestamp
+func testTimestamp() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
+
+func newTestCrypto(t *testing.T, token, aesKey, ownerKey string) *CallbackCrypto {
+	t.Helper()
+	crypto, err := NewCallbackCrypto(token, aesKey, ownerKey)
+	if err != nil {
+		t.Fatalf("NewCallbackCrypto: %v", err)
+	}
+	return crypto
+}
+
+func TestCallbackCryptoRoundTrip(t *testing.T) {
+	crypto := newTestCrypto(t, "token", testAESKey(1), "app-key")
+	msg := []byte(`{"EventType":"bpms_instance_change","processInstanceId":"inst-1"}`)
+
+	sealed, err := crypto.SealMessage(msg, testTimestamp(), "nonce123")
+	if err != nil {
+		t.Fatalf("SealMessage: %v", err)
+	}
+	if err := crypto.VerifySignature(sealed.MsgSignature, sealed.TimeStamp, sealed.Nonce, sealed.Encrypt); err != nil {
+		t.Fatalf("VerifySignature: %v", err)
+	}
+
+	plain, err := crypto.Decrypt(sealed.Encrypt)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(plain, msg) {
+		t.Errorf("Decrypt = %s, want %s", plain, msg)
+	}
+}
+
+func TestCallbackCryptoRejectsTampering(t *testing.T) {
+	crypto := newTestCrypto(t, "token", testAESKey(1), "app-key")
+	sealed, err := crypto.SealMessage([]byte("hello"), testTimestamp(), "nonce123")
+	if err != nil {
+		t.Fatalf("SealMessage: %v", err)
+	}
+
+	if err := crypto.VerifySignature(sealed.MsgSignature, sealed.TimeStamp, "other-nonce", sealed.Encrypt); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySignature with a changed nonce = %v, want ErrInvalidSignature", err)
+	}
+
+	other := newTestCrypto(t, "other-token", testAESKey(1), "app-key")
+	if err := other.VerifySignature(sealed.MsgSignature, sealed.TimeStamp, sealed.Nonce, sealed.Encrypt); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySignature with another token = %v, want ErrInvalidSignature", err)
+	}
+
+	// A captured callback can't be replayed once its timestamp is stale
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).UnixMilli(), 10)
+	stale, err := crypto.SealMessage([]byte("hello"), old, "nonce123")
+	if err != nil {
+		t.Fatalf("SealMessage: %v", err)
+	}
+	if err := crypto.VerifySignature(stale.MsgSignature, stale.TimeStamp, stale.Nonce, stale.Encrypt); !errors.Is(err, ErrStaleTimestamp) {
+		t.Errorf("VerifySignature with an hour-old timestamp = %v, want ErrStaleTimestamp", err)
+	}
+	if _, _, err := NewCallbackKeyring(crypto).Open(stale.MsgSignature, stale.TimeStamp, stale.Nonce, stale.Encrypt); !errors.Is(err, ErrStaleTimestamp) {
+		t.Errorf("Open with an hour-old timestamp = %v, want ErrStaleTimestamp", err)
+	}
+
+	otherOwner := newTestCrypto(t, "token", testAESKey(1), "other-app")
+	if _, err := otherOwner.Decrypt(sealed.Encrypt); err == nil {
+		t.Error("Decrypt of a payload bound to another app succeeded")
+	}
+}
+
+func TestSuccessResponse(t *testing.T) {
+	crypto := newTestCrypto(t, "token", testAESKey(1), "app-key")
+	ack, err := crypto.SuccessResponse(testTimestamp(), "nonce123")
+	if err != nil {
+		t.Fatalf("SuccessResponse: %v", err)
+	}
+	if err := crypto.VerifySignature(ack.MsgSignature, ack.TimeStamp, ack.Nonce, ack.Encrypt); err != nil {
+		t.Fatalf("VerifySignature: %v", err)
+	}
+	plain, err := crypto.Decrypt(ack.Encrypt)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(plain) != "success" {
+		t.Errorf("ack = %q, want %q", plain, "success")
+	}
+}
+
+func TestCallbackKeyringOpen(t *testing.T) {
+	// Two apps sharing token and AES key are told apart by the owner key in the payload;
+	// a third has keys of its own
+	appA := newTestCrypto(t, "token", testAESKey(1), "app-a")
+	appB := newTestCrypto(t, "token", testAESKey(1), "app-b")
+	appC := newTestCrypto(t, "token-c", testAESKey(2), "app-c")
+	keys := NewCallbackKeyring(appA, appB, appC)
+
+	for _, sender := range []*CallbackCrypto{appA, appB, appC} {
+		sealed, err := sender.SealMessage([]byte("event for "+sender.OwnerKey()), testTimestamp(), "nonce123")
+		if err != nil {
+			t.Fatalf("SealMessage: %v", err)
+		}
+
+		crypto, plain, err := keys.Open(sealed.MsgSignature, sealed.TimeStamp, sealed.Nonce, sealed.Encrypt)
+		if err != nil {
+			t.Fatalf("Open for %s: %v", sender.OwnerKey(), err)
+		}
+		if crypto != sender {
+			t.Errorf("Open picked %s, want %s", crypto.OwnerKey(), sender.OwnerKey())
+		}
+		if want := "event for " + sender.OwnerKey(); string(plain) != want {
+			t.Errorf("Open = %q, want %q", plain, want)
+		}
+	}
+
+	stranger := newTestCrypto(t, "unknown-token", testAESKey(3), "app-x")
+	sealed, err := stranger.SealMessage([]byte("hello"), testTimestamp(), "nonce123")
+	if err != nil {
+		t.Fatalf("SealMessage: %v", err)
+	}
+	if _, _, err := keys.Open(sealed.MsgSignature, sealed.TimeStamp, sealed.Nonce, sealed.Encrypt); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Open of an unknown app's event = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Date(2026, 1, 5, 11, 40, 18, 0, time.UTC)
+	for _, tc := range []struct {
+		name      string
+		timestamp string
+		wantErr   bool
+	}{
+		{"now", strconv.FormatInt(now.UnixMilli(), 10), false},
+		{"within skew", strconv.FormatInt(now.Add(-4*time.Minute).UnixMilli(), 10), false},
+		{"clock ahead", strconv.FormatInt(now.Add(4*time.Minute).UnixMilli(), 10), false},
+		{"too old", strconv.FormatInt(now.Add(-6*time.Minute).UnixMilli(), 10), true},
+		{"too far ahead", strconv.FormatInt(now.Add(6*time.Minute).UnixMilli(), 10), true},
+		{"empty", "", true},
+		{"not a number", "yesterday", true},
+	} {
+		err := checkTimestamp(tc.timestamp, now)
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("%s: checkTimestamp = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrStaleTimestamp) {
+			t.Errorf("%s: checkTimestamp = %v, want ErrStaleTimestamp", tc.name, err)
+		}
+	}
+}
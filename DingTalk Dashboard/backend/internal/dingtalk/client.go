@@ -1,7 +1,9 @@
 package dingtalk
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,8 +18,35 @@ const (
 	approvalListURL   = "https://oapi.dingtalk.com/topapi/processinstance/listids"
 	approvalDetailURL = "https://oapi.dingtalk.com/topapi/processinstance/get"
 	userInfoURL       = "https://oapi.dingtalk.com/topapi/v2/user/get"
+	fileURLURL        = "https://oapi.dingtalk.com/topapi/processinstance/file/url/get"
+	deptListSubURL    = "https://oapi.dingtalk.com/topapi/v2/department/listsub"
+	deptGetURL        = "https://oapi.dingtalk.com/topapi/v2/department/get"
+	deptUserListURL   = "https://oapi.dingtalk.com/topapi/v2/user/list"
 )
 
+// MaxListIDsRange is the widest start/end window the listids API accepts
+const MaxListIDsRange = 120 * 24 * time.Hour
+
+// TimeWindow is a half-open [Start, End) time range
+type TimeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// SplitTimeRange splits [start, end) into consecutive windows no wider than maxRange
+func SplitTimeRange(start, end time.Time, maxRange time.Duration) []TimeWindow {
+	var windows []TimeWindow
+	for start.Before(end) {
+		windowEnd := start.Add(maxRange)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+		windows = append(windows, TimeWindow{Start: start, End: windowEnd})
+		start = windowEnd
+	}
+	return windows
+}
+
 // Client is a DingTalk API client
 type Client struct {
 	appKey      string
@@ -26,21 +55,23 @@ type Client struct {
 	tokenExpiry time.Time
 	mu          sync.RWMutex
 	httpClient  *http.Client
+	limiter     *RateLimiter
 }
 
-// NewClient creates a new DingTalk client
-func NewClient(appKey, appSecret string) *Client {
+// NewClient creates a new DingTalk client limited to qps requests per second
+func NewClient(appKey, appSecret string, qps int) *Client {
 	return &Client{
 		appKey:    appKey,
 		appSecret: appSecret,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		limiter: NewRateLimiter(qps, qps),
 	}
 }
 
 // getAccessToken gets or refreshes the access token
-func (c *Client) getAccessToken() (string, error) {
+func (c *Client) getAccessToken(ctx context.Context) (string, error) {
 	c.mu.RLock()
 	if c.accessToken != "" && time.Now().Before(c.tokenExpiry) {
 		token := c.accessToken
@@ -59,9 +90,14 @@ func (c *Client) getAccessToken() (string, error) {
 
 	// Fetch new token
 	reqURL := fmt.Sprintf("%s?appkey=%s&appsecret=%s", tokenURL, c.appKey, c.appSecret)
-	resp, err := c.httpClient.Get(reqURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", err
+	}
+	countCall(ctx)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to get access token: %w", err)
+		return "", fmt.Errorf("failed to get access token: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -77,7 +113,7 @@ func (c *Client) getAccessToken() (string, error) {
 	}
 
 	if result.ErrCode != 0 {
-		return "", fmt.Errorf("DingTalk API error: %s", result.ErrMsg)
+		return "", newAPIError(tokenURL, result.ErrCode, result.ErrMsg)
 	}
 
 	c.accessToken = result.AccessToken
@@ -87,117 +123,210 @@ func (c *Client) getAccessToken() (string, error) {
 	return c.accessToken, nil
 }
 
-// GetApprovalInstanceIDs gets list of approval instance IDs (only startTime, no endTime)
-func (c *Client) GetApprovalInstanceIDs(processCode string, startTime time.Time, cursor int64, size int) (*ApprovalListResponse, error) {
-	token, err := c.getAccessToken()
+// invalidateToken drops the cached access token if it is still the one that failed,
+// forcing the next call to fetch a fresh token
+func (c *Client) invalidateToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accessToken == token {
+		c.accessToken = ""
+		c.tokenExpiry = time.Time{}
+	}
+}
+
+// post sends an authenticated POST request and decodes the response into out.
+// Throttling, token expiry and network/server errors are retried with jittered
+// backoff; token errors force a token refresh before the next attempt.
+func (c *Client) post(ctx context.Context, endpoint, contentType, body string, out interface{}) error {
+	return c.withRetry(ctx, func() (string, error) {
+		return c.postOnce(ctx, endpoint, contentType, body, out)
+	})
+}
+
+// withRetry runs a request attempt until it succeeds, fails permanently or runs out of attempts.
+// attempt returns the access token it used so a rejected token can be dropped.
+func (c *Client) withRetry(ctx context.Context, attempt func() (string, error)) error {
+	var err error
+	for n := 1; n <= maxAttempts; n++ {
+		var token string
+		token, err = attempt()
+		if err == nil || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+
+		if errors.Is(err, ErrTokenExpired) {
+			c.invalidateToken(token)
+		}
+		if n == maxAttempts {
+			break
+		}
+		if sleepErr := sleepContext(ctx, backoff(n)); sleepErr != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// postOnce performs a single request attempt and returns the token it used
+func (c *Client) postOnce(ctx context.Context, endpoint, contentType, body string, out interface{}) (string, error) {
+	token, err := c.getAccessToken(ctx)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	reqURL := fmt.Sprintf("%s?access_token=%s", approvalListURL, token)
+	if err := c.limiter.Wait(ctx); err != nil {
+		return token, err
+	}
 
-	data := url.Values{}
-	data.Set("process_code", processCode)
-	data.Set("start_time", fmt.Sprintf("%d", startTime.UnixMilli()))
-	// Note: end_time is intentionally not set as per requirements
-	data.Set("cursor", fmt.Sprintf("%d", cursor))
-	data.Set("size", fmt.Sprintf("%d", size))
+	reqURL := fmt.Sprintf("%s?access_token=%s", endpoint, token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, strings.NewReader(body))
+	if err != nil {
+		return token, err
+	}
+	req.Header.Set("Content-Type", contentType)
 
-	resp, err := c.httpClient.Post(reqURL, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+	countCall(ctx)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get instance IDs: %w", err)
+		if ctx.Err() != nil {
+			return token, ctx.Err()
+		}
+		return token, fmt.Errorf("request to %s failed: %w: %w", endpoint, ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	respBody, _ := io.ReadAll(resp.Body)
 
-	var result ApprovalListResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return token, fmt.Errorf("%w: %s returned HTTP %d", ErrUnavailable, endpoint, resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return token, fmt.Errorf("%w: %s returned HTTP %d", ErrRateLimited, endpoint, resp.StatusCode)
 	}
 
-	if result.ErrCode != 0 {
-		return nil, fmt.Errorf("DingTalk API error: %s", result.ErrMsg)
+	var status struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(respBody, &status); err != nil {
+		return token, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if status.ErrCode != 0 {
+		return token, newAPIError(endpoint, status.ErrCode, status.ErrMsg)
 	}
 
-	return &result, nil
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return token, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return token, nil
 }
 
-// GetApprovalInstanceDetail gets detailed info for an instance
-func (c *Client) GetApprovalInstanceDetail(processInstanceID string) (*ApprovalDetailResponse, error) {
-	token, err := c.getAccessToken()
-	if err != nil {
-		return nil, err
+// GetApprovalInstanceIDs gets list of approval instance IDs started in [startTime, endTime].
+// A zero endTime leaves the window open-ended. The window must not exceed MaxListIDsRange.
+func (c *Client) GetApprovalInstanceIDs(ctx context.Context, processCode string, startTime, endTime time.Time, cursor int64, size int) (*ApprovalListResponse, error) {
+	data := url.Values{}
+	data.Set("process_code", processCode)
+	data.Set("start_time", fmt.Sprintf("%d", startTime.UnixMilli()))
+	if !endTime.IsZero() {
+		data.Set("end_time", fmt.Sprintf("%d", endTime.UnixMilli()))
+	}
+	data.Set("cursor", fmt.Sprintf("%d", cursor))
+	data.Set("size", fmt.Sprintf("%d", size))
+
+	var result ApprovalListResponse
+	if err := c.post(ctx, approvalListURL, "application/x-www-form-urlencoded", data.Encode(), &result); err != nil {
+		return nil, fmt.Errorf("failed to get instance IDs: %w", err)
 	}
 
-	reqURL := fmt.Sprintf("%s?access_token=%s", approvalDetailURL, token)
+	return &result, nil
+}
 
+// GetApprovalInstanceDetail gets detailed info for an instance
+func (c *Client) GetApprovalInstanceDetail(ctx context.Context, processInstanceID string) (*ApprovalDetailResponse, error) {
 	data := url.Values{}
 	data.Set("process_instance_id", processInstanceID)
 
-	resp, err := c.httpClient.Post(reqURL, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
-	if err != nil {
+	var result ApprovalDetailResponse
+	if err := c.post(ctx, approvalDetailURL, "application/x-www-form-urlencoded", data.Encode(), &result); err != nil {
 		return nil, fmt.Errorf("failed to get instance detail: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	return &result, nil
+}
 
-	var result ApprovalDetailResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+// GetUserInfo gets user information by user ID
+func (c *Client) GetUserInfo(ctx context.Context, userID string) (*UserInfoResponse, error) {
+	reqBody, _ := json.Marshal(map[string]string{"userid": userID})
 
-	if result.ErrCode != 0 {
-		return nil, fmt.Errorf("DingTalk API error: %s", result.ErrMsg)
+	var result UserInfoResponse
+	if err := c.post(ctx, userInfoURL, "application/json", string(reqBody), &result); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
 
 	return &result, nil
 }
 
-// GetUserInfo gets user information by user ID
-func (c *Client) GetUserInfo(userID string) (*UserInfoResponse, error) {
-	token, err := c.getAccessToken()
-	if err != nil {
-		return nil, err
+// GetAttachmentDownloadURL gets a temporary download link for a file attached to an instance
+func (c *Client) GetAttachmentDownloadURL(ctx context.Context, processInstanceID, fileID string) (string, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"request": map[string]string{
+			"process_instance_id": processInstanceID,
+			"file_id":             fileID,
+		},
+	})
+
+	var result FileURLResponse
+	if err := c.post(ctx, fileURLURL, "application/json", string(reqBody), &result); err != nil {
+		return "", fmt.Errorf("failed to get attachment download url: %w", err)
+	}
+	if result.Result.DownloadURI == "" {
+		return "", fmt.Errorf("%w: no download url for file %s", ErrNotFound, fileID)
 	}
 
-	reqURL := fmt.Sprintf("%s?access_token=%s", userInfoURL, token)
+	return result.Result.DownloadURI, nil
+}
 
-	reqBody := fmt.Sprintf(`{"userid":"%s"}`, userID)
+// ListSubDepartments lists the direct child departments of a department
+func (c *Client) ListSubDepartments(ctx context.Context, deptID int64) ([]Department, error) {
+	reqBody, _ := json.Marshal(map[string]int64{"dept_id": deptID})
 
-	resp, err := c.httpClient.Post(reqURL, "application/json", strings.NewReader(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user info: %w", err)
+	var result DepartmentListResponse
+	if err := c.post(ctx, deptListSubURL, "application/json", string(reqBody), &result); err != nil {
+		return nil, fmt.Errorf("failed to list sub-departments: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	return result.Result, nil
+}
 
-	var result UserInfoResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+// GetDepartment gets a single department
+func (c *Client) GetDepartment(ctx context.Context, deptID int64) (*Department, error) {
+	reqBody, _ := json.Marshal(map[string]int64{"dept_id": deptID})
 
-	if result.ErrCode != 0 {
-		return nil, fmt.Errorf("DingTalk API error: %s", result.ErrMsg)
+	var result DepartmentDetailResponse
+	if err := c.post(ctx, deptGetURL, "application/json", string(reqBody), &result); err != nil {
+		return nil, fmt.Errorf("failed to get department: %w", err)
 	}
 
-	return &result, nil
+	return &result.Result, nil
 }
 
-// GetUserName gets user name by user ID with caching
-func (c *Client) GetUserName(userID string, cache map[string]string) string {
-	if name, ok := cache[userID]; ok {
-		return name
+// ListDepartmentUsers lists one page of the users directly in a department (size at most 100)
+func (c *Client) ListDepartmentUsers(ctx context.Context, deptID int64, cursor int64, size int) (*DepartmentUserListResponse, error) {
+	reqBody, _ := json.Marshal(map[string]int64{
+		"dept_id": deptID,
+		"cursor":  cursor,
+		"size":    int64(size),
+	})
+
+	var result DepartmentUserListResponse
+	if err := c.post(ctx, deptUserListURL, "application/json", string(reqBody), &result); err != nil {
+		return nil, fmt.Errorf("failed to list department users: %w", err)
 	}
 
-	info, err := c.GetUserInfo(userID)
-	if err != nil {
-		return userID // Return ID if can't get name
-	}
+	return &result, nil
+}
 
-	name := info.Result.Name
-	cache[userID] = name
-	return name
+// GetUserName gets user name by user ID with caching
+func (c *Client) GetUserName(ctx context.Context, userID string, cache *UserNameCache) string {
+	return cache.Resolve(ctx, c, userID)
 }
@@ -0,0 +1,105 @@
+package dingtalk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Error classes for DingTalk API failures. Use errors.Is to test for them.
+var (
+	ErrRateLimited  = errors.New("dingtalk: rate limited")
+	ErrTokenExpired = errors.New("dingtalk: access token invalid or expired")
+	ErrNotFound     = errors.New("dingtalk: resource not found")
+	ErrPermission   = errors.New("dingtalk: permission denied")
+	ErrUnavailable  = errors.New("dingtalk: service unavailable")
+)
+
+// errCodeClasses maps known errcodes to an error class
+var errCodeClasses = map[int]error{
+	// Throttling
+	88:    ErrRateLimited,
+	90002: ErrRateLimited,
+	90005: ErrRateLimited,
+	90006: ErrRateLimited,
+	90018: ErrRateLimited,
+	// Access token
+	40014: ErrTokenExpired,
+	41001: ErrTokenExpired,
+	42001: ErrTokenExpired,
+	// Missing resources
+	60003: ErrNotFound,
+	60121: ErrNotFound,
+	// Permissions / app scope
+	60011: ErrPermission,
+	60020: ErrPermission,
+	50002: ErrPermission,
+	50004: ErrPermission,
+	88001: ErrPermission,
+}
+
+// APIError is a non-zero errcode returned by DingTalk
+type APIError struct {
+	Endpoint string
+	Code     int
+	Message  string
+	class    error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("DingTalk API error %d: %s", e.Code, e.Message)
+}
+
+// Unwrap exposes the error class so errors.Is(err, ErrRateLimited) works
+func (e *APIError) Unwrap() error {
+	return e.class
+}
+
+// newAPIError builds an APIError and classifies its errcode
+func newAPIError(endpoint string, code int, message string) *APIError {
+	return &APIError{
+		Endpoint: endpoint,
+		Code:     code,
+		Message:  message,
+		class:    errCodeClasses[code],
+	}
+}
+
+// IsTransient reports whether err is worth retrying later (throttling, token
+// expiry, network or server trouble) rather than a permanent failure
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, ErrTokenExpired) ||
+		errors.Is(err, ErrUnavailable)
+}
+
+// Retry policy for a single API call
+const (
+	maxAttempts = 4
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 8 * time.Second
+)
+
+// backoff returns the jittered delay before retry number attempt (1-based)
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	// Full jitter: anywhere between half and the whole delay
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleepContext waits for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
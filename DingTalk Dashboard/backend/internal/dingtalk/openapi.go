@@ -0,0 +1,132 @@
+package dingtalk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// openAPIBaseURL is the host of the v1.0 APIs, which take the token in a header and report
+// errors through the HTTP status and a string code
+const openAPIBaseURL = "https://api.dingtalk.com"
+
+// OpenAPIError is an error response from a v1.0 API
+type OpenAPIError struct {
+	Endpoint string
+	Status   int
+	Code     string
+	Message  string
+	class    error
+}
+
+func (e *OpenAPIError) Error() string {
+	return fmt.Sprintf("DingTalk API error %s (HTTP %d): %s", e.Code, e.Status, e.Message)
+}
+
+// Unwrap exposes the error class so errors.Is(err, ErrNotFound) works
+func (e *OpenAPIError) Unwrap() error {
+	return e.class
+}
+
+// newOpenAPIError builds an OpenAPIError and classifies it by status and code
+func newOpenAPIError(endpoint string, status int, code, message string) *OpenAPIError {
+	var class error
+	switch {
+	case status == http.StatusTooManyRequests || strings.Contains(code, "QpsLimit") || strings.Contains(code, "Throttling"):
+		class = ErrRateLimited
+	case status == http.StatusUnauthorized || code == "InvalidAuthentication":
+		class = ErrTokenExpired
+	case status == http.StatusForbidden:
+		class = ErrPermission
+	case status == http.StatusNotFound || strings.Contains(strings.ToLower(code), "notfound"):
+		class = ErrNotFound
+	case status >= http.StatusInternalServerError:
+		class = ErrUnavailable
+	}
+	return &OpenAPIError{
+		Endpoint: endpoint,
+		Status:   status,
+		Code:     code,
+		Message:  message,
+		class:    class,
+	}
+}
+
+// callOpenAPI sends an authenticated request to a v1.0 API path and decodes the response into
+// out (which may be nil). body, if not nil, is sent as JSON. Retried like post.
+func (c *Client) callOpenAPI(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	return c.withRetry(ctx, func() (string, error) {
+		return c.callOpenAPIOnce(ctx, method, path, query, payload, out)
+	})
+}
+
+// callOpenAPIOnce performs a single v1.0 request attempt and returns the token it used
+func (c *Client) callOpenAPIOnce(ctx context.Context, method, path string, query url.Values, payload []byte, out interface{}) (string, error) {
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return token, err
+	}
+
+	reqURL := openAPIBaseURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return token, err
+	}
+	req.Header.Set("x-acs-dingtalk-access-token", token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	countCall(ctx)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return token, ctx.Err()
+		}
+		return token, fmt.Errorf("request to %s failed: %w: %w", path, ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var status struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(respBody, &status)
+		return token, newOpenAPIError(path, resp.StatusCode, status.Code, status.Message)
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return token, nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return token, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return token, nil
+}
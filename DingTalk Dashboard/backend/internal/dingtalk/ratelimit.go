@@ -0,0 +1,72 @@
+package dingtalk
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimiter is a token-bucket limiter shared by every request a Client makes
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing qps requests per second with the given burst
+func NewRateLimiter(qps, burst int) *RateLimiter {
+	if qps < 1 {
+		qps = 1
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   float64(qps),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or the context is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+type callCounterKey struct{}
+
+// WithCallCounter returns a context that counts every DingTalk API request made with it
+func WithCallCounter(ctx context.Context, counter *int64) context.Context {
+	return context.WithValue(ctx, callCounterKey{}, counter)
+}
+
+// countCall increments the call counter attached to ctx, if any
+func countCall(ctx context.Context) {
+	if counter, ok := ctx.Value(callCounterKey{}).(*int64); ok {
+		atomic.AddInt64(counter, 1)
+	}
+}
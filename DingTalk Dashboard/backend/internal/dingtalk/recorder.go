@@ -0,0 +1,186 @@
+package dingtalk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fixture directory layout shared by Recorder and ReplaySource:
+//
+//	<dir>/index.json             instance ID -> process code and create time
+//	<dir>/instances/<id>.json    raw ApprovalDetailResponse
+//	<dir>/users/<userid>.json    raw UserInfoResponse
+const (
+	fixtureIndexFile    = "index.json"
+	fixtureInstancesDir = "instances"
+	fixtureUsersDir     = "users"
+)
+
+// FixtureInstance is one entry of the fixture index
+type FixtureInstance struct {
+	ProcessInstanceID string     `json:"process_instance_id"`
+	ProcessCode       string     `json:"process_code"`
+	CreateTime        *time.Time `json:"create_time,omitempty"`
+}
+
+// fixtureIndex is the on-disk index of recorded instances
+type fixtureIndex struct {
+	Instances []FixtureInstance `json:"instances"`
+}
+
+// Recorder wraps an ApprovalSource and saves every response to a fixture directory
+// so the sync can later be replayed offline with ReplaySource
+type Recorder struct {
+	source ApprovalSource
+	*fixtureRecording
+}
+
+// fixtureRecording is the fixture directory and index shared by recorders writing to it
+type fixtureRecording struct {
+	dir   string
+	mu    sync.Mutex
+	index map[string]*FixtureInstance
+}
+
+// NewRecorder creates a recorder writing fixtures into dir, keeping any existing index
+func NewRecorder(source ApprovalSource, dir string) (*Recorder, error) {
+	for _, sub := range []string{fixtureInstancesDir, fixtureUsersDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+		}
+	}
+
+	r := &Recorder{
+		source: source,
+		fixtureRecording: &fixtureRecording{
+			dir:   dir,
+			index: make(map[string]*FixtureInstance),
+		},
+	}
+
+	existing, err := readFixtureIndex(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for i := range existing {
+		r.index[existing[i].ProcessInstanceID] = &existing[i]
+	}
+
+	return r, nil
+}
+
+// Wrap returns a recorder for another source that writes into the same fixture directory and
+// index, e.g. for a second DingTalk app
+func (r *Recorder) Wrap(source ApprovalSource) *Recorder {
+	return &Recorder{source: source, fixtureRecording: r.fixtureRecording}
+}
+
+// GetApprovalInstanceIDs lists IDs from the wrapped source and records them in the index
+func (r *Recorder) GetApprovalInstanceIDs(ctx context.Context, processCode string, startTime, endTime time.Time, cursor int64, size int) (*ApprovalListResponse, error) {
+	resp, err := r.source.GetApprovalInstanceIDs(ctx, processCode, startTime, endTime, cursor, size)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	for _, id := range resp.Result.List {
+		if entry, ok := r.index[id]; ok {
+			entry.ProcessCode = processCode
+		} else {
+			r.index[id] = &FixtureInstance{ProcessInstanceID: id, ProcessCode: processCode}
+		}
+	}
+	err = r.saveIndexLocked()
+	r.mu.Unlock()
+
+	return resp, err
+}
+
+// GetApprovalInstanceDetail fetches a detail from the wrapped source and saves it
+func (r *Recorder) GetApprovalInstanceDetail(ctx context.Context, processInstanceID string) (*ApprovalDetailResponse, error) {
+	resp, err := r.source.GetApprovalInstanceDetail(ctx, processInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFixture(filepath.Join(r.dir, fixtureInstancesDir, fixtureFileName(processInstanceID)), resp); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	entry, ok := r.index[processInstanceID]
+	if !ok {
+		entry = &FixtureInstance{ProcessInstanceID: processInstanceID}
+		r.index[processInstanceID] = entry
+	}
+	if resp.ProcessInstance != nil {
+		entry.CreateTime = ParseDingTalkTime(resp.ProcessInstance.CreateTime)
+	}
+	err = r.saveIndexLocked()
+	r.mu.Unlock()
+
+	return resp, err
+}
+
+// GetUserInfo fetches user info from the wrapped source and saves it
+func (r *Recorder) GetUserInfo(ctx context.Context, userID string) (*UserInfoResponse, error) {
+	resp, err := r.source.GetUserInfo(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFixture(filepath.Join(r.dir, fixtureUsersDir, fixtureFileName(userID)), resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// saveIndexLocked writes the index file; r.mu must be held
+func (r *Recorder) saveIndexLocked() error {
+	index := fixtureIndex{Instances: make([]FixtureInstance, 0, len(r.index))}
+	for _, entry := range r.index {
+		index.Instances = append(index.Instances, *entry)
+	}
+	sort.Slice(index.Instances, func(i, j int) bool {
+		return index.Instances[i].ProcessInstanceID < index.Instances[j].ProcessInstanceID
+	})
+	return writeFixture(filepath.Join(r.dir, fixtureIndexFile), index)
+}
+
+// readFixtureIndex loads the index entries from a fixture directory
+func readFixtureIndex(dir string) ([]FixtureInstance, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fixtureIndexFile))
+	if err != nil {
+		return nil, err
+	}
+	var index fixtureIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture index: %w", err)
+	}
+	return index.Instances, nil
+}
+
+// writeFixture writes v as indented JSON, via a temp file so readers never see partial files
+func writeFixture(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// fixtureFileName turns an ID into a safe file name
+func fixtureFileName(id string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(id) + ".json"
+}
@@ -0,0 +1,328 @@
+package dingtalk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplaySource is an in-process ApprovalSource serving recorded or hand-built responses.
+// It lets the full sync pipeline run without DingTalk credentials.
+type ReplaySource struct {
+	mu        sync.RWMutex
+	instances map[string]*replayInstance
+	users     map[string]*UserInfoResponse
+	files     int // Files uploaded through UploadCommentFile, for unique IDs
+	created   int // Instances started through CreateInstance, for unique IDs
+}
+
+type replayInstance struct {
+	processCode string
+	createTime  *time.Time
+	detail      *ApprovalDetailResponse
+}
+
+var (
+	_ ApprovalSource  = (*ReplaySource)(nil)
+	_ CommentWriter   = (*ReplaySource)(nil)
+	_ InstanceCreator = (*ReplaySource)(nil)
+)
+
+// NewReplaySource creates an empty replay source
+func NewReplaySource() *ReplaySource {
+	return &ReplaySource{
+		instances: make(map[string]*replayInstance),
+		users:     make(map[string]*UserInfoResponse),
+	}
+}
+
+// LoadReplaySource loads a fixture directory written by Recorder
+func LoadReplaySource(dir string) (*ReplaySource, error) {
+	index, err := readFixtureIndex(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture index: %w", err)
+	}
+
+	r := NewReplaySource()
+	for _, entry := range index {
+		var detail ApprovalDetailResponse
+		path := filepath.Join(dir, fixtureInstancesDir, fixtureFileName(entry.ProcessInstanceID))
+		if err := readFixture(path, &detail); err != nil {
+			if os.IsNotExist(err) {
+				continue // Listed but never fetched
+			}
+			return nil, err
+		}
+		r.AddInstance(entry.ProcessCode, entry.ProcessInstanceID, &detail)
+	}
+
+	userFiles, err := filepath.Glob(filepath.Join(dir, fixtureUsersDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range userFiles {
+		var user UserInfoResponse
+		if err := readFixture(path, &user); err != nil {
+			return nil, err
+		}
+		userID := user.Result.UserID
+		if userID == "" {
+			userID = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		r.AddUser(userID, &user)
+	}
+
+	return r, nil
+}
+
+// AddInstance registers an instance detail under a process code
+func (r *ReplaySource) AddInstance(processCode, processInstanceID string, detail *ApprovalDetailResponse) {
+	inst := &replayInstance{processCode: processCode, detail: detail}
+	if detail.ProcessInstance != nil {
+		inst.createTime = ParseDingTalkTime(detail.ProcessInstance.CreateTime)
+	}
+
+	r.mu.Lock()
+	r.instances[processInstanceID] = inst
+	r.mu.Unlock()
+}
+
+// RemoveInstance forgets an instance, so it is neither listed nor fetchable, as if it had
+// been deleted in DingTalk
+func (r *ReplaySource) RemoveInstance(processInstanceID string) {
+	r.mu.Lock()
+	delete(r.instances, processInstanceID)
+	r.mu.Unlock()
+}
+
+// AddUser registers user info for a user ID
+func (r *ReplaySource) AddUser(userID string, info *UserInfoResponse) {
+	r.mu.Lock()
+	r.users[userID] = info
+	r.mu.Unlock()
+}
+
+// GetApprovalInstanceIDs pages through instances of processCode created within the window.
+// The cursor is an offset into the create-time ordered list.
+func (r *ReplaySource) GetApprovalInstanceIDs(ctx context.Context, processCode string, startTime, endTime time.Time, cursor int64, size int) (*ApprovalListResponse, error) {
+	r.mu.RLock()
+	type match struct {
+		id         string
+		createTime time.Time
+	}
+	var matches []match
+	for id, inst := range r.instances {
+		if inst.processCode != processCode {
+			continue
+		}
+		var created time.Time
+		if inst.createTime != nil {
+			created = *inst.createTime
+			if created.Before(startTime) || (!endTime.IsZero() && !created.Before(endTime)) {
+				continue
+			}
+		}
+		matches = append(matches, match{id: id, createTime: created})
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].createTime.Equal(matches[j].createTime) {
+			return matches[i].createTime.Before(matches[j].createTime)
+		}
+		return matches[i].id < matches[j].id
+	})
+
+	resp := &ApprovalListResponse{}
+	start := int(cursor)
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + size
+	if end > len(matches) {
+		end = len(matches)
+	}
+	for _, m := range matches[start:end] {
+		resp.Result.List = append(resp.Result.List, m.id)
+	}
+	if end < len(matches) {
+		resp.Result.NextCursor = int64(end)
+	}
+
+	return resp, nil
+}
+
+// GetApprovalInstanceDetail returns the stored detail for an instance
+func (r *ReplaySource) GetApprovalInstanceDetail(ctx context.Context, processInstanceID string) (*ApprovalDetailResponse, error) {
+	r.mu.RLock()
+	inst, ok := r.instances[processInstanceID]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: process instance %s", ErrNotFound, processInstanceID)
+	}
+	return inst.detail, nil
+}
+
+// GetUserInfo returns the stored user info for a user ID
+func (r *ReplaySource) GetUserInfo(ctx context.Context, userID string) (*UserInfoResponse, error) {
+	r.mu.RLock()
+	info, ok := r.users[userID]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: user %s", ErrNotFound, userID)
+	}
+	return info, nil
+}
+
+// UploadCommentFile pretends to store a file in DingTalk drive and returns its reference
+func (r *ReplaySource) UploadCommentFile(ctx context.Context, userID, fileName string, content []byte) (*CommentFile, error) {
+	r.mu.Lock()
+	r.files++
+	id := r.files
+	r.mu.Unlock()
+
+	return &CommentFile{
+		SpaceID:  "replay",
+		FileID:   fmt.Sprintf("replay-%d", id),
+		FileName: fileName,
+		FileSize: fmt.Sprintf("%d", len(content)),
+		FileType: fileType(fileName),
+	}, nil
+}
+
+// AddComment appends the comment to the instance's operation records, the way DingTalk
+// reports it on the next fetch
+func (r *ReplaySource) AddComment(ctx context.Context, comment *Comment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inst, ok := r.instances[comment.ProcessInstanceID]
+	if !ok || inst.detail.ProcessInstance == nil {
+		return fmt.Errorf("%w: process instance %s", ErrNotFound, comment.ProcessInstanceID)
+	}
+
+	record := OperationRecord{
+		UserID:          comment.UserID,
+		Date:            time.Now().Format("2006-01-02 15:04:05"),
+		OperationType:   "ADD_REMARK",
+		OperationResult: "NONE",
+		Remark:          comment.Text,
+	}
+	for _, file := range comment.Files {
+		record.Attachments = append(record.Attachments, OperationRecordAttachment{
+			FileID:   file.FileID,
+			FileName: file.FileName,
+			FileSize: file.FileSize,
+			FileType: file.FileType,
+		})
+	}
+
+	// Copy rather than modify, since a sync may be reading the current detail
+	pi := *inst.detail.ProcessInstance
+	pi.OperationRecords = append(append([]OperationRecord(nil), pi.OperationRecords...), record)
+	detail := &ApprovalDetailResponse{ProcessInstance: &pi}
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	detail.Raw = raw
+
+	r.instances[comment.ProcessInstanceID] = &replayInstance{
+		processCode: inst.processCode,
+		createTime:  inst.createTime,
+		detail:      detail,
+	}
+	return nil
+}
+
+// GetFormSchema derives a form schema from the form values of the process's replayed
+// instances. Nothing is required and select fields have no options, since recorded values
+// don't carry them.
+func (r *ReplaySource) GetFormSchema(ctx context.Context, processCode string) (*FormSchema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema := &FormSchema{ProcessCode: processCode}
+	seen := make(map[string]bool)
+	for _, inst := range r.instances {
+		if inst.processCode != processCode || inst.detail.ProcessInstance == nil {
+			continue
+		}
+		for _, fv := range inst.detail.ProcessInstance.FormComponentValues {
+			key := fv.ID
+			if key == "" {
+				key = fv.Name
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			schema.Components = append(schema.Components, FormComponent{
+				ID:            fv.ID,
+				ComponentType: fv.ComponentType,
+				Label:         fv.Name,
+				BizAlias:      fv.BizAlias,
+			})
+		}
+	}
+	if len(schema.Components) == 0 {
+		return nil, fmt.Errorf("%w: no replayed instances of %s", ErrNotFound, processCode)
+	}
+	return schema, nil
+}
+
+// CreateInstance adds a RUNNING instance with the given form values
+func (r *ReplaySource) CreateInstance(ctx context.Context, req *CreateInstanceRequest) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.created++
+	id := fmt.Sprintf("replay-created-%d", r.created)
+	now := time.Now()
+
+	pi := &ProcessInstance{
+		Title:            "NCR " + id,
+		Status:           "RUNNING",
+		BusinessID:       fmt.Sprintf("%s%04d", now.Format("200601021504"), r.created),
+		OriginatorUserID: req.OriginatorUserID,
+		OriginatorDeptID: fmt.Sprintf("%d", req.DeptID),
+		CreateTime:       now.Format("2006-01-02 15:04:05"),
+		OperationRecords: []OperationRecord{{
+			UserID:          req.OriginatorUserID,
+			Date:            now.Format("2006-01-02 15:04:05"),
+			OperationType:   "START_PROCESS_INSTANCE",
+			OperationResult: "NONE",
+		}},
+	}
+	for _, value := range req.Values {
+		pi.FormComponentValues = append(pi.FormComponentValues, FormComponentValue{Name: value.Name, Value: value.Value})
+	}
+
+	detail := &ApprovalDetailResponse{ProcessInstance: pi}
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return "", err
+	}
+	detail.Raw = raw
+
+	r.instances[id] = &replayInstance{processCode: req.ProcessCode, createTime: &now, detail: detail}
+	return id, nil
+}
+
+// readFixture decodes a JSON fixture file into v
+func readFixture(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode fixture %s: %w", path, err)
+	}
+	return nil
+}
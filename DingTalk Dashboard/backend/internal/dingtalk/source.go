@@ -0,0 +1,118 @@
+package dingtalk
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ApprovalSource is the subset of the DingTalk API the approval sync pipeline needs.
+// Client implements it against the live API; Recorder and ReplaySource wrap or fake it.
+type ApprovalSource interface {
+	GetApprovalInstanceIDs(ctx context.Context, processCode string, startTime, endTime time.Time, cursor int64, size int) (*ApprovalListResponse, error)
+	GetApprovalInstanceDetail(ctx context.Context, processInstanceID string) (*ApprovalDetailResponse, error)
+	GetUserInfo(ctx context.Context, userID string) (*UserInfoResponse, error)
+}
+
+var _ ApprovalSource = (*Client)(nil)
+
+// FileSource resolves DingTalk drive files attached to an instance to download links
+type FileSource interface {
+	GetAttachmentDownloadURL(ctx context.Context, processInstanceID, fileID string) (string, error)
+}
+
+var _ FileSource = (*Client)(nil)
+
+// ContactSource is the subset of the contact API the user directory needs
+type ContactSource interface {
+	UserLookup
+	ListSubDepartments(ctx context.Context, deptID int64) ([]Department, error)
+	GetDepartment(ctx context.Context, deptID int64) (*Department, error)
+	ListDepartmentUsers(ctx context.Context, deptID int64, cursor int64, size int) (*DepartmentUserListResponse, error)
+}
+
+var _ ContactSource = (*Client)(nil)
+
+// CommentWriter posts comments to process instances on behalf of a DingTalk user
+type CommentWriter interface {
+	// UploadCommentFile stores a file in the user's approval drive space so it can be attached
+	UploadCommentFile(ctx context.Context, userID, fileName string, content []byte) (*CommentFile, error)
+	AddComment(ctx context.Context, comment *Comment) error
+}
+
+var _ CommentWriter = (*Client)(nil)
+
+// InstanceCreator starts new process instances from form values
+type InstanceCreator interface {
+	GetFormSchema(ctx context.Context, processCode string) (*FormSchema, error)
+	CreateInstance(ctx context.Context, req *CreateInstanceRequest) (string, error)
+}
+
+var _ InstanceCreator = (*Client)(nil)
+
+// UserLookup resolves DingTalk user IDs to user info
+type UserLookup interface {
+	GetUserInfo(ctx context.Context, userID string) (*UserInfoResponse, error)
+}
+
+// StaticUserLookup resolves user names from a fixed ID -> name map without calling the API
+type StaticUserLookup map[string]string
+
+// GetUserInfo returns the stored name for userID
+func (m StaticUserLookup) GetUserInfo(ctx context.Context, userID string) (*UserInfoResponse, error) {
+	name, ok := m[userID]
+	if !ok {
+		return nil, fmt.Errorf("%w: user %s", ErrNotFound, userID)
+	}
+	info := &UserInfoResponse{}
+	info.Result.UserID = userID
+	info.Result.Name = name
+	return info, nil
+}
+
+// UserNameCache caches resolved user names; safe for concurrent use
+type UserNameCache struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+// NewUserNameCache creates an empty user name cache
+func NewUserNameCache() *UserNameCache {
+	return &UserNameCache{names: make(map[string]string)}
+}
+
+// Resolve returns the cached name for userID, looking it up on a miss.
+// Falls back to the raw user ID if the lookup fails.
+func (c *UserNameCache) Resolve(ctx context.Context, lookup UserLookup, userID string) string {
+	c.mu.Lock()
+	name, ok := c.names[userID]
+	c.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	info, err := lookup.GetUserInfo(ctx, userID)
+	if err != nil {
+		return userID // Return ID if can't get name
+	}
+
+	name = info.Result.Name
+	c.mu.Lock()
+	c.names[userID] = name
+	c.mu.Unlock()
+	return name
+}
+
+// Names returns the cached names for the given user IDs (IDs not yet resolved are omitted)
+func (c *UserNameCache) Names(userIDs ...string) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make(map[string]string, len(userIDs))
+	for _, id := range userIDs {
+		if name, ok := c.names[id]; ok {
+			names[id] = name
+		}
+	}
+	return names
+}
@@ -1,6 +1,9 @@
 package dingtalk
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ApprovalListResponse represents the response from list instance IDs API
 type ApprovalListResponse struct {
@@ -18,6 +21,21 @@ type ApprovalDetailResponse struct {
 	ErrCode         int              `json:"errcode"`
 	ErrMsg          string           `json:"errmsg"`
 	ProcessInstance *ProcessInstance `json:"process_instance"`
+
+	// Raw is the undecoded response body, kept so it can be archived as-is
+	Raw json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the response and keeps a copy of the raw body
+func (r *ApprovalDetailResponse) UnmarshalJSON(data []byte) error {
+	type plain ApprovalDetailResponse
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*r = ApprovalDetailResponse(decoded)
+	r.Raw = append(json.RawMessage(nil), data...)
+	return nil
 }
 
 // ProcessInstance represents the actual approval instance data
@@ -65,6 +83,7 @@ type OperationRecord struct {
 	Remark          string                      `json:"remark"`
 	Attachments     []OperationRecordAttachment `json:"attachments"`
 	Images          []string                    `json:"images"`
+	ActivityID      string                      `json:"activity_id,omitempty"` // Not sent by the legacy API
 }
 
 // Task represents a task in the approval flow
@@ -83,10 +102,69 @@ type UserInfoResponse struct {
 	ErrCode int    `json:"errcode"`
 	ErrMsg  string `json:"errmsg"`
 	Result  struct {
-		UserID string `json:"userid"`
-		Name   string `json:"name"`
-		Email  string `json:"email"`
-		Mobile string `json:"mobile"`
+		UserID     string  `json:"userid"`
+		UnionID    string  `json:"unionid"`
+		Name       string  `json:"name"`
+		Email      string  `json:"email"`
+		OrgEmail   string  `json:"org_email"`
+		Mobile     string  `json:"mobile"`
+		Title      string  `json:"title,omitempty"`
+		DeptIDList []int64 `json:"dept_id_list,omitempty"`
+	} `json:"result"`
+}
+
+// Department is a department from the contact API
+type Department struct {
+	DeptID   int64  `json:"dept_id"`
+	Name     string `json:"name"`
+	ParentID int64  `json:"parent_id"`
+}
+
+// DepartmentListResponse represents the response from the list sub-departments API
+type DepartmentListResponse struct {
+	ErrCode int          `json:"errcode"`
+	ErrMsg  string       `json:"errmsg"`
+	Result  []Department `json:"result"`
+}
+
+// DepartmentDetailResponse represents the response from the get department API
+type DepartmentDetailResponse struct {
+	ErrCode int        `json:"errcode"`
+	ErrMsg  string     `json:"errmsg"`
+	Result  Department `json:"result"`
+}
+
+// DepartmentUser is a user entry from the list department users API
+type DepartmentUser struct {
+	UserID     string  `json:"userid"`
+	Name       string  `json:"name"`
+	Title      string  `json:"title"`
+	Email      string  `json:"email"`
+	OrgEmail   string  `json:"org_email"`
+	DeptIDList []int64 `json:"dept_id_list"`
+	Active     bool    `json:"active"`
+}
+
+// DepartmentUserListResponse represents the response from the list department users API
+type DepartmentUserListResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+	Result  struct {
+		HasMore    bool             `json:"has_more"`
+		NextCursor int64            `json:"next_cursor"`
+		List       []DepartmentUser `json:"list"`
+	} `json:"result"`
+}
+
+// FileURLResponse represents the response from the instance file download url API
+type FileURLResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+	Success bool   `json:"success"`
+	Result  struct {
+		FileID      string `json:"file_id"`
+		SpaceID     int64  `json:"space_id"`
+		DownloadURI string `json:"download_uri"`
 	} `json:"result"`
 }
 
@@ -0,0 +1,121 @@
+package dingtalk
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertInstance(t *testing.T) {
+	data, err := os.ReadFile("testdata/workflow_instance.json")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var resp struct {
+		Result *workflowInstance `json:"result"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	w := NewWorkflowClient(nil, time.FixedZone("WIB", 7*60*60))
+	got := w.convertInstance(resp.Result)
+
+	want := &ProcessInstance{
+		Title:              "Budi submitted NCR",
+		Status:             "COMPLETED",
+		Result:             "agree",
+		BusinessID:         "202601050001",
+		OriginatorUserID:   "user-1",
+		OriginatorDeptID:   "1001",
+		OriginatorDeptName: "Produksi",
+		CreateTime:         "2026-01-05 11:40:00",
+		FinishTime:         "2026-01-06 08:00:00",
+		CCUserIDs:          []string{"user-9"},
+		FormComponentValues: []FormComponentValue{
+			{ID: "TextField-K2AD4O5B", Name: "NAMA PROJECT :", Value: "Gedung A", ComponentType: "TextField", BizAlias: "project"},
+			{
+				ID:            "DDMultiSelectField-LJ8A2",
+				Name:          "KATEGORI :",
+				Value:         `["Material","Proses"]`,
+				ExtValue:      `[{"key":"option_0","value":"Material"},{"key":"option_1","value":"Proses"}]`,
+				ComponentType: "DDMultiSelectField",
+			},
+		},
+		OperationRecords: []OperationRecord{
+			{UserID: "user-1", Date: "2026-01-05 11:40:00", OperationType: "START_PROCESS_INSTANCE", OperationResult: "NONE", ActivityID: "sid-start"},
+			{
+				UserID:          "user-2",
+				Date:            "2026-01-05 13:15:00",
+				OperationType:   "ADD_REMARK",
+				OperationResult: "NONE",
+				Remark:          "Mohon dicek",
+				ActivityID:      "act-qc",
+				Images:          []string{"https://static.dingtalk.com/media/foto.jpg"},
+				Attachments:     []OperationRecordAttachment{{FileID: "file-1", FileName: "laporan.pdf", FileSize: "2048", FileType: "pdf"}},
+			},
+			{UserID: "user-2", Date: "2026-01-06 08:00:00", OperationType: "EXECUTE_TASK_NORMAL", OperationResult: "AGREE", ActivityID: "act-qc"},
+		},
+		Tasks: []Task{
+			{
+				TaskID:     int64(80015),
+				UserID:     "user-2",
+				Status:     "COMPLETED",
+				Result:     "AGREE",
+				CreateTime: "2026-01-05 11:40:00",
+				FinishTime: "2026-01-06 08:00:00",
+				ActivityID: "act-qc",
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("convertInstance =\n%s\nwant\n%s", gotJSON, wantJSON)
+	}
+}
+
+func TestParseNextToken(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		want    int64
+		wantErr bool
+	}{
+		{raw: `20`, want: 20},
+		{raw: `"40"`, want: 40},
+		{raw: ` "60" `, want: 60},
+		{raw: ``, want: 0},
+		{raw: `null`, want: 0},
+		{raw: `""`, want: 0},
+		{raw: `"abc"`, wantErr: true},
+		{raw: `1.5`, wantErr: true},
+	} {
+		got, err := parseNextToken(json.RawMessage(tc.raw))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseNextToken(%s) error = %v, want error %v", tc.raw, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseNextToken(%s) = %d, want %d", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestLegacyTime(t *testing.T) {
+	w := NewWorkflowClient(nil, time.FixedZone("WIB", 7*60*60))
+	for _, tc := range []struct {
+		value, want string
+	}{
+		{"2026-01-05T04:40Z", "2026-01-05 11:40:00"},
+		{"2026-01-05T04:40:18Z", "2026-01-05 11:40:18"},
+		{"2026-01-05T20:40:18+00:00", "2026-01-06 03:40:18"}, // Crosses midnight in the organization's zone
+		{"", ""},
+		{"kemarin", "kemarin"}, // Unparseable values pass through
+	} {
+		if got := w.legacyTime(tc.value); got != tc.want {
+			t.Errorf("legacyTime(%q) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// volatilePayloadKeys change on every request and are dropped before hashing
+var volatilePayloadKeys = []string{"request_id"}
+
+// canonicalPayload normalizes a detail response for storage and change detection.
+// Keys are re-encoded in sorted order and volatile keys are removed.
+func canonicalPayload(detail *dingtalk.ApprovalDetailResponse) (json.RawMessage, string, error) {
+	raw := []byte(detail.Raw)
+	if len(raw) == 0 {
+		var err error
+		if raw, err = json.Marshal(detail); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("failed to decode payload: %w", err)
+	}
+	for _, key := range volatilePayloadKeys {
+		delete(doc, key)
+	}
+
+	canonical, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return canonical, hex.EncodeToString(sum[:]), nil
+}
+
+// instanceUserIDs lists every user referenced by an instance
+func instanceUserIDs(pi *dingtalk.ProcessInstance) []string {
+	ids := []string{pi.OriginatorUserID}
+	for _, op := range pi.OperationRecords {
+		ids = append(ids, op.UserID)
+	}
+	for _, task := range pi.Tasks {
+		ids = append(ids, task.UserID)
+	}
+	return ids
+}
+
+// archivePayload stores the detail response as a new version if it differs from the latest one
+func (s *Service) archivePayload(ctx context.Context, run *syncRun, instanceID string, detail *dingtalk.ApprovalDetailResponse) {
+	payload, hash, err := canonicalPayload(detail)
+	if err != nil {
+		s.logger.Error("Failed to encode payload for archive",
+			zap.String("instance_id", instanceID),
+			zap.Error(err))
+		return
+	}
+
+	latest, err := s.repo.GetLatestRawPayload(ctx, instanceID)
+	if err != nil {
+		s.logger.Error("Failed to load archived payload",
+			zap.String("instance_id", instanceID),
+			zap.Error(err))
+		return
+	}
+	if latest != nil && latest.PayloadHash == hash {
+		return
+	}
+
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	}
+
+	record := &RawPayload{
+		ProcessInstanceID: instanceID,
+		ProcessCode:       run.processCode,
+		Version:           version,
+		Payload:           payload,
+		PayloadHash:       hash,
+		UserNames:         JSONMap(run.users.Names(instanceUserIDs(detail.ProcessInstance)...)),
+	}
+	if err := s.repo.CreateRawPayload(ctx, record); err != nil {
+		s.logger.Error("Failed to archive payload",
+			zap.String("instance_id", instanceID),
+			zap.Error(err))
+	}
+}
+
+// reprojectBatchSize is how many archived payloads are loaded per page
+const reprojectBatchSize = 200
+
+// ReprojectArchive re-runs the mapping over the latest archived payload of every instance
+// (optionally limited to one process code) without calling the DingTalk API.
+// User names come from the names archived with each payload. It holds the sync lock of every
+// process code it rewrites, and returns ErrSyncInProgress if a sync of one of them is running.
+func (s *Service) ReprojectArchive(ctx context.Context, processCode string) (*SyncLog, error) {
+	syncID := uuid.New()
+
+	ctx, unlock, err := s.lockReprojection(ctx, processCode, syncID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	syncLog := &SyncLog{
+		ID:          syncID,
+		SyncType:    "reproject",
+		ProcessCode: processCode,
+		Source:      s.sourceName(processCode),
+		Status:      "started",
+	}
+	if err := s.repo.CreateSyncLog(ctx, syncLog); err != nil {
+		return nil, err
+	}
+
+	counters := newSyncCounters()
+	runs := make(map[string]*syncRun)
+	afterID := ""
+
+	for {
+		payloads, err := s.repo.ListLatestRawPayloads(ctx, processCode, afterID, reprojectBatchSize)
+		if err != nil {
+			return s.failSync(syncLog, counters, err)
+		}
+		if len(payloads) == 0 {
+			break
+		}
+
+		for _, payload := range payloads {
+			if ctx.Err() != nil {
+				return s.failSync(syncLog, counters, ctx.Err())
+			}
+			afterID = payload.ProcessInstanceID
+
+			var detail dingtalk.ApprovalDetailResponse
+			if err := json.Unmarshal(payload.Payload, &detail); err != nil || detail.ProcessInstance == nil {
+				s.logger.Warn("Skipping unreadable archived payload",
+					zap.String("instance_id", payload.ProcessInstanceID),
+					zap.Error(err))
+				counters.record(false, fmt.Errorf("unreadable payload"))
+				continue
+			}
+
+			run, ok := runs[payload.ProcessCode]
+			if !ok {
+				run = s.newSyncRun(ctx, payload.ProcessCode)
+				run.syncID = &syncLog.ID
+				run.live = false
+				runs[payload.ProcessCode] = run
+			}
+
+			counters.mu.Lock()
+			counters.processed++
+			counters.mu.Unlock()
+
+			isNew, err := s.projectInstance(ctx, run, dingtalk.StaticUserLookup(payload.UserNames), payload.ProcessInstanceID, detail.ProcessInstance)
+			counters.record(isNew, err)
+		}
+	}
+
+	// Instances that failed to project keep their previous row
+	now := time.Now()
+	syncLog.Status = PhaseCompleted
+	if counters.failures() > 0 {
+		syncLog.Status = PhasePartial
+	}
+	counters.apply(syncLog)
+	syncLog.CompletedAt = &now
+	s.repo.UpdateSyncLog(ctx, syncLog)
+
+	s.logger.Info("Re-projection completed",
+		zap.Int("processed", syncLog.RecordsProcessed),
+		zap.Int("created", syncLog.RecordsCreated),
+		zap.Int("updated", syncLog.RecordsUpdated),
+		zap.Int("failed", counters.failures()))
+
+	return syncLog, nil
+}
+
+// lockReprojection takes the sync lock of processCode, or of every archived process code if it is
+// empty, so a re-projection and a sync never rewrite the same NCRs at once. The returned context
+// is cancelled if any lock is lost, and unlock releases them all.
+func (s *Service) lockReprojection(ctx context.Context, processCode string, syncID uuid.UUID) (context.Context, func(), error) {
+	codes := []string{processCode}
+	if processCode == "" {
+		var err error
+		if codes, err = s.repo.ListRawPayloadProcessCodes(ctx); err != nil {
+			return ctx, nil, err
+		}
+	}
+
+	var unlocks []func()
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, code := range codes {
+		lockCtx, unlock, _, err := s.lockSync(ctx, code, syncID)
+		if err != nil {
+			unlockAll()
+			return ctx, nil, fmt.Errorf("process code %s: %w", code, err)
+		}
+		ctx = lockCtx
+		unlocks = append(unlocks, unlock)
+	}
+	return ctx, unlockAll, nil
+}
@@ -0,0 +1,81 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"dingtalk-dashboard/internal/dingtalk"
+)
+
+func TestReprojectArchive(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("RUNNING", "", "2026-01-05 11:40:18",
+		dingtalk.FormComponentValue{Name: "NAMA PROJECT :", Value: "Gedung A", ComponentType: "TextField"},
+	))
+	service, repo := newReplayService(t, replay)
+	ctx := context.Background()
+
+	if _, err := service.SyncApprovals(ctx, testProcessCode, "manual"); err != nil {
+		t.Fatalf("SyncApprovals: %v", err)
+	}
+
+	syncLog, err := service.ReprojectArchive(ctx, testProcessCode)
+	if err != nil {
+		t.Fatalf("ReprojectArchive: %v", err)
+	}
+	if syncLog.Status != PhaseCompleted || syncLog.RecordsUpdated != 1 {
+		t.Errorf("status = %q, updated = %d; want %q, 1", syncLog.Status, syncLog.RecordsUpdated, PhaseCompleted)
+	}
+
+	// An archived payload that can't be projected makes the run partial
+	if err := repo.CreateRawPayload(ctx, &RawPayload{
+		ProcessInstanceID: "inst-broken",
+		ProcessCode:       testProcessCode,
+		Version:           1,
+		Payload:           json.RawMessage(`{}`),
+		PayloadHash:       "broken",
+	}); err != nil {
+		t.Fatalf("CreateRawPayload: %v", err)
+	}
+	syncLog, err = service.ReprojectArchive(ctx, testProcessCode)
+	if err != nil {
+		t.Fatalf("ReprojectArchive: %v", err)
+	}
+	if syncLog.Status != PhasePartial || syncLog.RecordsFailed != 1 {
+		t.Errorf("status = %q, failed = %d; want %q, 1", syncLog.Status, syncLog.RecordsFailed, PhasePartial)
+	}
+
+	stored, err := repo.GetByProcessInstanceID(ctx, "inst-1")
+	if err != nil {
+		t.Fatalf("GetByProcessInstanceID: %v", err)
+	}
+	if stored.NamaProject != "Gedung A" {
+		t.Errorf("nama project = %q, want %q", stored.NamaProject, "Gedung A")
+	}
+}
+
+func TestReprojectArchiveKeepsTombstones(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("COMPLETED", "agree", "2026-01-05 11:40:18"))
+	service, repo := newReplayService(t, replay)
+	ctx := context.Background()
+
+	if _, err := service.SyncApprovals(ctx, testProcessCode, "manual"); err != nil {
+		t.Fatalf("SyncApprovals: %v", err)
+	}
+	if err := repo.TombstoneApproval(ctx, "inst-1", TombstoneNotFound); err != nil {
+		t.Fatalf("TombstoneApproval: %v", err)
+	}
+
+	if _, err := service.ReprojectArchive(ctx, testProcessCode); err != nil {
+		t.Fatalf("ReprojectArchive: %v", err)
+	}
+	stored, err := repo.GetByProcessInstanceID(ctx, "inst-1")
+	if err != nil {
+		t.Fatalf("GetByProcessInstanceID: %v", err)
+	}
+	if stored.TombstonedAt == nil || stored.TombstoneReason != TombstoneNotFound {
+		t.Errorf("tombstone = %v/%q after re-projection, want it kept", stored.TombstonedAt, stored.TombstoneReason)
+	}
+}
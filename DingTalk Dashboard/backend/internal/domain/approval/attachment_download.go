@@ -0,0 +1,192 @@
+package approval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/storage"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxDownloadAttempts is how often a failing attachment is retried before it is left alone
+	maxDownloadAttempts = 5
+	// downloadBatchSize is how many pending attachments are loaded per page
+	downloadBatchSize = 100
+	// maxAttachmentSize guards the store against runaway downloads
+	maxAttachmentSize = 200 << 20
+)
+
+// errNoFileSource is recorded for drive files when no DingTalk file source is configured
+var errNoFileSource = errors.New("no DingTalk file source configured")
+
+// DownloadResult summarizes one run of the attachment download job
+type DownloadResult struct {
+	Downloaded int `json:"downloaded"`
+	Failed     int `json:"failed"`
+}
+
+// AttachmentDownloader copies photos and drive files of NCRs into a content-addressed store,
+// so they stay available after the DingTalk links expire
+type AttachmentDownloader struct {
+	repo        *Repository
+	files       dingtalk.FileSource
+	sourceFiles map[string]dingtalk.FileSource // By source name, overriding files
+	store       storage.Store
+	httpClient  *http.Client
+	logger      *zap.Logger
+}
+
+// NewAttachmentDownloader creates a downloader. files may be nil (e.g. replay mode), in
+// which case only photos, which have direct URLs, are downloaded.
+func NewAttachmentDownloader(repo *Repository, files dingtalk.FileSource, store storage.Store, logger *zap.Logger) *AttachmentDownloader {
+	return &AttachmentDownloader{
+		repo:  repo,
+		files: files,
+		store: store,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Minute,
+		},
+		logger: logger,
+	}
+}
+
+// SetSourceFiles makes drive files of NCRs from the named source resolve through files, e.g.
+// when the source is read through its own DingTalk app. A nil files disables drive files of
+// the source.
+func (d *AttachmentDownloader) SetSourceFiles(source string, files dingtalk.FileSource) {
+	if d.sourceFiles == nil {
+		d.sourceFiles = make(map[string]dingtalk.FileSource)
+	}
+	d.sourceFiles[source] = files
+}
+
+// Run downloads every pending attachment once
+func (d *AttachmentDownloader) Run(ctx context.Context) (*DownloadResult, error) {
+	result := &DownloadResult{}
+	afterID := uuid.Nil
+
+	for {
+		pending, err := d.repo.ListPendingAttachments(ctx, afterID, maxDownloadAttempts, downloadBatchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		for _, attachment := range pending {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			afterID = attachment.ID
+
+			if err := d.download(ctx, attachment); err != nil {
+				result.Failed++
+				d.logger.Warn("Attachment download failed",
+					zap.String("attachment_id", attachment.ID.String()),
+					zap.String("instance_id", attachment.ProcessInstanceID),
+					zap.Error(err))
+				if markErr := d.repo.MarkAttachmentFailed(ctx, attachment.ID, err.Error()); markErr != nil {
+					return result, markErr
+				}
+				continue
+			}
+			result.Downloaded++
+		}
+	}
+
+	if result.Downloaded > 0 || result.Failed > 0 {
+		d.logger.Info("Attachment downloads finished",
+			zap.Int("downloaded", result.Downloaded),
+			zap.Int("failed", result.Failed))
+	}
+	return result, nil
+}
+
+// download fetches one attachment into the store and records its checksum and size
+func (d *AttachmentDownloader) download(ctx context.Context, attachment PendingAttachment) error {
+	sourceURL, err := d.sourceURL(ctx, attachment)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download returned HTTP %d", resp.StatusCode)
+	}
+
+	// Spool to a temp file to learn the hash (and so the key) before storing
+	tmp, err := os.CreateTemp("", "ncr-attachment-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(resp.Body, maxAttachmentSize+1))
+	if err != nil {
+		return err
+	}
+	if size > maxAttachmentSize {
+		return fmt.Errorf("attachment exceeds %d bytes", maxAttachmentSize)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	key := storage.ContentKey(checksum)
+	contentType := resp.Header.Get("Content-Type")
+
+	exists, err := d.store.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := d.store.Put(ctx, key, tmp, size, contentType); err != nil {
+			return fmt.Errorf("failed to store attachment: %w", err)
+		}
+	}
+
+	return d.repo.MarkAttachmentDownloaded(ctx, attachment.ID, checksum, key, contentType, size)
+}
+
+// sourceURL returns where to download an attachment from. Photos carry a direct URL;
+// drive files need a temporary link from DingTalk.
+func (d *AttachmentDownloader) sourceURL(ctx context.Context, attachment PendingAttachment) (string, error) {
+	if attachment.FileURL != "" {
+		return attachment.FileURL, nil
+	}
+	if attachment.FileID == "" {
+		return "", fmt.Errorf("attachment has neither url nor file id")
+	}
+	files, ok := d.sourceFiles[attachment.Source]
+	if !ok {
+		files = d.files
+	}
+	if files == nil {
+		return "", errNoFileSource
+	}
+	return files.GetAttachmentDownloadURL(ctx, attachment.ProcessInstanceID, attachment.FileID)
+}
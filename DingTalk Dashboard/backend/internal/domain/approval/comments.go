@@ -0,0 +1,93 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrApprovalNotFound is returned for an NCR ID that isn't stored
+	ErrApprovalNotFound = errors.New("approval not found")
+	// ErrCommentsUnavailable is returned when the NCR's source has no DingTalk comment writer
+	ErrCommentsUnavailable = errors.New("commenting on DingTalk is not available")
+)
+
+// CommentUpload is a file to attach to a comment
+type CommentUpload struct {
+	Name    string
+	Content []byte
+}
+
+// CommentResult is the outcome of posting a comment
+type CommentResult struct {
+	Approval     *NCRApproval `json:"approval"`
+	Refreshed    bool         `json:"refreshed"` // False if the instance could not be re-fetched; the next sync picks the comment up
+	RefreshError string       `json:"refresh_error,omitempty"`
+}
+
+// AddComment posts a comment, optionally with a file, to the NCR's DingTalk instance as the
+// given DingTalk user, through the app of the NCR's source, then refreshes the instance so the
+// comment shows up right away. The refresh takes the instance's lock like a callback, so it waits
+// for a sync writing the same NCR instead of racing it. A failed refresh doesn't fail the call,
+// since the comment was already posted.
+func (s *Service) AddComment(ctx context.Context, id uuid.UUID, userID, text string, upload *CommentUpload) (*CommentResult, error) {
+	approval, err := s.repo.GetApprovalWithDetails(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrApprovalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	processCode, err := s.processCodeOf(approval)
+	if err != nil {
+		return nil, err
+	}
+	writer := s.clientsFor(processCode).Comments
+	if writer == nil {
+		return nil, ErrCommentsUnavailable
+	}
+
+	comment := &dingtalk.Comment{
+		ProcessInstanceID: approval.ProcessInstanceID,
+		UserID:            userID,
+		Text:              text,
+	}
+	if upload != nil {
+		file, err := writer.UploadCommentFile(ctx, userID, upload.Name, upload.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %w", upload.Name, err)
+		}
+		comment.Files = append(comment.Files, *file)
+	}
+
+	if err := writer.AddComment(ctx, comment); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Comment posted to DingTalk",
+		zap.String("instance_id", approval.ProcessInstanceID),
+		zap.String("user_id", userID),
+		zap.Bool("with_file", upload != nil))
+
+	result := &CommentResult{Approval: approval}
+	if err := s.syncSingle(ctx, s.newSyncRun(ctx, processCode), approval.ProcessInstanceID); err != nil {
+		s.logger.Warn("Failed to refresh instance after comment",
+			zap.String("instance_id", approval.ProcessInstanceID),
+			zap.Error(err))
+		result.RefreshError = err.Error()
+		return result, nil
+	}
+
+	result.Refreshed = true
+	if refreshed, err := s.GetApproval(ctx, id); err == nil {
+		result.Approval = refreshed
+	}
+	return result, nil
+}
@@ -0,0 +1,178 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fakeCommentWriter records what is posted and passes comments on to a replay source so the
+// refresh after posting sees them
+type fakeCommentWriter struct {
+	replay *dingtalk.ReplaySource
+
+	mu        sync.Mutex
+	uploads   []CommentUpload
+	comments  []dingtalk.Comment
+	uploadErr error
+}
+
+var _ dingtalk.CommentWriter = (*fakeCommentWriter)(nil)
+
+func (f *fakeCommentWriter) UploadCommentFile(ctx context.Context, userID, fileName string, content []byte) (*dingtalk.CommentFile, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.uploadErr != nil {
+		return nil, f.uploadErr
+	}
+	f.uploads = append(f.uploads, CommentUpload{Name: fileName, Content: content})
+	return &dingtalk.CommentFile{SpaceID: "space-1", FileID: "file-1", FileName: fileName}, nil
+}
+
+func (f *fakeCommentWriter) AddComment(ctx context.Context, comment *dingtalk.Comment) error {
+	f.mu.Lock()
+	f.comments = append(f.comments, *comment)
+	f.mu.Unlock()
+	return f.replay.AddComment(ctx, comment)
+}
+
+func TestAddComment(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	user := &dingtalk.UserInfoResponse{}
+	user.Result.UserID = "user-1"
+	user.Result.Name = "Budi"
+	replay.AddUser("user-1", user)
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("RUNNING", "", "2026-01-05 11:40:18"))
+	replay.AddInstance("PROC-READONLY", "inst-2", newReplayInstance("RUNNING", "", "2026-01-05 12:00:00"))
+
+	repo := newTestRepository(t)
+	writer := &fakeCommentWriter{replay: replay}
+	service := NewService(repo, replay, 2, zap.NewNop())
+	service.AddSource(Source{Name: "ncr", ProcessCode: testProcessCode}, SourceClients{Approvals: replay, Comments: writer})
+	// A source whose app can't comment
+	service.AddSource(Source{Name: "readonly", ProcessCode: "PROC-READONLY"}, SourceClients{Approvals: replay})
+
+	ctx := context.Background()
+	for _, processCode := range []string{testProcessCode, "PROC-READONLY"} {
+		if _, err := service.SyncApprovals(ctx, processCode, "manual"); err != nil {
+			t.Fatalf("SyncApprovals %s: %v", processCode, err)
+		}
+	}
+	stored, err := repo.GetByProcessInstanceID(ctx, "inst-1")
+	if err != nil {
+		t.Fatalf("GetByProcessInstanceID: %v", err)
+	}
+
+	t.Run("with file", func(t *testing.T) {
+		upload := &CommentUpload{Name: "foto.jpg", Content: []byte("jpeg")}
+		result, err := service.AddComment(ctx, stored.ID, "user-1", "Sudah diperbaiki", upload)
+		if err != nil {
+			t.Fatalf("AddComment: %v", err)
+		}
+
+		if len(writer.uploads) != 1 || writer.uploads[0].Name != "foto.jpg" || string(writer.uploads[0].Content) != "jpeg" {
+			t.Errorf("uploads = %+v, want foto.jpg", writer.uploads)
+		}
+		if len(writer.comments) != 1 {
+			t.Fatalf("comments posted = %d, want 1", len(writer.comments))
+		}
+		posted := writer.comments[0]
+		if posted.ProcessInstanceID != "inst-1" || posted.UserID != "user-1" || posted.Text != "Sudah diperbaiki" {
+			t.Errorf("posted comment = %+v", posted)
+		}
+		if len(posted.Files) != 1 || posted.Files[0].FileID != "file-1" {
+			t.Errorf("posted files = %+v, want the uploaded file", posted.Files)
+		}
+
+		if !result.Refreshed {
+			t.Errorf("not refreshed: %s", result.RefreshError)
+		}
+		if !strings.Contains(result.Approval.RemarkComment, "Sudah diperbaiki") {
+			t.Errorf("remark comment = %q, want the new comment", result.Approval.RemarkComment)
+		}
+	})
+
+	t.Run("failed upload", func(t *testing.T) {
+		writer.uploadErr = errors.New("drive full")
+		defer func() { writer.uploadErr = nil }()
+
+		before := len(writer.comments)
+		_, err := service.AddComment(ctx, stored.ID, "user-1", "Lampiran", &CommentUpload{Name: "laporan.pdf"})
+		if err == nil || !strings.Contains(err.Error(), "drive full") {
+			t.Errorf("AddComment = %v, want the upload error", err)
+		}
+		if len(writer.comments) != before {
+			t.Error("comment posted although its file failed to upload")
+		}
+	})
+
+	t.Run("source without comment writer", func(t *testing.T) {
+		readonly, err := repo.GetByProcessInstanceID(ctx, "inst-2")
+		if err != nil {
+			t.Fatalf("GetByProcessInstanceID: %v", err)
+		}
+		before := len(writer.comments)
+		if _, err := service.AddComment(ctx, readonly.ID, "user-1", "Halo", nil); !errors.Is(err, ErrCommentsUnavailable) {
+			t.Errorf("AddComment = %v, want ErrCommentsUnavailable", err)
+		}
+		if len(writer.comments) != before {
+			t.Error("comment posted through another source's writer")
+		}
+	})
+
+	t.Run("unknown NCR", func(t *testing.T) {
+		if _, err := service.AddComment(ctx, uuid.New(), "user-1", "Halo", nil); !errors.Is(err, ErrApprovalNotFound) {
+			t.Errorf("AddComment = %v, want ErrApprovalNotFound", err)
+		}
+	})
+}
+
+func TestAddCommentRefreshWaitsForInstanceLock(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("RUNNING", "", "2026-01-05 11:40:18"))
+	service, repo := newLockingReplayService(t, replay)
+	ctx := context.Background()
+
+	if _, err := service.SyncApprovals(ctx, testProcessCode, "manual"); err != nil {
+		t.Fatalf("SyncApprovals: %v", err)
+	}
+	stored, err := repo.GetByProcessInstanceID(ctx, "inst-1")
+	if err != nil {
+		t.Fatalf("GetByProcessInstanceID: %v", err)
+	}
+
+	_, unlock, err := service.lockInstance(ctx, "inst-1")
+	if err != nil {
+		t.Fatalf("lockInstance: %v", err)
+	}
+	done := make(chan *CommentResult, 1)
+	go func() {
+		result, _ := service.AddComment(ctx, stored.ID, "user-1", "Sudah diperbaiki", nil)
+		done <- result
+	}()
+
+	select {
+	case <-done:
+		unlock()
+		t.Fatal("comment refresh finished while the instance was locked")
+	case <-time.After(time.Second):
+	}
+	unlock()
+
+	select {
+	case result := <-done:
+		if result == nil || !result.Refreshed || !strings.Contains(result.Approval.RemarkComment, "Sudah diperbaiki") {
+			t.Errorf("result = %+v, want the refreshed NCR with the comment", result)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("comment refresh still waiting after the lock was released")
+	}
+}
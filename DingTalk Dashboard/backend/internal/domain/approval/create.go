@@ -0,0 +1,276 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"go.uber.org/zap"
+)
+
+// formSchemaTTL is how long a fetched form schema is reused
+const formSchemaTTL = 10 * time.Minute
+
+// ErrCreateUnavailable is returned when the source has no DingTalk instance creator
+var ErrCreateUnavailable = errors.New("creating NCRs in DingTalk is not available")
+
+// FormValidationError lists the problems found in submitted NCR fields, keyed by column
+// (or by form label for required components no column maps to)
+type FormValidationError struct {
+	Fields map[string]string
+}
+
+func (e *FormValidationError) Error() string {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	problems := make([]string, 0, len(keys))
+	for _, key := range keys {
+		problems = append(problems, key+": "+e.Fields[key])
+	}
+	return "invalid NCR fields: " + strings.Join(problems, "; ")
+}
+
+// CreateResult is the outcome of creating an NCR in DingTalk
+type CreateResult struct {
+	ProcessInstanceID string       `json:"process_instance_id"`
+	Approval          *NCRApproval `json:"approval,omitempty"`
+	Synced            bool         `json:"synced"` // False if the new instance could not be fetched yet; it is queued for the next sync
+	SyncError         string       `json:"sync_error,omitempty"`
+}
+
+// cachedSchema is a form schema with the time it was fetched
+type cachedSchema struct {
+	schema    *dingtalk.FormSchema
+	fetchedAt time.Time
+}
+
+// GetFormSchema returns the process's form schema, cached for formSchemaTTL
+func (s *Service) GetFormSchema(ctx context.Context, processCode string) (*dingtalk.FormSchema, error) {
+	creator := s.clientsFor(processCode).Creator
+	if creator == nil {
+		return nil, ErrCreateUnavailable
+	}
+
+	s.schemaMu.Lock()
+	cached, ok := s.schemas[processCode]
+	s.schemaMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < formSchemaTTL {
+		return cached.schema, nil
+	}
+
+	schema, err := creator.GetFormSchema(ctx, processCode)
+	if err != nil {
+		return nil, err
+	}
+
+	s.schemaMu.Lock()
+	if s.schemas == nil {
+		s.schemas = make(map[string]cachedSchema)
+	}
+	s.schemas[processCode] = cachedSchema{schema: schema, fetchedAt: time.Now()}
+	s.schemaMu.Unlock()
+	return schema, nil
+}
+
+// CreateApproval validates NCR fields, keyed by ncr_approvals column, against the form schema
+// and creates the instance in DingTalk as the originator. The new instance is synced right away;
+// if that fails the instance still exists and is queued for the next sync.
+func (s *Service) CreateApproval(ctx context.Context, processCode, originatorUserID string, fields map[string][]string) (*CreateResult, error) {
+	schema, err := s.GetFormSchema(ctx, processCode)
+	if err != nil {
+		return nil, err
+	}
+
+	run := s.newSyncRun(ctx, processCode)
+	values, err := buildFormValues(schema, run.fields, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceID, err := s.clientsFor(processCode).Creator.CreateInstance(ctx, &dingtalk.CreateInstanceRequest{
+		ProcessCode:      processCode,
+		OriginatorUserID: originatorUserID,
+		DeptID:           s.originatorDept(ctx, originatorUserID),
+		Values:           values,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("NCR created in DingTalk",
+		zap.String("instance_id", instanceID),
+		zap.String("originator", originatorUserID))
+
+	// Stored through the same locked path as callbacks, since DingTalk may already be calling
+	// back about the new instance
+	result := &CreateResult{ProcessInstanceID: instanceID}
+	if err := s.syncSingle(ctx, run, instanceID); err != nil {
+		s.logger.Warn("Failed to sync created instance",
+			zap.String("instance_id", instanceID),
+			zap.Error(err))
+		result.SyncError = err.Error()
+		return result, nil
+	}
+
+	result.Synced = true
+	if stored, err := s.repo.GetByProcessInstanceID(ctx, instanceID); err == nil && stored != nil {
+		result.Approval = stored
+	}
+	return result, nil
+}
+
+// originatorDept picks the department an instance is started in: the user's first
+// department, or -1 (the root department) if it can't be resolved
+func (s *Service) originatorDept(ctx context.Context, userID string) int64 {
+	info, err := s.userLookup().GetUserInfo(ctx, userID)
+	if err != nil || len(info.Result.DeptIDList) == 0 || info.Result.DeptIDList[0] == 1 {
+		return -1
+	}
+	return info.Result.DeptIDList[0]
+}
+
+// buildFormValues converts submitted column values to form component values, checking them
+// against the schema: every column must map to a component on the form, select values must be
+// among the options, dates must parse and required components must have a value.
+func buildFormValues(schema *dingtalk.FormSchema, mapper *FieldMapper, fields map[string][]string) ([]dingtalk.FormValue, error) {
+	problems := make(map[string]string)
+	components := make(map[string]dingtalk.FormComponent)
+	mappings := make(map[string]FormFieldMapping)
+
+	for _, component := range schema.Components {
+		mapping, ok := mapper.Resolve(dingtalk.FormComponentValue{
+			ID:            component.ID,
+			Name:          component.Label,
+			BizAlias:      component.BizAlias,
+			ComponentType: component.ComponentType,
+		})
+		if ok && !nonDataComponents[component.ComponentType] {
+			components[mapping.ColumnName] = component
+			mappings[mapping.ColumnName] = mapping
+		}
+	}
+
+	var values []dingtalk.FormValue
+	provided := make(map[string]bool)
+	for column, raw := range fields {
+		component, ok := components[column]
+		if !ok {
+			if IsMappableColumn(column) {
+				problems[column] = "not on the form"
+			} else {
+				problems[column] = "unknown field"
+			}
+			continue
+		}
+
+		value, problem := formValue(component, mappings[column], raw)
+		if problem != "" {
+			problems[column] = problem
+			continue
+		}
+		if value != "" {
+			values = append(values, dingtalk.FormValue{Name: component.Label, Value: value})
+			provided[component.Label] = true
+		}
+	}
+
+	for _, component := range schema.Components {
+		if !component.Required || provided[component.Label] {
+			continue
+		}
+		key := component.Label
+		for column, mapped := range components {
+			if mapped.Label == component.Label {
+				key = column
+			}
+		}
+		if _, reported := problems[key]; !reported {
+			problems[key] = "required"
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &FormValidationError{Fields: problems}
+	}
+	return values, nil
+}
+
+// formValue converts one column's submitted values to the component's value format.
+// Returns a problem description if the values don't fit the component.
+func formValue(component dingtalk.FormComponent, mapping FormFieldMapping, raw []string) (string, string) {
+	var items []string
+	for _, value := range raw {
+		if value = strings.TrimSpace(value); value != "" {
+			items = append(items, value)
+		}
+	}
+	if len(items) == 0 {
+		return "", ""
+	}
+
+	multiSelect := component.ComponentType == "DDMultiSelectField"
+	if multiSelect && len(items) == 1 {
+		// Accept the comma-separated form multi-select columns are stored in
+		items = strings.Split(items[0], ",")
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+	}
+
+	switch {
+	case component.ComponentType == "DDDateField" || mapping.FieldType == FieldTypeDate:
+		if len(items) > 1 {
+			return "", "expects a single date"
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, items[0]); err == nil {
+				return t.Format("2006-01-02"), ""
+			}
+		}
+		return "", "invalid date, expected YYYY-MM-DD"
+
+	case multiSelect:
+		for _, item := range items {
+			if !isOption(component, item) {
+				return "", fmt.Sprintf("%q is not an option", item)
+			}
+		}
+		data, _ := json.Marshal(items)
+		return string(data), ""
+
+	case component.ComponentType == "DDSelectField":
+		if len(items) > 1 {
+			return "", "expects a single option"
+		}
+		if !isOption(component, items[0]) {
+			return "", fmt.Sprintf("%q is not an option", items[0])
+		}
+		return items[0], ""
+
+	default:
+		return strings.Join(items, ", "), ""
+	}
+}
+
+// isOption reports whether value is one of a select component's options. Components with
+// no known options accept any value.
+func isOption(component dingtalk.FormComponent, value string) bool {
+	if len(component.Options) == 0 {
+		return true
+	}
+	for _, option := range component.Options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
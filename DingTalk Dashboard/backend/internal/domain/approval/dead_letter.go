@@ -0,0 +1,133 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxAutoRetries is how many attempts a failed instance gets from scheduled and manual
+	// syncs. After that it stays queued until retried through the API.
+	maxAutoRetries = 5
+	// maxRetryBatch is how many queued instances one retry request handles
+	maxRetryBatch = 100
+)
+
+// RetryResult is the outcome of retrying one queued instance
+type RetryResult struct {
+	ProcessInstanceID string `json:"process_instance_id"`
+	Success           bool   `json:"success"`
+	Error             string `json:"error,omitempty"`
+}
+
+// recordOutcome puts an instance that failed to sync in the dead-letter queue, or takes it out
+// once it synced
+func (s *Service) recordOutcome(ctx context.Context, run *syncRun, instanceID string, err error) {
+	// Use a fresh context so outcomes are still recorded while a sync is being cancelled
+	recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		if !run.hadFailed(instanceID) {
+			return
+		}
+		if err := s.repo.DeleteSyncFailure(recordCtx, instanceID); err != nil {
+			s.logger.Error("Failed to clear sync failure", zap.String("instance_id", instanceID), zap.Error(err))
+		}
+		return
+	}
+
+	// A cancelled sync is not the instance's fault
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	failure := &SyncFailure{
+		ProcessInstanceID: instanceID,
+		ProcessCode:       run.processCode,
+		Source:            run.source,
+		ErrorMessage:      err.Error(),
+		Transient:         dingtalk.IsTransient(err) || errors.Is(err, context.DeadlineExceeded),
+		Attempts:          1,
+		LastSyncID:        run.syncID,
+		FirstFailedAt:     now,
+		LastAttemptAt:     now,
+	}
+	if err := s.repo.RecordSyncFailure(recordCtx, failure); err != nil {
+		s.logger.Error("Failed to record sync failure", zap.String("instance_id", instanceID), zap.Error(err))
+	}
+}
+
+// ListSyncFailures lists the instances in the dead-letter queue, optionally of one source only
+func (s *Service) ListSyncFailures(ctx context.Context, source string, page, pageSize int) ([]SyncFailure, int64, error) {
+	return s.repo.ListSyncFailures(ctx, source, page, pageSize)
+}
+
+// RetryFailures syncs queued instances again, regardless of their attempt count. With no IDs,
+// the oldest queued instances are retried. Each process code is retried under its sync lock;
+// ErrSyncInProgress is returned if a sync holds it.
+func (s *Service) RetryFailures(ctx context.Context, instanceIDs []string) ([]RetryResult, error) {
+	failures, err := s.repo.GetSyncFailures(ctx, instanceIDs, maxRetryBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	byProcessCode := make(map[string][]string)
+	var order []string
+	for _, failure := range failures {
+		if _, ok := byProcessCode[failure.ProcessCode]; !ok {
+			order = append(order, failure.ProcessCode)
+		}
+		byProcessCode[failure.ProcessCode] = append(byProcessCode[failure.ProcessCode], failure.ProcessInstanceID)
+	}
+
+	results := make([]RetryResult, 0, len(failures))
+	for _, processCode := range order {
+		codeResults, err := s.retryProcessCode(ctx, processCode, byProcessCode[processCode])
+		results = append(results, codeResults...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// retryProcessCode retries queued instances of one process code under its sync lock
+func (s *Service) retryProcessCode(ctx context.Context, processCode string, ids []string) ([]RetryResult, error) {
+	ctx, unlock, _, err := s.lockSync(ctx, processCode, uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	run := s.newSyncRun(ctx, processCode)
+	results := make([]RetryResult, 0, len(ids))
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		instanceCtx, cancel := context.WithTimeout(ctx, instanceTimeout)
+		_, err := s.syncInstance(instanceCtx, run, id)
+		cancel()
+		s.recordOutcome(ctx, run, id, err)
+
+		result := RetryResult{ProcessInstanceID: id, Success: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	s.logger.Info("Retried failed instances",
+		zap.String("process_code", processCode),
+		zap.Int("count", len(ids)))
+	return results, nil
+}
@@ -0,0 +1,168 @@
+package approval
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+)
+
+// Field types a form component value can be mapped as
+const (
+	FieldTypeText        = "text"
+	FieldTypeDate        = "date"
+	FieldTypeMultiSelect = "multiselect"
+)
+
+// FormFieldMapping maps a DingTalk form component to an ncr_approvals column.
+// Components are matched by ComponentID, then BizAlias, then normalized Label.
+type FormFieldMapping struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProcessCode string    `gorm:"size:100;not null;default:''" json:"process_code"` // Empty applies to every form
+	ColumnName  string    `gorm:"size:100;not null" json:"column_name"`
+	ComponentID string    `gorm:"size:200" json:"component_id"`
+	BizAlias    string    `gorm:"size:200" json:"biz_alias"`
+	Label       string    `gorm:"size:300" json:"label"`
+	FieldType   string    `gorm:"size:50;not null;default:'text'" json:"field_type"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (FormFieldMapping) TableName() string {
+	return "form_field_mappings"
+}
+
+// DefaultFieldMappings is used when no mappings are configured in form_field_mappings
+var DefaultFieldMappings = []FormFieldMapping{
+	{ColumnName: "tanggal", Label: "TANGGAL :", FieldType: FieldTypeDate},
+	{ColumnName: "ditujukan_kepada", Label: "DITUJUKAN KEPADA :", FieldType: FieldTypeMultiSelect},
+	{ColumnName: "dilaporkan_oleh", Label: "DILAPORKAN OLEH :", FieldType: FieldTypeMultiSelect},
+	{ColumnName: "kategori", Label: "KATEGORI :", FieldType: FieldTypeMultiSelect},
+	{ColumnName: "nama_project", Label: "NAMA PROJECT :", FieldType: FieldTypeText},
+	{ColumnName: "nomor_fppp", Label: "NOMOR FPPP :", FieldType: FieldTypeText},
+	{ColumnName: "nomor_production_order", Label: "NOMOR PRODUCTION ORDER :", FieldType: FieldTypeText},
+	{ColumnName: "nama_item_product", Label: "NAMA ITEM / PRODUCT :", FieldType: FieldTypeText},
+	{ColumnName: "deskripsi_masalah", Label: "DESKRIPSI MASALAH :", FieldType: FieldTypeText},
+	{ColumnName: "to_tidak_to", Label: "TO/TIDAK TO :", FieldType: FieldTypeText},
+	{ColumnName: "urgent_butuh_kapan", Label: "URGENT , BUTUH KAPAN :", FieldType: FieldTypeText},
+	{ColumnName: "catatan_tambahan", Label: "CATATAN TAMBAHAN :", FieldType: FieldTypeText},
+	{ColumnName: "detail_material_yang_dibutuhkan", Label: "DETAIL MATERIAL YANG DIBUTUHKAN :", FieldType: FieldTypeText},
+}
+
+// textColumns exposes the string columns a form field can be mapped to
+var textColumns = map[string]func(a *NCRApproval) *string{
+	"ditujukan_kepada":                func(a *NCRApproval) *string { return &a.DitujukanKepada },
+	"dilaporkan_oleh":                 func(a *NCRApproval) *string { return &a.DilaporkanOleh },
+	"kategori":                        func(a *NCRApproval) *string { return &a.Kategori },
+	"nama_project":                    func(a *NCRApproval) *string { return &a.NamaProject },
+	"nomor_fppp":                      func(a *NCRApproval) *string { return &a.NomorFPPP },
+	"nomor_production_order":          func(a *NCRApproval) *string { return &a.NomorProductionOrder },
+	"nama_item_product":               func(a *NCRApproval) *string { return &a.NamaItemProduct },
+	"deskripsi_masalah":               func(a *NCRApproval) *string { return &a.DeskripsiMasalah },
+	"to_tidak_to":                     func(a *NCRApproval) *string { return &a.ToTidakTo },
+	"urgent_butuh_kapan":              func(a *NCRApproval) *string { return &a.UrgentButuhKapan },
+	"catatan_tambahan":                func(a *NCRApproval) *string { return &a.CatatanTambahan },
+	"detail_material_yang_dibutuhkan": func(a *NCRApproval) *string { return &a.DetailMaterialYangDibutuhkan },
+}
+
+// dateColumns exposes the date columns a form field can be mapped to
+var dateColumns = map[string]func(a *NCRApproval) **time.Time{
+	"tanggal": func(a *NCRApproval) **time.Time { return &a.Tanggal },
+}
+
+// dateLayouts are the formats DDDateField values arrive in
+var dateLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05"}
+
+// IsMappableColumn reports whether a column can be the target of a field mapping
+func IsMappableColumn(column string) bool {
+	_, isText := textColumns[column]
+	_, isDate := dateColumns[column]
+	return isText || isDate
+}
+
+// normalizeLabel makes labels comparable despite case, doubled spaces or trailing colons
+// e.g. "NAMA  ITEM / PRODUCT :" and "Nama Item / Product" both become "NAMA ITEM / PRODUCT"
+func normalizeLabel(label string) string {
+	label = strings.Join(strings.Fields(strings.ToUpper(label)), " ")
+	return strings.TrimSpace(strings.TrimRight(label, ": "))
+}
+
+// FieldMapper resolves form component values to mapped columns
+type FieldMapper struct {
+	byID    map[string]FormFieldMapping
+	byAlias map[string]FormFieldMapping
+	byLabel map[string]FormFieldMapping
+}
+
+// NewFieldMapper indexes mappings for lookup. Mappings targeting unknown columns are ignored.
+func NewFieldMapper(mappings []FormFieldMapping) *FieldMapper {
+	m := &FieldMapper{
+		byID:    make(map[string]FormFieldMapping),
+		byAlias: make(map[string]FormFieldMapping),
+		byLabel: make(map[string]FormFieldMapping),
+	}
+	for _, mapping := range mappings {
+		if !IsMappableColumn(mapping.ColumnName) {
+			continue
+		}
+		if mapping.ComponentID != "" {
+			m.byID[mapping.ComponentID] = mapping
+		}
+		if mapping.BizAlias != "" {
+			m.byAlias[mapping.BizAlias] = mapping
+		}
+		if mapping.Label != "" {
+			m.byLabel[normalizeLabel(mapping.Label)] = mapping
+		}
+	}
+	return m
+}
+
+// Resolve finds the mapping for a form component value
+func (m *FieldMapper) Resolve(fv dingtalk.FormComponentValue) (FormFieldMapping, bool) {
+	if mapping, ok := m.byID[fv.ID]; ok && fv.ID != "" {
+		return mapping, true
+	}
+	if mapping, ok := m.byAlias[fv.BizAlias]; ok && fv.BizAlias != "" {
+		return mapping, true
+	}
+	mapping, ok := m.byLabel[normalizeLabel(fv.Name)]
+	return mapping, ok
+}
+
+// Apply writes a form component value into the mapped column, converting it by field type.
+// Returns false if the value could not be converted (e.g. an unparseable date).
+func (mapping FormFieldMapping) Apply(approval *NCRApproval, fv dingtalk.FormComponentValue) bool {
+	value := fv.Value
+
+	// Parse multi-select values (JSON arrays) to comma-separated string
+	if mapping.FieldType == FieldTypeMultiSelect || fv.ComponentType == "DDMultiSelectField" {
+		var values []string
+		if err := json.Unmarshal([]byte(value), &values); err == nil {
+			value = strings.Join(values, ", ")
+		}
+	}
+
+	if mapping.FieldType == FieldTypeDate {
+		field, ok := dateColumns[mapping.ColumnName]
+		if !ok {
+			return false
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+				*field(approval) = &t
+				return true
+			}
+		}
+		return false
+	}
+
+	field, ok := textColumns[mapping.ColumnName]
+	if !ok {
+		return false
+	}
+	*field(approval) = value
+	return true
+}
@@ -0,0 +1,59 @@
+package approval
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONMap is a string map stored in a JSONB column
+type JSONMap map[string]string
+
+// Value implements driver.Valuer
+func (m JSONMap) Value() (driver.Value, error) {
+	return jsonValue(m)
+}
+
+// Scan implements sql.Scanner
+func (m *JSONMap) Scan(src interface{}) error {
+	return jsonScan(src, m)
+}
+
+// StringList is a string slice stored in a JSONB column
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	return jsonValue(l)
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(src interface{}) error {
+	return jsonScan(src, l)
+}
+
+// jsonValue encodes v for a JSONB column, storing NULL for nil values
+func jsonValue(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	return string(data), nil
+}
+
+// jsonScan decodes a JSONB column into dst
+func jsonScan(src interface{}, dst interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dst)
+	case string:
+		return json.Unmarshal([]byte(v), dst)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", src)
+	}
+}
@@ -1,6 +1,8 @@
 package approval
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,6 +12,7 @@ import (
 type NCRApproval struct {
 	ID                uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	ProcessInstanceID string    `gorm:"uniqueIndex;size:100;not null" json:"process_instance_id"`
+	Source            string    `gorm:"size:100;not null;default:''" json:"source"` // Name of the configured source (form) the NCR came from
 	BusinessID        string    `gorm:"size:100" json:"business_id"`
 	Title             string    `gorm:"size:500" json:"title"`
 	Status            string    `gorm:"size:50;not null" json:"status"`
@@ -20,6 +23,7 @@ type NCRApproval struct {
 	OriginatorName     string `gorm:"size:200" json:"originator_name"`
 	OriginatorDeptID   string `gorm:"size:100" json:"originator_dept_id"`
 	OriginatorDeptName string `gorm:"size:200" json:"originator_dept_name"`
+	OriginatorDeptPath string `gorm:"column:originator_dept_path;type:text" json:"originator_dept_path"` // Parent departments from the user directory
 
 	// NCR Form specific fields
 	Tanggal                      *time.Time `gorm:"type:date" json:"tanggal"`
@@ -45,6 +49,17 @@ type NCRApproval struct {
 	// Formatted comments (all remarks combined)
 	RemarkComment string `gorm:"column:remark_comment;type:text" json:"remark_comment"`
 
+	// Set when workflow remarks could not be assigned to a stage reliably
+	NeedsReview  bool   `gorm:"column:needs_review" json:"needs_review"`
+	ReviewReason string `gorm:"column:review_reason;type:text" json:"review_reason,omitempty"`
+
+	// Form fields with no configured mapping, keyed by label
+	ExtraFields JSONMap `gorm:"column:extra_fields;type:jsonb" json:"extra_fields,omitempty"`
+
+	// Set by reconciliation when the instance no longer exists in DingTalk; cleared if it reappears
+	TombstonedAt    *time.Time `gorm:"column:tombstoned_at" json:"tombstoned_at,omitempty"`
+	TombstoneReason string     `gorm:"column:tombstone_reason;size:50" json:"tombstone_reason,omitempty"`
+
 	// Timestamps from DingTalk
 	DingTalkCreateTime *time.Time `gorm:"column:dingtalk_create_time" json:"dingtalk_create_time"`
 	DingTalkFinishTime *time.Time `gorm:"column:dingtalk_finish_time" json:"dingtalk_finish_time"`
@@ -56,6 +71,9 @@ type NCRApproval struct {
 
 	// Relations
 	Attachments []NCRAttachment `gorm:"foreignKey:NCRApprovalID" json:"attachments,omitempty"`
+
+	// Workflow operations with the attachments added to each; filled in for the detail view
+	WorkflowSteps []WorkflowStep `gorm:"-" json:"workflow_steps,omitempty"`
 }
 
 func (NCRApproval) TableName() string {
@@ -74,59 +92,287 @@ type NCRAttachment struct {
 	FileType       string    `gorm:"size:50" json:"file_type"`
 	SpaceID        string    `gorm:"size:100" json:"space_id"`
 	FileID         string    `gorm:"size:100" json:"file_id"`
-	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Set for attachments added to a workflow operation (operation_photo, operation_file)
+	OperationSeq *int   `json:"operation_seq,omitempty"` // Position in the instance's operation records
+	ActivityID   string `gorm:"size:200" json:"activity_id,omitempty"`
+
+	// Local copy, filled in by the attachment download job
+	Checksum         string     `gorm:"size:64" json:"checksum"` // SHA-256 of the content
+	StorageKey       string     `gorm:"size:200" json:"-"`       // Content-addressed key in the attachment store
+	ContentType      string     `gorm:"size:200" json:"content_type"`
+	DownloadedAt     *time.Time `json:"downloaded_at"`
+	DownloadAttempts int        `gorm:"default:0" json:"download_attempts"`
+	DownloadError    string     `gorm:"type:text" json:"download_error,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
 func (NCRAttachment) TableName() string {
 	return "ncr_attachments"
 }
 
+// NCROperationRecord is one operation (approval, remark, redirect, ...) on an NCR workflow
+type NCROperationRecord struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	NCRApprovalID   uuid.UUID  `gorm:"type:uuid;index" json:"ncr_approval_id"`
+	Seq             int        `json:"seq"` // Position in DingTalk's operation_records
+	UserID          string     `gorm:"size:100" json:"user_id"`
+	UserName        string     `gorm:"size:200" json:"user_name"`
+	OperationType   string     `gorm:"size:100" json:"operation_type"`
+	OperationResult string     `gorm:"size:50" json:"operation_result"`
+	Remark          string     `gorm:"type:text" json:"remark"`
+	ActivityID      string     `gorm:"size:200" json:"activity_id"` // Resolved from the matching task when possible
+	OperatedAt      *time.Time `json:"operated_at"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (NCROperationRecord) TableName() string {
+	return "ncr_operation_records"
+}
+
+// NCRTask is a workflow task assigned to a user on an NCR
+type NCRTask struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	NCRApprovalID uuid.UUID  `gorm:"type:uuid;index" json:"ncr_approval_id"`
+	TaskID        string     `gorm:"size:100" json:"task_id"`
+	UserID        string     `gorm:"size:100" json:"user_id"`
+	UserName      string     `gorm:"size:200" json:"user_name"`
+	Status        string     `gorm:"size:50" json:"status"`
+	Result        string     `gorm:"size:50" json:"result"`
+	ActivityID    string     `gorm:"size:200" json:"activity_id"`
+	AssignedAt    *time.Time `json:"assigned_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (NCRTask) TableName() string {
+	return "ncr_tasks"
+}
+
+// WorkflowStep is one workflow operation with the photos and files attached to it
+type WorkflowStep struct {
+	Seq             int             `json:"seq"`
+	OperationType   string          `json:"operation_type"`
+	OperationResult string          `json:"operation_result"`
+	UserID          string          `json:"user_id"`
+	UserName        string          `json:"user_name"`
+	ActivityID      string          `json:"activity_id,omitempty"`
+	StageName       string          `json:"stage_name,omitempty"` // From workflow_stage_mappings
+	Remark          string          `json:"remark"`
+	OperatedAt      *time.Time      `json:"operated_at"`
+	Attachments     []NCRAttachment `json:"attachments"`
+}
+
+// TimelineEvent is one entry of an NCR's chronological workflow timeline
+type TimelineEvent struct {
+	At             *time.Time `json:"at"`
+	Event          string     `json:"event"` // created, task_assigned, task_finished, operation, finished
+	UserID         string     `json:"user_id,omitempty"`
+	UserName       string     `json:"user_name,omitempty"`
+	OperationType  string     `json:"operation_type,omitempty"`
+	Result         string     `json:"result,omitempty"`
+	Remark         string     `json:"remark,omitempty"`
+	ActivityID     string     `json:"activity_id,omitempty"`
+	HeldForSeconds *int64     `json:"held_for_seconds,omitempty"` // How long the task sat with the user
+}
+
 // SyncLog represents a sync operation log entry
 type SyncLog struct {
 	ID               uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	SyncType         string     `gorm:"size:50;not null" json:"sync_type"`
+	ProcessCode      string     `gorm:"size:100" json:"process_code"`
+	Source           string     `gorm:"size:100;not null;default:''" json:"source"`
 	Status           string     `gorm:"size:50;not null" json:"status"`
 	RecordsProcessed int        `gorm:"default:0" json:"records_processed"`
 	RecordsCreated   int        `gorm:"default:0" json:"records_created"`
 	RecordsUpdated   int        `gorm:"default:0" json:"records_updated"`
+	RecordsSkipped   int        `gorm:"default:0" json:"records_skipped"`
+	RecordsFailed    int        `gorm:"default:0" json:"records_failed"`
+	APICalls         int        `gorm:"column:api_calls;default:0" json:"api_calls"`
+	DurationMs       int64      `gorm:"default:0" json:"duration_ms"`
+	Throughput       float64    `gorm:"default:0" json:"throughput"` // Instances processed per second
+	FormLabels       StringList `gorm:"type:jsonb" json:"form_labels,omitempty"`
+	FormDrift        *FormDrift `gorm:"type:jsonb" json:"form_drift,omitempty"`
 	ErrorMessage     string     `gorm:"type:text" json:"error_message,omitempty"`
 	StartedAt        time.Time  `gorm:"autoCreateTime" json:"started_at"`
 	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+
+	// Written while the sync runs, so replicas other than the one running it can follow it
+	Progress          *SyncProgress `gorm:"type:jsonb" json:"progress,omitempty"`
+	CancelRequestedAt *time.Time    `json:"cancel_requested_at,omitempty"`
 }
 
 func (SyncLog) TableName() string {
 	return "sync_logs"
 }
 
-// Field name mappings from DingTalk form to database columns
-var FieldNameMapping = map[string]string{
-	"TANGGAL :":                         "tanggal",
-	"DITUJUKAN KEPADA :":                "ditujukan_kepada",
-	"DILAPORKAN OLEH :":                 "dilaporkan_oleh",
-	"KATEGORI :":                        "kategori",
-	"NAMA PROJECT :":                    "nama_project",
-	"NOMOR FPPP : ":                     "nomor_fppp",
-	"NOMOR FPPP :":                      "nomor_fppp",
-	"NOMOR PRODUCTION ORDER :":          "nomor_production_order",
-	"NAMA  ITEM / PRODUCT :":            "nama_item_product",
-	"NAMA ITEM / PRODUCT :":             "nama_item_product",
-	"DESKRIPSI MASALAH :":               "deskripsi_masalah",
-	"TO/TIDAK TO :":                     "to_tidak_to",
-	"URGENT , BUTUH KAPAN : ":           "urgent_butuh_kapan",
-	"URGENT , BUTUH KAPAN :":            "urgent_butuh_kapan",
-	"CATATAN TAMBAHAN : ":               "catatan_tambahan",
-	"CATATAN TAMBAHAN :":                "catatan_tambahan",
-	"DETAIL MATERIAL YANG DIBUTUHKAN :": "detail_material_yang_dibutuhkan",
-	"ANALISA PENYEBAB MASALAH :":        "analisis_penyebab_masalah",
-	"NAMA YANG MELAKUKAN KESALAHAN :":   "nama_yang_melakukan_masalah",
-	"TINDAKAN PERBAIKAN :":              "tindakan_perbaikan",
-	"TINDAKAN PENCEGAHAN :":             "tindakan_pencegahan",
-}
-
-// Workflow stage mappings (showName from operation records)
-var WorkflowStageMapping = map[string]string{
-	"ANALISA PENYEBAB MASALAH :":      "analisis_penyebab_masalah",
-	"NAMA YANG MELAKUKAN KESALAHAN :": "nama_yang_melakukan_masalah",
-	"TINDAKAN PERBAIKAN :":            "tindakan_perbaikan",
-	"TINDAKAN PENCEGAHAN :":           "tindakan_pencegahan",
+// Value implements driver.Valuer
+func (p SyncProgress) Value() (driver.Value, error) {
+	return jsonValue(p)
+}
+
+// Scan implements sql.Scanner
+func (p *SyncProgress) Scan(src interface{}) error {
+	return jsonScan(src, p)
+}
+
+// FormDrift records how the form labels seen in a sync differ from the previous sync
+type FormDrift struct {
+	Appeared    []string `json:"appeared,omitempty"`
+	Disappeared []string `json:"disappeared,omitempty"`
+	Unmapped    []string `json:"unmapped,omitempty"`
+}
+
+// Value implements driver.Valuer
+func (d FormDrift) Value() (driver.Value, error) {
+	return jsonValue(d)
+}
+
+// Scan implements sql.Scanner
+func (d *FormDrift) Scan(src interface{}) error {
+	return jsonScan(src, d)
+}
+
+// HasChanges reports whether labels appeared or disappeared
+func (d *FormDrift) HasChanges() bool {
+	return d != nil && (len(d.Appeared) > 0 || len(d.Disappeared) > 0)
+}
+
+// UnmappedField is an unmapped form label with how often it occurs
+type UnmappedField struct {
+	Label      string     `json:"label"`
+	Count      int64      `json:"count"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+}
+
+// RawPayload is an archived DingTalk instance detail response. A new version is stored
+// whenever the payload changes, so mapping fixes can be re-applied without re-downloading.
+type RawPayload struct {
+	ID                uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProcessInstanceID string          `gorm:"size:100;not null" json:"process_instance_id"`
+	ProcessCode       string          `gorm:"size:100" json:"process_code"`
+	Version           int             `gorm:"not null" json:"version"`
+	Payload           json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	PayloadHash       string          `gorm:"size:64;not null" json:"payload_hash"`
+	UserNames         JSONMap         `gorm:"type:jsonb" json:"user_names,omitempty"` // Names resolved when fetched
+	FetchedAt         time.Time       `gorm:"autoCreateTime" json:"fetched_at"`
+}
+
+func (RawPayload) TableName() string {
+	return "ncr_raw_payloads"
+}
+
+// SyncState stores the incremental sync high-water mark per DingTalk process code
+type SyncState struct {
+	ProcessCode   string     `gorm:"primary_key;size:100" json:"process_code"`
+	HighWaterMark time.Time  `json:"high_water_mark"`
+	LastSyncID    *uuid.UUID `gorm:"type:uuid" json:"last_sync_id,omitempty"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (SyncState) TableName() string {
+	return "sync_state"
+}
+
+// SyncFailure is an instance that failed to sync, kept in a dead-letter queue until it syncs
+type SyncFailure struct {
+	ProcessInstanceID string     `gorm:"primaryKey;size:100" json:"process_instance_id"`
+	ProcessCode       string     `gorm:"size:100" json:"process_code"`
+	Source            string     `gorm:"size:100;not null;default:''" json:"source"`
+	ErrorMessage      string     `gorm:"type:text" json:"error_message"`
+	Transient         bool       `json:"transient"` // Throttling, network or timeout rather than a permanent error
+	Attempts          int        `gorm:"default:1" json:"attempts"`
+	LastSyncID        *uuid.UUID `gorm:"type:uuid" json:"last_sync_id,omitempty"`
+	FirstFailedAt     time.Time  `json:"first_failed_at"`
+	LastAttemptAt     time.Time  `json:"last_attempt_at"`
+}
+
+func (SyncFailure) TableName() string {
+	return "sync_failures"
+}
+
+// ReconciliationReport records one comparison of DingTalk's instance list against stored NCRs
+type ReconciliationReport struct {
+	ID            uuid.UUID           `gorm:"type:uuid;primary_key" json:"id"`
+	ProcessCode   string              `gorm:"size:100" json:"process_code"`
+	Source        string              `gorm:"size:100;not null;default:''" json:"source"`
+	WindowStart   time.Time           `json:"window_start"`
+	WindowEnd     time.Time           `json:"window_end"`
+	Status        string              `gorm:"size:50;not null" json:"status"` // running, completed, failed
+	Listed        int                 `json:"listed"`                         // Instance IDs DingTalk lists for the window
+	Stored        int                 `json:"stored"`                         // Stored NCRs created in the window
+	Rechecked     int                 `json:"rechecked"`                      // Instances fetched again to verify them
+	Added         int                 `json:"added"`
+	Tombstoned    int                 `json:"tombstoned"`
+	Restored      int                 `json:"restored"`
+	Unlisted      int                 `json:"unlisted"`
+	StatusChanged int                 `json:"status_changed"`
+	Errors        int                 `json:"errors"`
+	Items         ReconciliationItems `gorm:"type:jsonb" json:"items,omitempty"`
+	ErrorMessage  string              `gorm:"type:text" json:"error_message,omitempty"`
+	DurationMs    int64               `json:"duration_ms"`
+	StartedAt     time.Time           `json:"started_at"`
+	CompletedAt   *time.Time          `json:"completed_at,omitempty"`
+}
+
+func (ReconciliationReport) TableName() string {
+	return "reconciliation_reports"
+}
+
+// ReconciliationItem is one discrepancy found by reconciliation and what was done about it
+type ReconciliationItem struct {
+	ProcessInstanceID string `json:"process_instance_id"`
+	BusinessID        string `json:"business_id,omitempty"`
+	Action            string `json:"action"`
+	PreviousStatus    string `json:"previous_status,omitempty"`
+	Status            string `json:"status,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// ReconciliationItems is the list of discrepancies stored with a report
+type ReconciliationItems []ReconciliationItem
+
+// Value implements driver.Valuer
+func (l ReconciliationItems) Value() (driver.Value, error) {
+	return jsonValue(l)
+}
+
+// Scan implements sql.Scanner
+func (l *ReconciliationItems) Scan(src interface{}) error {
+	return jsonScan(src, l)
+}
+
+// ApprovalRevision records the fields a sync changed on an NCR
+type ApprovalRevision struct {
+	ID                uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	NCRApprovalID     uuid.UUID    `gorm:"type:uuid;index" json:"ncr_approval_id"`
+	ProcessInstanceID string       `gorm:"size:100" json:"process_instance_id"`
+	SyncID            *uuid.UUID   `gorm:"type:uuid;index" json:"sync_id,omitempty"` // Empty for callbacks and single-instance refreshes
+	Changes           FieldChanges `gorm:"type:jsonb" json:"changes"`
+	ChangedAt         time.Time    `json:"changed_at"`
+}
+
+func (ApprovalRevision) TableName() string {
+	return "ncr_approval_revisions"
+}
+
+// FieldChange is one field's value before and after a sync
+type FieldChange struct {
+	Field string `json:"field"` // JSON name of the NCRApproval field
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// FieldChanges is the list of field changes stored with a revision
+type FieldChanges []FieldChange
+
+// Value implements driver.Valuer
+func (l FieldChanges) Value() (driver.Value, error) {
+	return jsonValue(l)
+}
+
+// Scan implements sql.Scanner
+func (l *FieldChanges) Scan(src interface{}) error {
+	return jsonScan(src, l)
 }
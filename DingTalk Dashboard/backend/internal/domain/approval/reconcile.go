@@ -0,0 +1,226 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Reconciliation item actions
+const (
+	ReconcileAdded         = "added"          // Listed by DingTalk but not stored; synced
+	ReconcileTombstoned    = "tombstoned"     // Stored but gone from DingTalk
+	ReconcileRestored      = "restored"       // Tombstoned earlier but exists again; synced
+	ReconcileUnlisted      = "unlisted"       // Not listed but still fetchable; refreshed
+	ReconcileStatusChanged = "status_changed" // Re-checked instance changed status since it was stored
+	ReconcileError         = "error"          // Could not be verified; left as is
+)
+
+// TombstoneNotFound is the tombstone reason for instances DingTalk reports as not found
+const TombstoneNotFound = "not_found"
+
+// recheckStatuses are final statuses that are fetched again during reconciliation.
+// Revoking or cancelling an instance after it was stored doesn't bring it back into the sync.
+var recheckStatuses = map[string]bool{
+	"TERMINATED": true,
+	"CANCELED":   true,
+}
+
+// Reconcile compares the instance IDs DingTalk lists for [start, end) with the stored NCRs
+// created in that range. Listed instances that aren't stored are synced. Stored ones that
+// aren't listed are fetched: if DingTalk no longer has them they are tombstoned, never deleted.
+// Terminated/canceled and tombstoned instances are re-checked as well. Everything found is
+// written to a reconciliation report. Holds the sync lock, so it won't overlap a sync.
+func (s *Service) Reconcile(ctx context.Context, processCode string, start, end time.Time) (*ReconciliationReport, error) {
+	reportID := uuid.New()
+
+	ctx, unlock, _, err := s.lockSync(ctx, processCode, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	report := &ReconciliationReport{
+		ID:          reportID,
+		ProcessCode: processCode,
+		Source:      s.sourceName(processCode),
+		WindowStart: start,
+		WindowEnd:   end,
+		Status:      "running",
+		StartedAt:   time.Now(),
+	}
+	if err := s.repo.CreateReconciliationReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool)
+	for _, window := range dingtalk.SplitTimeRange(start, end, dingtalk.MaxListIDsRange) {
+		ids, err := s.listInstanceIDs(ctx, processCode, window)
+		if err != nil {
+			return s.failReconcile(report, err)
+		}
+		for _, id := range ids {
+			listed[id] = true
+		}
+	}
+
+	// Only the process code's own NCRs: other sources' instances are unknown to its client
+	run := s.newSyncRun(ctx, processCode)
+	stored, err := s.repo.ListInstancesCreatedBetween(ctx, run.source, start, end)
+	if err != nil {
+		return s.failReconcile(report, err)
+	}
+	report.Listed = len(listed)
+	report.Stored = len(stored)
+
+	storedIDs := make(map[string]bool, len(stored))
+	for _, row := range stored {
+		storedIDs[row.ProcessInstanceID] = true
+		if !listed[row.ProcessInstanceID] || row.TombstonedAt != nil || recheckStatuses[row.Status] {
+			s.recheckInstance(ctx, run, report, row, listed[row.ProcessInstanceID])
+		}
+		if ctx.Err() != nil {
+			return s.failReconcile(report, ctx.Err())
+		}
+	}
+
+	for id := range listed {
+		if storedIDs[id] {
+			continue
+		}
+		item := ReconciliationItem{ProcessInstanceID: id, Action: ReconcileAdded}
+		instanceCtx, cancel := context.WithTimeout(ctx, instanceTimeout)
+		_, err := s.syncInstance(instanceCtx, run, id)
+		cancel()
+		if err != nil {
+			item.Action = ReconcileError
+			item.Error = err.Error()
+		} else {
+			item.Status = s.storedStatus(ctx, id)
+		}
+		report.addItem(item)
+		if ctx.Err() != nil {
+			return s.failReconcile(report, ctx.Err())
+		}
+	}
+
+	now := time.Now()
+	report.Status = "completed"
+	report.CompletedAt = &now
+	report.DurationMs = now.Sub(report.StartedAt).Milliseconds()
+	if err := s.repo.UpdateReconciliationReport(ctx, report); err != nil {
+		return report, err
+	}
+
+	s.logger.Info("Reconciliation completed",
+		zap.String("process_code", processCode),
+		zap.Int("listed", report.Listed),
+		zap.Int("stored", report.Stored),
+		zap.Int("added", report.Added),
+		zap.Int("tombstoned", report.Tombstoned),
+		zap.Int("restored", report.Restored),
+		zap.Int("status_changed", report.StatusChanged),
+		zap.Int("errors", report.Errors))
+
+	return report, nil
+}
+
+// recheckInstance fetches a stored instance again and records what changed
+func (s *Service) recheckInstance(ctx context.Context, run *syncRun, report *ReconciliationReport, row StoredInstance, isListed bool) {
+	report.Rechecked++
+	item := ReconciliationItem{
+		ProcessInstanceID: row.ProcessInstanceID,
+		BusinessID:        row.BusinessID,
+		PreviousStatus:    row.Status,
+	}
+
+	instanceCtx, cancel := context.WithTimeout(ctx, instanceTimeout)
+	_, err := s.syncInstance(instanceCtx, run, row.ProcessInstanceID)
+	cancel()
+
+	switch {
+	case errors.Is(err, dingtalk.ErrNotFound):
+		if row.TombstonedAt != nil {
+			return // Still gone; already reported when it was tombstoned
+		}
+		if err := s.repo.TombstoneApproval(ctx, row.ProcessInstanceID, TombstoneNotFound); err != nil {
+			item.Action = ReconcileError
+			item.Error = err.Error()
+			break
+		}
+		item.Action = ReconcileTombstoned
+		item.Error = err.Error()
+	case err != nil:
+		item.Action = ReconcileError
+		item.Error = err.Error()
+	default:
+		// The upsert cleared any tombstone
+		item.Status = s.storedStatus(ctx, row.ProcessInstanceID)
+		switch {
+		case row.TombstonedAt != nil:
+			item.Action = ReconcileRestored
+		case !isListed:
+			item.Action = ReconcileUnlisted
+		case item.Status != row.Status:
+			item.Action = ReconcileStatusChanged
+		default:
+			return // Verified, nothing to report
+		}
+	}
+	report.addItem(item)
+}
+
+// storedStatus returns the stored status of an instance, or "" if it can't be read
+func (s *Service) storedStatus(ctx context.Context, instanceID string) string {
+	statuses, err := s.repo.GetStatusesByInstanceIDs(ctx, []string{instanceID})
+	if err != nil {
+		return ""
+	}
+	return statuses[instanceID]
+}
+
+// addItem appends a discrepancy and counts it
+func (r *ReconciliationReport) addItem(item ReconciliationItem) {
+	r.Items = append(r.Items, item)
+	switch item.Action {
+	case ReconcileAdded:
+		r.Added++
+	case ReconcileTombstoned:
+		r.Tombstoned++
+	case ReconcileRestored:
+		r.Restored++
+	case ReconcileUnlisted:
+		r.Unlisted++
+	case ReconcileStatusChanged:
+		r.StatusChanged++
+	case ReconcileError:
+		r.Errors++
+	}
+}
+
+// failReconcile marks a reconciliation report as failed and returns the error
+func (s *Service) failReconcile(report *ReconciliationReport, err error) (*ReconciliationReport, error) {
+	now := time.Now()
+	report.Status = "failed"
+	report.ErrorMessage = err.Error()
+	report.CompletedAt = &now
+	report.DurationMs = now.Sub(report.StartedAt).Milliseconds()
+	// Use a fresh context so cancellation still gets recorded
+	s.repo.UpdateReconciliationReport(context.Background(), report)
+	return report, err
+}
+
+// ListReconciliationReports lists reconciliation reports, newest first, optionally of one source only
+func (s *Service) ListReconciliationReports(ctx context.Context, source string, page, pageSize int) ([]ReconciliationReport, int64, error) {
+	return s.repo.ListReconciliationReports(ctx, source, page, pageSize)
+}
+
+// GetReconciliationReport returns a reconciliation report with its items; nil if not found
+func (s *Service) GetReconciliationReport(ctx context.Context, id uuid.UUID) (*ReconciliationReport, error) {
+	return s.repo.GetReconciliationReport(ctx, id)
+}
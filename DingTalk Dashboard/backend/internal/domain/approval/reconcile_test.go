@@ -0,0 +1,69 @@
+package approval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+)
+
+func TestReconcileTombstonesAndRestores(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	instance := newReplayInstance("COMPLETED", "agree", "2026-01-05 11:40:18")
+	replay.AddInstance(testProcessCode, "inst-1", instance)
+	replay.AddInstance(testProcessCode, "inst-2", newReplayInstance("RUNNING", "", "2026-01-06 08:00:00"))
+	service, repo := newReplayService(t, replay)
+	ctx := context.Background()
+
+	if _, err := service.SyncApprovals(ctx, testProcessCode, "manual"); err != nil {
+		t.Fatalf("SyncApprovals: %v", err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	// reconcile runs a reconciliation and returns its report and inst-1 as stored after it
+	reconcile := func(step string) (*ReconciliationReport, *NCRApproval) {
+		t.Helper()
+		report, err := service.Reconcile(ctx, testProcessCode, start, end)
+		if err != nil {
+			t.Fatalf("%s: Reconcile: %v", step, err)
+		}
+		if report.Status != "completed" || report.Errors != 0 {
+			t.Fatalf("%s: status = %q, errors = %d (%+v); want completed without errors", step, report.Status, report.Errors, report.Items)
+		}
+		stored, err := repo.GetByProcessInstanceID(ctx, "inst-1")
+		if err != nil || stored == nil {
+			t.Fatalf("%s: GetByProcessInstanceID = %v, %v; want the NCR kept", step, stored, err)
+		}
+		return report, stored
+	}
+
+	replay.RemoveInstance("inst-1")
+	report, stored := reconcile("gone")
+	if report.Tombstoned != 1 || len(report.Items) != 1 || report.Items[0].ProcessInstanceID != "inst-1" || report.Items[0].Action != ReconcileTombstoned {
+		t.Errorf("gone: tombstoned = %d, items = %+v; want inst-1 tombstoned", report.Tombstoned, report.Items)
+	}
+	if stored.TombstonedAt == nil || stored.TombstoneReason != TombstoneNotFound {
+		t.Errorf("gone: tombstone = %v/%q, want %q", stored.TombstonedAt, stored.TombstoneReason, TombstoneNotFound)
+	}
+	tombstonedAt := *stored.TombstonedAt
+
+	// Already reported, so a reconciliation that finds it still gone reports nothing
+	report, stored = reconcile("still gone")
+	if report.Tombstoned != 0 || len(report.Items) != 0 {
+		t.Errorf("still gone: tombstoned = %d, items = %+v; want nothing reported", report.Tombstoned, report.Items)
+	}
+	if stored.TombstonedAt == nil || !stored.TombstonedAt.Equal(tombstonedAt) {
+		t.Errorf("still gone: tombstoned at %v, want it kept at %v", stored.TombstonedAt, tombstonedAt)
+	}
+
+	replay.AddInstance(testProcessCode, "inst-1", instance)
+	report, stored = reconcile("back")
+	if report.Restored != 1 || len(report.Items) != 1 || report.Items[0].Action != ReconcileRestored || report.Items[0].Status != "COMPLETED" {
+		t.Errorf("back: restored = %d, items = %+v; want inst-1 restored as COMPLETED", report.Restored, report.Items)
+	}
+	if stored.TombstonedAt != nil || stored.TombstoneReason != "" {
+		t.Errorf("back: tombstone = %v/%q, want it cleared", stored.TombstonedAt, stored.TombstoneReason)
+	}
+}
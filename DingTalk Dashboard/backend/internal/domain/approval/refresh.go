@@ -0,0 +1,171 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// MaxRefreshBatch is how many instances one refresh request may name
+const MaxRefreshBatch = 100
+
+// ErrTooManyInstances is returned for refresh requests naming more than MaxRefreshBatch instances
+var ErrTooManyInstances = fmt.Errorf("at most %d instances can be refreshed at once", MaxRefreshBatch)
+
+// RefreshResult is the outcome of re-fetching one instance
+type RefreshResult struct {
+	Ref               string       `json:"ref"` // Process instance ID or business ID as requested
+	ProcessInstanceID string       `json:"process_instance_id,omitempty"`
+	Success           bool         `json:"success"`
+	Created           bool         `json:"created"`            // The instance wasn't stored before
+	Changes           FieldChanges `json:"changes,omitempty"`  // Fields the refresh changed
+	Approval          *NCRApproval `json:"approval,omitempty"` // Only for single-NCR refreshes
+	Error             string       `json:"error,omitempty"`
+}
+
+// RefreshApproval re-fetches a stored NCR from DingTalk through its source and reports what changed
+func (s *Service) RefreshApproval(ctx context.Context, id uuid.UUID) (*RefreshResult, error) {
+	approval, err := s.repo.GetApprovalWithDetails(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrApprovalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	processCode, err := s.processCodeOf(approval)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.RefreshInstances(ctx, processCode, []string{approval.ProcessInstanceID})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &results[0]
+	if result.Success {
+		if refreshed, err := s.GetApproval(ctx, id); err == nil {
+			result.Approval = refreshed
+		}
+	}
+	return result, nil
+}
+
+// RefreshInstances re-fetches the named instances through the same mapping as a full sync and
+// reports each one's before/after diff. Refs are process instance IDs or business IDs; business
+// IDs must already be stored under the process code's source, since DingTalk can't look instances
+// up by them. Unstored instance IDs are fetched as new instances. Instances stored under another
+// source are not refreshed, since that would re-map them with this source's form.
+func (s *Service) RefreshInstances(ctx context.Context, processCode string, refs []string) ([]RefreshResult, error) {
+	refs = uniqueRefs(refs)
+	if len(refs) > MaxRefreshBatch {
+		return nil, ErrTooManyInstances
+	}
+	if len(refs) == 0 {
+		return []RefreshResult{}, nil
+	}
+
+	run := s.newSyncRun(ctx, processCode)
+	resolved, err := s.repo.ResolveInstanceRefs(ctx, run.source, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RefreshResult, 0, len(refs))
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		stored, ok := resolved[ref]
+		if !ok {
+			if isBusinessID(ref) {
+				results = append(results, RefreshResult{Ref: ref, Error: "no stored NCR of this source has this business ID"})
+				continue
+			}
+			stored.ProcessInstanceID = ref
+		} else if stored.Source != run.source {
+			results = append(results, RefreshResult{
+				Ref:               ref,
+				ProcessInstanceID: stored.ProcessInstanceID,
+				Error:             fmt.Sprintf("instance belongs to source %q; refresh it through that source", stored.Source),
+			})
+			continue
+		}
+		results = append(results, s.refreshInstance(ctx, run, ref, stored.ProcessInstanceID))
+	}
+
+	s.logger.Info("Refreshed instances",
+		zap.String("process_code", processCode),
+		zap.Int("count", len(results)))
+	return results, nil
+}
+
+// refreshInstance syncs one instance and diffs the stored row before and after. Both reads happen
+// under the instance's lock, so the diff only holds changes made by this refresh.
+func (s *Service) refreshInstance(ctx context.Context, run *syncRun, ref, instanceID string) RefreshResult {
+	result := RefreshResult{Ref: ref, ProcessInstanceID: instanceID}
+
+	instanceCtx, cancel := context.WithTimeout(ctx, instanceTimeout)
+	defer cancel()
+	lockCtx, unlock, err := s.lockInstance(instanceCtx, instanceID)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer unlock()
+
+	before, _ := s.repo.GetByProcessInstanceID(ctx, instanceID)
+
+	_, err = s.syncInstanceLocked(lockCtx, run, instanceID)
+	s.recordOutcome(ctx, run, instanceID, err)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	after, err := s.repo.GetByProcessInstanceID(ctx, instanceID)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Created = before == nil
+	if before != nil {
+		result.Changes = diffApprovals(before, after)
+	}
+	return result
+}
+
+// uniqueRefs trims refs and drops empty and repeated ones, keeping their order
+func uniqueRefs(refs []string) []string {
+	seen := make(map[string]bool, len(refs))
+	unique := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if ref == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		unique = append(unique, ref)
+	}
+	return unique
+}
+
+// isBusinessID reports whether ref looks like a business ID (all digits) rather than a
+// process instance ID
+func isBusinessID(ref string) bool {
+	for _, r := range ref {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return ref != ""
+}
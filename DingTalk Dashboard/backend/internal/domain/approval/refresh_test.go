@@ -0,0 +1,99 @@
+package approval
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+)
+
+func TestRefreshInstancesStaysWithinSource(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	// Business IDs are numbered per form, so both sources have an NCR 202601050001
+	ncr := newReplayInstance("RUNNING", "", "2026-01-05 11:40:18")
+	ncr.ProcessInstance.BusinessID = "202601050001"
+	replay.AddInstance(testProcessCode, "inst-ncr", ncr)
+	audit := newReplayInstance("RUNNING", "", "2026-01-05 12:00:00")
+	audit.ProcessInstance.BusinessID = "202601050001"
+	replay.AddInstance("PROC-AUDIT", "inst-audit", audit)
+
+	service, _ := newReplayService(t, replay)
+	service.AddSource(Source{Name: "audit", ProcessCode: "PROC-AUDIT"}, SourceClients{Approvals: replay})
+	ctx := context.Background()
+	for _, processCode := range []string{testProcessCode, "PROC-AUDIT"} {
+		if _, err := service.SyncApprovals(ctx, processCode, "manual"); err != nil {
+			t.Fatalf("SyncApprovals %s: %v", processCode, err)
+		}
+	}
+
+	results, err := service.RefreshInstances(ctx, "PROC-AUDIT", []string{"202601050001", "inst-ncr"})
+	if err != nil {
+		t.Fatalf("RefreshInstances: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %d, want 2", len(results))
+	}
+
+	byBusinessID := results[0]
+	if !byBusinessID.Success || byBusinessID.ProcessInstanceID != "inst-audit" {
+		t.Errorf("business ID resolved to %q (success %v, error %q), want inst-audit",
+			byBusinessID.ProcessInstanceID, byBusinessID.Success, byBusinessID.Error)
+	}
+
+	otherSource := results[1]
+	if otherSource.Success || !strings.Contains(otherSource.Error, `"ncr"`) {
+		t.Errorf("instance of another source: success %v, error %q; want an error naming source ncr",
+			otherSource.Success, otherSource.Error)
+	}
+}
+
+func TestRefreshInstancesDiffsOnlyItsOwnChanges(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("RUNNING", "", "2026-01-05 11:40:18"))
+	service, _ := newLockingReplayService(t, replay)
+	ctx := context.Background()
+
+	if _, err := service.SyncApprovals(ctx, testProcessCode, "manual"); err != nil {
+		t.Fatalf("SyncApprovals: %v", err)
+	}
+
+	// A sync holds the instance and stores its completion while the refresh is requested
+	lockCtx, unlock, err := service.lockInstance(ctx, "inst-1")
+	if err != nil {
+		t.Fatalf("lockInstance: %v", err)
+	}
+	done := make(chan []RefreshResult, 1)
+	go func() {
+		results, _ := service.RefreshInstances(ctx, testProcessCode, []string{"inst-1"})
+		done <- results
+	}()
+
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("COMPLETED", "agree", "2026-01-05 11:40:18"))
+	if _, err := service.syncInstanceLocked(lockCtx, service.newSyncRun(ctx, testProcessCode), "inst-1"); err != nil {
+		unlock()
+		t.Fatalf("syncInstanceLocked: %v", err)
+	}
+	completed := newReplayInstance("COMPLETED", "agree", "2026-01-05 11:40:18")
+	completed.ProcessInstance.Title = "NCR renamed"
+	replay.AddInstance(testProcessCode, "inst-1", completed)
+	unlock()
+
+	var results []RefreshResult
+	select {
+	case results = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("RefreshInstances still waiting after the lock was released")
+	}
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("results = %+v, want one success", results)
+	}
+	fields := make(map[string]bool)
+	for _, change := range results[0].Changes {
+		fields[change.Field] = true
+	}
+	if !fields["title"] || fields["status"] {
+		t.Errorf("changed fields = %v, want title but not the sync's status change", fields)
+	}
+}
@@ -138,6 +138,128 @@ func (r *Repository) CreateAttachments(ctx context.Context, attachments []NCRAtt
 	return r.db.WithContext(ctx).Create(&attachments).Error
 }
 
+// ListAttachments lists the attachments of an approval
+func (r *Repository) ListAttachments(ctx context.Context, approvalID uuid.UUID) ([]NCRAttachment, error) {
+	var attachments []NCRAttachment
+	err := r.db.WithContext(ctx).
+		Where("ncr_approval_id = ?", approvalID).
+		Find(&attachments).Error
+	return attachments, err
+}
+
+// ReplaceAttachments replaces all attachments of an approval in one transaction
+func (r *Repository) ReplaceAttachments(ctx context.Context, approvalID uuid.UUID, attachments []NCRAttachment) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ncr_approval_id = ?", approvalID).Delete(&NCRAttachment{}).Error; err != nil {
+			return err
+		}
+		if len(attachments) == 0 {
+			return nil
+		}
+		return tx.Create(&attachments).Error
+	})
+}
+
+// GetAttachment gets an attachment by ID
+func (r *Repository) GetAttachment(ctx context.Context, id uuid.UUID) (*NCRAttachment, error) {
+	var attachment NCRAttachment
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&attachment).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// PendingAttachment is an attachment not yet downloaded, with the instance it belongs to
+type PendingAttachment struct {
+	NCRAttachment     `gorm:"embedded"`
+	ProcessInstanceID string
+	Source            string
+}
+
+// ListPendingAttachments lists attachments without a local copy that have been tried fewer
+// than maxAttempts times, ordered by ID after afterID
+func (r *Repository) ListPendingAttachments(ctx context.Context, afterID uuid.UUID, maxAttempts, limit int) ([]PendingAttachment, error) {
+	var pending []PendingAttachment
+	err := r.db.WithContext(ctx).
+		Table("ncr_attachments").
+		Select("ncr_attachments.*, ncr_approvals.process_instance_id, ncr_approvals.source").
+		Joins("JOIN ncr_approvals ON ncr_approvals.id = ncr_attachments.ncr_approval_id").
+		Where("ncr_attachments.downloaded_at IS NULL").
+		Where("COALESCE(ncr_attachments.download_attempts, 0) < ?", maxAttempts).
+		Where("ncr_attachments.id > ?", afterID).
+		Order("ncr_attachments.id ASC").
+		Limit(limit).
+		Scan(&pending).Error
+	return pending, err
+}
+
+// MarkAttachmentDownloaded records the stored copy of an attachment
+func (r *Repository) MarkAttachmentDownloaded(ctx context.Context, id uuid.UUID, checksum, storageKey, contentType string, size int64) error {
+	return r.db.WithContext(ctx).Model(&NCRAttachment{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"checksum":          checksum,
+			"storage_key":       storageKey,
+			"content_type":      contentType,
+			"file_size":         size,
+			"downloaded_at":     time.Now(),
+			"download_attempts": gorm.Expr("COALESCE(download_attempts, 0) + 1"),
+			"download_error":    "",
+		}).Error
+}
+
+// MarkAttachmentFailed records a failed download attempt
+func (r *Repository) MarkAttachmentFailed(ctx context.Context, id uuid.UUID, downloadErr string) error {
+	return r.db.WithContext(ctx).Model(&NCRAttachment{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"download_attempts": gorm.Expr("COALESCE(download_attempts, 0) + 1"),
+			"download_error":    downloadErr,
+		}).Error
+}
+
+// ReplaceWorkflow replaces the operation records and tasks stored for an approval
+func (r *Repository) ReplaceWorkflow(ctx context.Context, approvalID uuid.UUID, records []NCROperationRecord, tasks []NCRTask) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ncr_approval_id = ?", approvalID).Delete(&NCROperationRecord{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("ncr_approval_id = ?", approvalID).Delete(&NCRTask{}).Error; err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			if err := tx.Create(&records).Error; err != nil {
+				return err
+			}
+		}
+		if len(tasks) > 0 {
+			if err := tx.Create(&tasks).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetWorkflow gets the operation records and tasks of an approval
+func (r *Repository) GetWorkflow(ctx context.Context, approvalID uuid.UUID) ([]NCROperationRecord, []NCRTask, error) {
+	var records []NCROperationRecord
+	var tasks []NCRTask
+	if err := r.db.WithContext(ctx).
+		Where("ncr_approval_id = ?", approvalID).
+		Order("seq ASC").
+		Find(&records).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := r.db.WithContext(ctx).
+		Where("ncr_approval_id = ?", approvalID).
+		Order("assigned_at ASC").
+		Find(&tasks).Error; err != nil {
+		return nil, nil, err
+	}
+	return records, tasks, nil
+}
+
 // GetByProcessInstanceID finds an approval by process instance ID
 func (r *Repository) GetByProcessInstanceID(ctx context.Context, processInstanceID string) (*NCRApproval, error) {
 	var approval NCRApproval
@@ -148,6 +270,42 @@ func (r *Repository) GetByProcessInstanceID(ctx context.Context, processInstance
 	return &approval, nil
 }
 
+// InstanceRef is the stored instance a refresh ref resolved to
+type InstanceRef struct {
+	ProcessInstanceID string
+	Source            string
+}
+
+// ResolveInstanceRefs maps each ref that is a stored process instance ID, or a business ID of
+// the source, to its instance. Business IDs are only unique within a source; instance IDs
+// resolve whatever their source. Refs matching nothing are left out.
+func (r *Repository) ResolveInstanceRefs(ctx context.Context, source string, refs []string) (map[string]InstanceRef, error) {
+	var rows []struct {
+		ProcessInstanceID string
+		BusinessID        string
+		Source            string
+	}
+	err := r.db.WithContext(ctx).Model(&NCRApproval{}).
+		Select("process_instance_id, business_id, source").
+		Where("process_instance_id IN ? OR (business_id IN ? AND source = ?)", refs, refs, source).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(map[string]InstanceRef, len(rows))
+	for _, row := range rows {
+		ref := InstanceRef{ProcessInstanceID: row.ProcessInstanceID, Source: row.Source}
+		resolved[row.ProcessInstanceID] = ref
+		if row.BusinessID != "" && row.Source == source {
+			if _, ok := resolved[row.BusinessID]; !ok {
+				resolved[row.BusinessID] = ref
+			}
+		}
+	}
+	return resolved, nil
+}
+
 // HasAnyData checks if there is any approval data in the database
 func (r *Repository) HasAnyData(ctx context.Context) (bool, error) {
 	var count int64
@@ -158,10 +316,377 @@ func (r *Repository) HasAnyData(ctx context.Context) (bool, error) {
 	return count > 0, nil
 }
 
+// GetLatestCreateTime returns the newest DingTalk create time stored locally for a source
+func (r *Repository) GetLatestCreateTime(ctx context.Context, source string) (*time.Time, error) {
+	var latest *time.Time
+	err := r.db.WithContext(ctx).Model(&NCRApproval{}).
+		Select("MAX(dingtalk_create_time)").
+		Where("source = ?", source).
+		Scan(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// GetStatusesByInstanceIDs returns the stored status for each known process instance ID
+func (r *Repository) GetStatusesByInstanceIDs(ctx context.Context, processInstanceIDs []string) (map[string]string, error) {
+	statuses := make(map[string]string, len(processInstanceIDs))
+	if len(processInstanceIDs) == 0 {
+		return statuses, nil
+	}
+
+	var rows []struct {
+		ProcessInstanceID string
+		Status            string
+	}
+	err := r.db.WithContext(ctx).Model(&NCRApproval{}).
+		Select("process_instance_id, status").
+		Where("process_instance_id IN ?", processInstanceIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		statuses[row.ProcessInstanceID] = row.Status
+	}
+	return statuses, nil
+}
+
+// ListRunningInstanceIDs lists a source's process instance IDs whose last synced status is
+// RUNNING, leaving out tombstoned ones
+func (r *Repository) ListRunningInstanceIDs(ctx context.Context, source string) ([]string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Model(&NCRApproval{}).
+		Where("source = ? AND status = ? AND tombstoned_at IS NULL", source, "RUNNING").
+		Order("dingtalk_create_time ASC").
+		Pluck("process_instance_id", &ids).Error
+	return ids, err
+}
+
+// RecordSyncFailure adds an instance to the dead-letter queue, or counts another failed attempt
+func (r *Repository) RecordSyncFailure(ctx context.Context, failure *SyncFailure) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "process_instance_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"process_code":    failure.ProcessCode,
+			"source":          failure.Source,
+			"error_message":   failure.ErrorMessage,
+			"transient":       failure.Transient,
+			"attempts":        gorm.Expr("sync_failures.attempts + 1"),
+			"last_sync_id":    failure.LastSyncID,
+			"last_attempt_at": failure.LastAttemptAt,
+		}),
+	}).Create(failure).Error
+}
+
+// DeleteSyncFailure removes an instance from the dead-letter queue
+func (r *Repository) DeleteSyncFailure(ctx context.Context, processInstanceID string) error {
+	return r.db.WithContext(ctx).
+		Where("process_instance_id = ?", processInstanceID).
+		Delete(&SyncFailure{}).Error
+}
+
+// ListSyncFailureIDs lists the instance IDs in the dead-letter queue for a process code
+func (r *Repository) ListSyncFailureIDs(ctx context.Context, processCode string) ([]string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Model(&SyncFailure{}).
+		Where("process_code = ?", processCode).
+		Pluck("process_instance_id", &ids).Error
+	return ids, err
+}
+
+// ListRetryableFailureIDs lists queued instance IDs with fewer than maxAttempts attempts, oldest attempt first
+func (r *Repository) ListRetryableFailureIDs(ctx context.Context, processCode string, maxAttempts int) ([]string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Model(&SyncFailure{}).
+		Where("process_code = ? AND attempts < ?", processCode, maxAttempts).
+		Order("last_attempt_at ASC").
+		Pluck("process_instance_id", &ids).Error
+	return ids, err
+}
+
+// ListSyncFailures lists the dead-letter queue, most recent attempt first, optionally of one source only
+func (r *Repository) ListSyncFailures(ctx context.Context, source string, page, pageSize int) ([]SyncFailure, int64, error) {
+	var failures []SyncFailure
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&SyncFailure{})
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("last_attempt_at DESC").Offset(offset).Limit(pageSize).Find(&failures).Error
+	return failures, total, err
+}
+
+// GetSyncFailures loads queued failures; all of them (up to limit, oldest attempt first) if no IDs are given
+func (r *Repository) GetSyncFailures(ctx context.Context, processInstanceIDs []string, limit int) ([]SyncFailure, error) {
+	var failures []SyncFailure
+	query := r.db.WithContext(ctx).Model(&SyncFailure{})
+	if len(processInstanceIDs) > 0 {
+		query = query.Where("process_instance_id IN ?", processInstanceIDs)
+	}
+	err := query.Order("last_attempt_at ASC").Limit(limit).Find(&failures).Error
+	return failures, err
+}
+
+// StoredInstance is the part of a stored NCR reconciliation compares
+type StoredInstance struct {
+	ProcessInstanceID string
+	BusinessID        string
+	Status            string
+	TombstonedAt      *time.Time
+}
+
+// ListInstancesCreatedBetween lists a source's stored instances created in DingTalk within [start, end)
+func (r *Repository) ListInstancesCreatedBetween(ctx context.Context, source string, start, end time.Time) ([]StoredInstance, error) {
+	var rows []StoredInstance
+	err := r.db.WithContext(ctx).Model(&NCRApproval{}).
+		Select("process_instance_id, business_id, status, tombstoned_at").
+		Where("source = ? AND dingtalk_create_time >= ? AND dingtalk_create_time < ?", source, start, end).
+		Order("dingtalk_create_time ASC").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// TombstoneApproval marks an instance as gone from DingTalk
+func (r *Repository) TombstoneApproval(ctx context.Context, processInstanceID, reason string) error {
+	return r.db.WithContext(ctx).Model(&NCRApproval{}).
+		Where("process_instance_id = ?", processInstanceID).
+		Updates(map[string]interface{}{
+			"tombstoned_at":    time.Now(),
+			"tombstone_reason": reason,
+		}).Error
+}
+
+// CreateReconciliationReport creates a reconciliation report
+func (r *Repository) CreateReconciliationReport(ctx context.Context, report *ReconciliationReport) error {
+	return r.db.WithContext(ctx).Create(report).Error
+}
+
+// UpdateReconciliationReport saves a reconciliation report
+func (r *Repository) UpdateReconciliationReport(ctx context.Context, report *ReconciliationReport) error {
+	return r.db.WithContext(ctx).Save(report).Error
+}
+
+// ListReconciliationReports lists reconciliation reports, newest first, without their items,
+// optionally of one source only
+func (r *Repository) ListReconciliationReports(ctx context.Context, source string, page, pageSize int) ([]ReconciliationReport, int64, error) {
+	var reports []ReconciliationReport
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&ReconciliationReport{})
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Omit("items").Order("started_at DESC").Offset(offset).Limit(pageSize).Find(&reports).Error
+	return reports, total, err
+}
+
+// GetReconciliationReport gets a reconciliation report by ID; nil if not found
+func (r *Repository) GetReconciliationReport(ctx context.Context, id uuid.UUID) (*ReconciliationReport, error) {
+	var report ReconciliationReport
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&report).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// GetSyncState gets the sync watermark for a process code (nil if never synced)
+func (r *Repository) GetSyncState(ctx context.Context, processCode string) (*SyncState, error) {
+	var state SyncState
+	err := r.db.WithContext(ctx).Where("process_code = ?", processCode).First(&state).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SaveSyncState creates or updates the sync watermark for a process code
+func (r *Repository) SaveSyncState(ctx context.Context, state *SyncState) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "process_code"}},
+		UpdateAll: true,
+	}).Create(state).Error
+}
+
+// ListFieldMappings lists form field mappings for a process code, including global ones
+func (r *Repository) ListFieldMappings(ctx context.Context, processCode string) ([]FormFieldMapping, error) {
+	var mappings []FormFieldMapping
+	err := r.db.WithContext(ctx).
+		Where("process_code IN ?", []string{"", processCode}).
+		Order("process_code ASC, created_at ASC").
+		Find(&mappings).Error
+	return mappings, err
+}
+
+// ListStageMappings lists workflow stage mappings for a process code, including global ones
+func (r *Repository) ListStageMappings(ctx context.Context, processCode string) ([]WorkflowStageMapping, error) {
+	var mappings []WorkflowStageMapping
+	err := r.db.WithContext(ctx).
+		Where("process_code IN ?", []string{"", processCode}).
+		Order("process_code ASC, created_at ASC").
+		Find(&mappings).Error
+	return mappings, err
+}
+
+// ApplyDirectory copies names and departments from dt_users/dt_departments onto stored
+// NCRs and workflow rows. Returns the number of rows changed.
+func (r *Repository) ApplyDirectory(ctx context.Context) (int64, error) {
+	statements := []string{
+		`UPDATE ncr_approvals a SET originator_name = u.name
+		 FROM dt_users u
+		 WHERE u.user_id = a.originator_user_id AND u.name <> '' AND a.originator_name IS DISTINCT FROM u.name`,
+		`UPDATE ncr_approvals a SET originator_dept_name = d.name, originator_dept_path = d.path
+		 FROM dt_departments d
+		 WHERE a.originator_dept_id ~ '^[0-9]+$' AND d.dept_id = a.originator_dept_id::BIGINT
+		   AND (a.originator_dept_name IS DISTINCT FROM d.name OR a.originator_dept_path IS DISTINCT FROM d.path)`,
+		`UPDATE ncr_operation_records o SET user_name = u.name
+		 FROM dt_users u
+		 WHERE u.user_id = o.user_id AND u.name <> '' AND o.user_name IS DISTINCT FROM u.name`,
+		`UPDATE ncr_tasks t SET user_name = u.name
+		 FROM dt_users u
+		 WHERE u.user_id = t.user_id AND u.name <> '' AND t.user_name IS DISTINCT FROM u.name`,
+	}
+
+	var total int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			result := tx.Exec(statement)
+			if result.Error != nil {
+				return result.Error
+			}
+			total += result.RowsAffected
+		}
+		return nil
+	})
+	return total, err
+}
+
+// GetStageNames returns the configured stage name of each given workflow activity
+func (r *Repository) GetStageNames(ctx context.Context, activityIDs []string) (map[string]string, error) {
+	names := make(map[string]string)
+	if len(activityIDs) == 0 {
+		return names, nil
+	}
+
+	var mappings []WorkflowStageMapping
+	if err := r.db.WithContext(ctx).
+		Where("activity_id IN ?", activityIDs).
+		Order("process_code DESC").
+		Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	for _, mapping := range mappings {
+		// Process-specific names sort first and win over global ones
+		if _, ok := names[mapping.ActivityID]; !ok && mapping.StageName != "" {
+			names[mapping.ActivityID] = mapping.StageName
+		}
+	}
+	return names, nil
+}
+
+// GetLastFormLabels returns the form labels recorded by the most recent sync of a process code
+func (r *Repository) GetLastFormLabels(ctx context.Context, processCode string) ([]string, error) {
+	var log SyncLog
+	err := r.db.WithContext(ctx).
+		Where("process_code = ? AND form_labels IS NOT NULL", processCode).
+		Order("started_at DESC").
+		First(&log).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return log.FormLabels, nil
+}
+
+// ListUnmappedFields counts how many approvals carry each unmapped form label, optionally of
+// one source's NCRs only
+func (r *Repository) ListUnmappedFields(ctx context.Context, source string) ([]UnmappedField, error) {
+	var fields []UnmappedField
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT key AS label, COUNT(*) AS count, MAX(last_synced_at) AS last_seen_at
+		FROM ncr_approvals, jsonb_object_keys(extra_fields) AS key
+		WHERE extra_fields IS NOT NULL AND (? = '' OR source = ?)
+		GROUP BY key
+		ORDER BY count DESC, label ASC`, source, source).
+		Scan(&fields).Error
+	return fields, err
+}
+
+// GetLatestRawPayload gets the newest archived payload version for an instance (nil if none)
+func (r *Repository) GetLatestRawPayload(ctx context.Context, processInstanceID string) (*RawPayload, error) {
+	var payload RawPayload
+	err := r.db.WithContext(ctx).
+		Where("process_instance_id = ?", processInstanceID).
+		Order("version DESC").
+		First(&payload).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// CreateRawPayload archives a payload version; a concurrent insert of the same version is ignored
+func (r *Repository) CreateRawPayload(ctx context.Context, payload *RawPayload) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(payload).Error
+}
+
+// ListLatestRawPayloads pages through the newest payload of each instance, ordered by
+// process instance ID. Pass the last ID of the previous page as afterID.
+func (r *Repository) ListLatestRawPayloads(ctx context.Context, processCode string, afterID string, limit int) ([]RawPayload, error) {
+	var payloads []RawPayload
+	query := r.db.WithContext(ctx).
+		Select("DISTINCT ON (process_instance_id) *").
+		Where("process_instance_id > ?", afterID)
+	if processCode != "" {
+		query = query.Where("process_code = ?", processCode)
+	}
+	err := query.
+		Order("process_instance_id ASC, version DESC").
+		Limit(limit).
+		Find(&payloads).Error
+	return payloads, err
+}
+
+// ListRawPayloadProcessCodes lists the process codes with archived payloads
+func (r *Repository) ListRawPayloadProcessCodes(ctx context.Context) ([]string, error) {
+	var codes []string
+	err := r.db.WithContext(ctx).Model(&RawPayload{}).
+		Distinct("process_code").
+		Where("process_code IS NOT NULL AND process_code <> ''").
+		Order("process_code").
+		Pluck("process_code", &codes).Error
+	return codes, err
+}
+
 // ListParams contains parameters for listing approvals
 type ListParams struct {
 	Page            int
 	PageSize        int
+	Source          string
 	Status          string
 	Search          string
 	BusinessID      string
@@ -170,6 +695,8 @@ type ListParams struct {
 	DilaporkanOleh  string
 	Kategori        string
 	ToTidakTo       string
+	NeedsReview     *bool
+	Tombstoned      bool // List only NCRs removed from DingTalk instead of leaving them out
 	StartDate       *time.Time
 	EndDate         *time.Time
 }
@@ -181,6 +708,14 @@ func (r *Repository) ListApprovals(ctx context.Context, params ListParams) ([]NC
 
 	query := r.db.WithContext(ctx).Model(&NCRApproval{})
 
+	if params.Tombstoned {
+		query = query.Where("tombstoned_at IS NOT NULL")
+	} else {
+		query = query.Where("tombstoned_at IS NULL")
+	}
+	if params.Source != "" {
+		query = query.Where("source = ?", params.Source)
+	}
 	if params.Status != "" {
 		query = query.Where("status = ?", params.Status)
 	}
@@ -188,7 +723,7 @@ func (r *Repository) ListApprovals(ctx context.Context, params ListParams) ([]NC
 		query = query.Where("business_id ILIKE ?", "%"+params.BusinessID+"%")
 	}
 	if params.Department != "" {
-		query = query.Where("originator_dept_name ILIKE ?", "%"+params.Department+"%")
+		query = query.Where("(originator_dept_name ILIKE ? OR originator_dept_path ILIKE ?)", "%"+params.Department+"%", "%"+params.Department+"%")
 	}
 	if params.DitujukanKepada != "" {
 		query = query.Where("ditujukan_kepada ILIKE ?", "%"+params.DitujukanKepada+"%")
@@ -202,6 +737,9 @@ func (r *Repository) ListApprovals(ctx context.Context, params ListParams) ([]NC
 	if params.ToTidakTo != "" {
 		query = query.Where("to_tidak_to = ?", params.ToTidakTo)
 	}
+	if params.NeedsReview != nil {
+		query = query.Where("needs_review = ?", *params.NeedsReview)
+	}
 	if params.Search != "" {
 		searchTerm := "%" + params.Search + "%"
 		query = query.Where(
@@ -258,15 +796,23 @@ type FilterOptions struct {
 	DilaporkanOleh  []string `json:"dilaporkan_oleh"`
 	Kategori        []string `json:"kategori"`
 	Statuses        []string `json:"statuses"`
+	Sources         []Source `json:"sources"` // Configured sources, filled in by the service
 }
 
-// GetFilterOptions gets distinct values for filter dropdowns
-func (r *Repository) GetFilterOptions(ctx context.Context) (*FilterOptions, error) {
+// GetFilterOptions gets distinct values for filter dropdowns, optionally of one source's NCRs only
+func (r *Repository) GetFilterOptions(ctx context.Context, source string) (*FilterOptions, error) {
 	options := &FilterOptions{}
+	approvals := func() *gorm.DB {
+		query := r.db.WithContext(ctx).Model(&NCRApproval{})
+		if source != "" {
+			query = query.Where("source = ?", source)
+		}
+		return query
+	}
 
 	// Get distinct departments
 	var departments []string
-	r.db.WithContext(ctx).Model(&NCRApproval{}).
+	approvals().
 		Distinct("originator_dept_name").
 		Where("originator_dept_name IS NOT NULL AND originator_dept_name != ''").
 		Order("originator_dept_name").
@@ -275,7 +821,7 @@ func (r *Repository) GetFilterOptions(ctx context.Context) (*FilterOptions, erro
 
 	// Get distinct ditujukan_kepada
 	var ditujukanKepada []string
-	r.db.WithContext(ctx).Model(&NCRApproval{}).
+	approvals().
 		Distinct("ditujukan_kepada").
 		Where("ditujukan_kepada IS NOT NULL AND ditujukan_kepada != ''").
 		Order("ditujukan_kepada").
@@ -284,7 +830,7 @@ func (r *Repository) GetFilterOptions(ctx context.Context) (*FilterOptions, erro
 
 	// Get distinct dilaporkan_oleh
 	var dilaporkanOleh []string
-	r.db.WithContext(ctx).Model(&NCRApproval{}).
+	approvals().
 		Distinct("dilaporkan_oleh").
 		Where("dilaporkan_oleh IS NOT NULL AND dilaporkan_oleh != ''").
 		Order("dilaporkan_oleh").
@@ -293,7 +839,7 @@ func (r *Repository) GetFilterOptions(ctx context.Context) (*FilterOptions, erro
 
 	// Get distinct kategori
 	var kategori []string
-	r.db.WithContext(ctx).Model(&NCRApproval{}).
+	approvals().
 		Distinct("kategori").
 		Where("kategori IS NOT NULL AND kategori != ''").
 		Order("kategori").
@@ -302,7 +848,7 @@ func (r *Repository) GetFilterOptions(ctx context.Context) (*FilterOptions, erro
 
 	// Get distinct statuses
 	var statuses []string
-	r.db.WithContext(ctx).Model(&NCRApproval{}).
+	approvals().
 		Distinct("status").
 		Where("status IS NOT NULL AND status != ''").
 		Order("status").
@@ -327,6 +873,7 @@ func (r *Repository) GetApprovalWithDetails(ctx context.Context, id uuid.UUID) (
 
 // StatsParams contains parameters for filtering statistics
 type StatsParams struct {
+	Source          string
 	Status          string
 	Search          string
 	Department      string
@@ -341,6 +888,11 @@ type StatsParams struct {
 func (r *Repository) GetStatsWithFilters(ctx context.Context, params StatsParams) (map[string]interface{}, error) {
 	// Helper function to apply common filters
 	applyFilters := func(query *gorm.DB) *gorm.DB {
+		// NCRs removed from DingTalk are kept for reference but not counted
+		query = query.Where("tombstoned_at IS NULL")
+		if params.Source != "" {
+			query = query.Where("source = ?", params.Source)
+		}
 		if params.Status != "" {
 			query = query.Where("status = ?", params.Status)
 		}
@@ -349,7 +901,7 @@ func (r *Repository) GetStatsWithFilters(ctx context.Context, params StatsParams
 				"%"+params.Search+"%", "%"+params.Search+"%", "%"+params.Search+"%", "%"+params.Search+"%", "%"+params.Search+"%")
 		}
 		if params.Department != "" {
-			query = query.Where("originator_dept_name ILIKE ?", "%"+params.Department+"%")
+			query = query.Where("(originator_dept_name ILIKE ? OR originator_dept_path ILIKE ?)", "%"+params.Department+"%", "%"+params.Department+"%")
 		}
 		if params.DitujukanKepada != "" {
 			query = query.Where("ditujukan_kepada ILIKE ?", "%"+params.DitujukanKepada+"%")
@@ -873,20 +1425,64 @@ func (r *Repository) CreateSyncLog(ctx context.Context, log *SyncLog) error {
 	return r.db.WithContext(ctx).Create(log).Error
 }
 
-// UpdateSyncLog updates a sync log entry
+// UpdateSyncLog updates a sync log entry. Progress and cancel requests are written separately
+// and left as they are.
 func (r *Repository) UpdateSyncLog(ctx context.Context, log *SyncLog) error {
-	return r.db.WithContext(ctx).Save(log).Error
+	return r.db.WithContext(ctx).Omit("Progress", "CancelRequestedAt").Save(log).Error
+}
+
+// SaveSyncProgress stores a running sync's progress and reports whether its cancellation was requested
+func (r *Repository) SaveSyncProgress(ctx context.Context, id uuid.UUID, progress SyncProgress) (bool, error) {
+	var log SyncLog
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE sync_logs SET progress = ?
+		WHERE id = ?
+		RETURNING cancel_requested_at`, progress, id).Scan(&log).Error
+	if err != nil {
+		return false, err
+	}
+	return log.CancelRequestedAt != nil, nil
 }
 
-// ListSyncLogs lists sync logs with pagination
-func (r *Repository) ListSyncLogs(ctx context.Context, page, pageSize int) ([]SyncLog, int64, error) {
+// RequestSyncCancel records a request to cancel a sync. Returns false if the sync has already finished
+// (or doesn't exist).
+func (r *Repository) RequestSyncCancel(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&SyncLog{}).
+		Where("id = ? AND completed_at IS NULL", id).
+		Update("cancel_requested_at", gorm.Expr("COALESCE(cancel_requested_at, NOW())"))
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetSyncLog gets a sync log by ID
+func (r *Repository) GetSyncLog(ctx context.Context, id uuid.UUID) (*SyncLog, error) {
+	var log SyncLog
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&log).Error; err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// DeleteSyncLogsBefore removes finished sync logs started before the cutoff
+func (r *Repository) DeleteSyncLogsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("started_at < ? AND completed_at IS NOT NULL", cutoff).
+		Delete(&SyncLog{})
+	return result.RowsAffected, result.Error
+}
+
+// ListSyncLogs lists sync logs with pagination, optionally of one source only
+func (r *Repository) ListSyncLogs(ctx context.Context, source string, page, pageSize int) ([]SyncLog, int64, error) {
 	var logs []SyncLog
 	var total int64
 
-	r.db.WithContext(ctx).Model(&SyncLog{}).Count(&total)
+	query := r.db.WithContext(ctx).Model(&SyncLog{})
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+	query.Count(&total)
 
 	offset := (page - 1) * pageSize
-	err := r.db.WithContext(ctx).
+	err := query.
 		Order("started_at DESC").
 		Offset(offset).
 		Limit(pageSize).
@@ -894,3 +1490,33 @@ func (r *Repository) ListSyncLogs(ctx context.Context, page, pageSize int) ([]Sy
 
 	return logs, total, err
 }
+
+// CreateRevision stores the field changes of one NCR update
+func (r *Repository) CreateRevision(ctx context.Context, revision *ApprovalRevision) error {
+	return r.db.WithContext(ctx).Create(revision).Error
+}
+
+// ListRevisions lists the revisions of an NCR, newest first
+func (r *Repository) ListRevisions(ctx context.Context, approvalID uuid.UUID, page, pageSize int) ([]ApprovalRevision, int64, error) {
+	return r.listRevisions(ctx, "ncr_approval_id", approvalID, page, pageSize)
+}
+
+// ListRevisionsBySync lists the revisions written by one sync, newest first
+func (r *Repository) ListRevisionsBySync(ctx context.Context, syncID uuid.UUID, page, pageSize int) ([]ApprovalRevision, int64, error) {
+	return r.listRevisions(ctx, "sync_id", syncID, page, pageSize)
+}
+
+// listRevisions pages through revisions where column equals value
+func (r *Repository) listRevisions(ctx context.Context, column string, value interface{}, page, pageSize int) ([]ApprovalRevision, int64, error) {
+	var revisions []ApprovalRevision
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&ApprovalRevision{}).Where(column+" = ?", value)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("changed_at DESC").Offset(offset).Limit(pageSize).Find(&revisions).Error
+	return revisions, total, err
+}
@@ -0,0 +1,107 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// untrackedFields are NCRApproval fields that change on every sync or aren't stored on the row
+var untrackedFields = map[string]bool{
+	"id":             true,
+	"created_at":     true,
+	"updated_at":     true,
+	"last_synced_at": true,
+	"attachments":    true,
+	"workflow_steps": true,
+}
+
+// diffApprovals lists the tracked fields whose values differ between the stored row and its
+// new projection
+func diffApprovals(stored, projected *NCRApproval) FieldChanges {
+	var changes FieldChanges
+
+	storedValue := reflect.ValueOf(stored).Elem()
+	projectedValue := reflect.ValueOf(projected).Elem()
+	approvalType := storedValue.Type()
+
+	for i := 0; i < approvalType.NumField(); i++ {
+		field := approvalType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || untrackedFields[name] {
+			continue
+		}
+
+		dateOnly := strings.Contains(field.Tag.Get("gorm"), "type:date")
+		before := revisionValue(storedValue.Field(i), dateOnly)
+		after := revisionValue(projectedValue.Field(i), dateOnly)
+		if before != after {
+			changes = append(changes, FieldChange{Field: name, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+// revisionValue formats a field value for comparison and storage. Times are compared in UTC
+// (dates by day), so values read back from the database match fresh projections.
+func revisionValue(v reflect.Value, dateOnly bool) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if dateOnly {
+			return value.Format("2006-01-02")
+		}
+		return value.UTC().Format(time.RFC3339)
+	case JSONMap:
+		if len(value) == 0 {
+			return ""
+		}
+		data, _ := json.Marshal(value)
+		return string(data)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// recordRevision stores the fields an update changed; the NCR is not affected if this fails
+func (s *Service) recordRevision(ctx context.Context, run *syncRun, existing, approval *NCRApproval) {
+	changes := diffApprovals(existing, approval)
+	if len(changes) == 0 {
+		return
+	}
+
+	revision := &ApprovalRevision{
+		NCRApprovalID:     existing.ID,
+		ProcessInstanceID: existing.ProcessInstanceID,
+		SyncID:            run.syncID,
+		Changes:           changes,
+		ChangedAt:         time.Now(),
+	}
+	if err := s.repo.CreateRevision(ctx, revision); err != nil {
+		s.logger.Error("Failed to record approval revision",
+			zap.String("instance_id", existing.ProcessInstanceID),
+			zap.Error(err))
+	}
+}
+
+// GetHistory lists the field changes of an NCR, newest first
+func (s *Service) GetHistory(ctx context.Context, id uuid.UUID, page, pageSize int) ([]ApprovalRevision, int64, error) {
+	return s.repo.ListRevisions(ctx, id, page, pageSize)
+}
+
+// ListSyncChanges lists the field changes one sync made, newest first
+func (s *Service) ListSyncChanges(ctx context.Context, syncID uuid.UUID, page, pageSize int) ([]ApprovalRevision, int64, error) {
+	return s.repo.ListRevisionsBySync(ctx, syncID, page, pageSize)
+}
@@ -0,0 +1,145 @@
+package approval
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+)
+
+func TestDiffApprovals(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	finished := time.Date(2026, 1, 5, 11, 40, 18, 0, jakarta)
+	zero := time.Time{}
+
+	for _, tc := range []struct {
+		name              string
+		stored, projected NCRApproval
+		want              []string // Changed fields
+	}{
+		{
+			name:      "same instant in another zone",
+			stored:    NCRApproval{DingTalkFinishTime: ptr(finished.UTC())},
+			projected: NCRApproval{DingTalkFinishTime: ptr(finished)},
+		},
+		{
+			name:      "later instant",
+			stored:    NCRApproval{DingTalkFinishTime: ptr(finished)},
+			projected: NCRApproval{DingTalkFinishTime: ptr(finished.Add(time.Second))},
+			want:      []string{"dingtalk_finish_time"},
+		},
+		{
+			// A date column reads back as midnight UTC; the projection has midnight local time
+			name:      "date read back as UTC midnight",
+			stored:    NCRApproval{Tanggal: ptr(time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))},
+			projected: NCRApproval{Tanggal: ptr(time.Date(2026, 1, 5, 0, 0, 0, 0, jakarta))},
+		},
+		{
+			name:      "date on another day",
+			stored:    NCRApproval{Tanggal: ptr(time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))},
+			projected: NCRApproval{Tanggal: ptr(time.Date(2026, 1, 6, 0, 0, 0, 0, jakarta))},
+			want:      []string{"tanggal"},
+		},
+		{
+			name:      "empty and nil extra fields",
+			stored:    NCRApproval{ExtraFields: JSONMap{}},
+			projected: NCRApproval{},
+		},
+		{
+			name:      "extra field added",
+			stored:    NCRApproval{ExtraFields: JSONMap{}},
+			projected: NCRApproval{ExtraFields: JSONMap{"CATATAN BARU :": "belum dipetakan"}},
+			want:      []string{"extra_fields"},
+		},
+		{
+			name:      "nil times",
+			stored:    NCRApproval{},
+			projected: NCRApproval{},
+		},
+		{
+			// Stored as 0001-01-01 rather than NULL, so it is a change
+			name:      "nil and zero time",
+			stored:    NCRApproval{},
+			projected: NCRApproval{DingTalkFinishTime: &zero},
+			want:      []string{"dingtalk_finish_time"},
+		},
+		{
+			name:      "untracked fields",
+			stored:    NCRApproval{UpdatedAt: finished, LastSyncedAt: finished},
+			projected: NCRApproval{UpdatedAt: finished.Add(time.Hour), LastSyncedAt: finished.Add(time.Hour)},
+		},
+		{
+			name:      "text and flag",
+			stored:    NCRApproval{Status: "RUNNING"},
+			projected: NCRApproval{Status: "COMPLETED", NeedsReview: true},
+			want:      []string{"status", "needs_review"},
+		},
+	} {
+		changes := diffApprovals(&tc.stored, &tc.projected)
+		var got []string
+		for _, change := range changes {
+			got = append(got, change.Field)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: changed %v (%+v), want %v", tc.name, got, changes, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: changed %v, want %v", tc.name, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+// ptr returns a pointer to a copy of v
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestResyncRecordsNoRevision(t *testing.T) {
+	detail := newReplayInstance("COMPLETED", "agree", "2026-01-05 11:40:18",
+		dingtalk.FormComponentValue{Name: "NAMA PROJECT :", Value: "Gedung A", ComponentType: "TextField"},
+		dingtalk.FormComponentValue{Name: "KATEGORI :", Value: `["Material","Proses"]`, ComponentType: "DDMultiSelectField"},
+		dingtalk.FormComponentValue{Name: "TANGGAL :", Value: "2026-01-05", ComponentType: "DDDateField"},
+	)
+	detail.ProcessInstance.FinishTime = "2026-01-06 08:00:00"
+	replay := dingtalk.NewReplaySource()
+	replay.AddInstance(testProcessCode, "inst-1", detail)
+	// Another instance with an unmapped field, so extra fields are stored non-empty
+	replay.AddInstance(testProcessCode, "inst-2", newReplayInstance("RUNNING", "", "2026-01-06 09:00:00",
+		dingtalk.FormComponentValue{Name: "CATATAN BARU :", Value: "belum dipetakan", ComponentType: "TextField"},
+	))
+	service, repo := newReplayService(t, replay)
+	ctx := context.Background()
+
+	if _, err := service.SyncApprovals(ctx, testProcessCode, "manual"); err != nil {
+		t.Fatalf("SyncApprovals: %v", err)
+	}
+
+	// Rows read back from Postgres diff as empty against their re-projection, live or archived
+	for _, id := range []string{"inst-1", "inst-2"} {
+		if err := service.SyncInstance(ctx, testProcessCode, id); err != nil {
+			t.Fatalf("SyncInstance %s: %v", id, err)
+		}
+	}
+	if _, err := service.ReprojectArchive(ctx, testProcessCode); err != nil {
+		t.Fatalf("ReprojectArchive: %v", err)
+	}
+
+	for _, id := range []string{"inst-1", "inst-2"} {
+		stored, err := repo.GetByProcessInstanceID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetByProcessInstanceID %s: %v", id, err)
+		}
+		revisions, total, err := repo.ListRevisions(ctx, stored.ID, 1, 10)
+		if err != nil {
+			t.Fatalf("ListRevisions %s: %v", id, err)
+		}
+		if total != 0 {
+			t.Errorf("%s: %d revisions recorded for unchanged instance: %+v", id, total, revisions)
+		}
+	}
+}
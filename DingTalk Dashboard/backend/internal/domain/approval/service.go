@@ -3,11 +3,17 @@ package approval
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/lease"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -15,69 +21,572 @@ import (
 
 // Service handles approval business logic
 type Service struct {
-	repo   *Repository
-	client *dingtalk.Client
-	logger *zap.Logger
+	repo      *Repository
+	source    dingtalk.ApprovalSource
+	directory Directory
+	sources   []*registeredSource
+	leases    *lease.Manager
+	workers   int
+	logger    *zap.Logger
+
+	schemaMu sync.Mutex
+	schemas  map[string]cachedSchema // Form schemas by process code
+}
+
+// Directory resolves users and departments from the persistent DingTalk user directory
+type Directory interface {
+	dingtalk.UserLookup
+	// Department returns the name and full path ("Company / Parent / Dept") of a department
+	Department(ctx context.Context, deptID string) (name, path string, ok bool)
 }
 
-// NewService creates a new approval service
-func NewService(repo *Repository, client *dingtalk.Client, logger *zap.Logger) *Service {
+// NewService creates a new approval service. source is the live DingTalk client or a
+// recorder/replay stand-in, used for process codes no source is registered for; workers bounds
+// how many instance details are fetched concurrently.
+func NewService(repo *Repository, source dingtalk.ApprovalSource, workers int, logger *zap.Logger) *Service {
+	if workers < 1 {
+		workers = 1
+	}
 	return &Service{
-		repo:   repo,
-		client: client,
-		logger: logger,
+		repo:    repo,
+		source:  source,
+		workers: workers,
+		logger:  logger,
+	}
+}
+
+// SetDirectory makes the sync resolve user names and departments through the user directory
+// instead of calling the user API for every sync
+func (s *Service) SetDirectory(directory Directory) {
+	s.directory = directory
+}
+
+// SetLeases guards syncs with a lock shared by all replicas, so only one sync per process
+// code runs at a time
+func (s *Service) SetLeases(leases *lease.Manager) {
+	s.leases = leases
+}
+
+// userLookup returns where the sync resolves user names from
+func (s *Service) userLookup() dingtalk.UserLookup {
+	if s.directory != nil {
+		return s.directory
+	}
+	return s.source
+}
+
+// defaultSyncStart is where the very first sync begins when there is no watermark or data
+var defaultSyncStart = time.Date(2025, time.November, 1, 0, 0, 0, 0, time.UTC)
+
+// syncOverlap is subtracted from the watermark so late-indexed instances are not missed
+const syncOverlap = time.Hour
+
+// instanceTimeout bounds how long fetching and storing a single instance may take
+const instanceTimeout = 2 * time.Minute
+
+// SyncOptions controls which instances an incremental sync re-fetches
+type SyncOptions struct {
+	// Force re-fetches instances already stored in a final state (COMPLETED, TERMINATED, ...)
+	Force bool
+	// RunningOnly skips listing and only re-fetches instances that were RUNNING at the last sync
+	RunningOnly bool
+	// Since overrides the stored watermark as the start of the listing window
+	Since *time.Time
+	// Progress, if set, receives a snapshot whenever the sync advances. It is called from
+	// worker goroutines and must not block.
+	Progress func(SyncProgress)
+}
+
+// Sync progress phases
+const (
+	PhaseStarted    = "started"
+	PhaseListing    = "listing"
+	PhaseProcessing = "processing"
+	PhaseRetrying   = "retrying_failed"    // Retrying instances that failed in earlier syncs
+	PhaseRunning    = "refreshing_running" // Re-fetching instances still RUNNING locally
+	PhaseCompleted  = "completed"
+	PhasePartial    = "partial" // Completed, but some instances failed
+	PhaseFailed     = "failed"
+	PhaseCancelled  = "cancelled"
+)
+
+// SyncProgress is a snapshot of a running sync
+type SyncProgress struct {
+	SyncID          uuid.UUID  `json:"sync_id"`
+	Phase           string     `json:"phase"`
+	WindowStart     *time.Time `json:"window_start,omitempty"`
+	WindowEnd       *time.Time `json:"window_end,omitempty"`
+	IDsFetched      int        `json:"ids_fetched"`
+	Processed       int        `json:"processed"`
+	Created         int        `json:"created"`
+	Updated         int        `json:"updated"`
+	Skipped         int        `json:"skipped"`
+	Failed          int        `json:"failed"`
+	CurrentInstance string     `json:"current_instance,omitempty"`
+	APICalls        int64      `json:"api_calls"`
+	Error           string     `json:"error,omitempty"`
+}
+
+// syncCounters tracks per-run totals for the sync log; safe for concurrent use
+type syncCounters struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	apiCalls  int64 // updated atomically by the DingTalk client
+	processed int
+	created   int
+	updated   int
+	skipped   int
+	failed    int
+	transient int // Failures worth retrying (throttling, network); these hold back the watermark
+
+	// Progress reporting
+	syncID     uuid.UUID
+	onProgress func(SyncProgress)
+	phase      string
+	window     *dingtalk.TimeWindow
+	idsFetched int
+	current    string
+}
+
+func newSyncCounters() *syncCounters {
+	return &syncCounters{startedAt: time.Now()}
+}
+
+// record tallies the outcome of one processed instance
+func (c *syncCounters) record(isNew bool, err error) {
+	c.update(func() {
+		c.tally(isNew, err)
+	})
+}
+
+// tally counts an outcome; c.mu must be held
+func (c *syncCounters) tally(isNew bool, err error) {
+	switch {
+	case err != nil:
+		c.failed++
+		if dingtalk.IsTransient(err) {
+			c.transient++
+		}
+	case isNew:
+		c.created++
+	default:
+		c.updated++
 	}
 }
 
-// SyncApprovals syncs approvals from DingTalk
+// update changes the counters under the lock and reports the new progress
+func (c *syncCounters) update(change func()) {
+	c.mu.Lock()
+	change()
+	progress := c.progressLocked()
+	c.mu.Unlock()
+
+	if c.onProgress != nil {
+		c.onProgress(progress)
+	}
+}
+
+// setPhase reports a new phase, optionally for a listing window
+func (c *syncCounters) setPhase(phase string, window *dingtalk.TimeWindow) {
+	c.update(func() {
+		c.phase = phase
+		if window != nil {
+			c.window = window
+		}
+	})
+}
+
+// progressLocked snapshots the counters; c.mu must be held
+func (c *syncCounters) progressLocked() SyncProgress {
+	progress := SyncProgress{
+		SyncID:          c.syncID,
+		Phase:           c.phase,
+		IDsFetched:      c.idsFetched,
+		Processed:       c.processed,
+		Created:         c.created,
+		Updated:         c.updated,
+		Skipped:         c.skipped,
+		Failed:          c.failed,
+		CurrentInstance: c.current,
+		APICalls:        atomic.LoadInt64(&c.apiCalls),
+	}
+	if c.window != nil {
+		start, end := c.window.Start, c.window.End
+		progress.WindowStart = &start
+		progress.WindowEnd = &end
+	}
+	return progress
+}
+
+// snapshot returns the current progress
+func (c *syncCounters) snapshot() SyncProgress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.progressLocked()
+}
+
+// failures returns the number of failed instances so far
+func (c *syncCounters) failures() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failed
+}
+
+// transientFailures returns the number of instances that failed for retryable reasons
+func (c *syncCounters) transientFailures() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.transient
+}
+
+// syncRun holds state shared by every instance processed in one sync or refresh
+type syncRun struct {
+	processCode string
+	source      string // Name of the registered source; empty for unregistered process codes
+	approvals   dingtalk.ApprovalSource
+	syncID      *uuid.UUID // Set for full syncs
+	live        bool       // Instances are fetched from DingTalk, not re-projected from the archive
+	users       *dingtalk.UserNameCache
+	fields      *FieldMapper
+	stages      *StageMapper
+	failed      map[string]bool // Instances in the dead-letter queue when the run started
+
+	mu       sync.Mutex
+	labels   map[string]bool // Every form label seen in this run
+	unmapped map[string]bool // Labels with no field mapping
+}
+
+// hadFailed reports whether an instance was in the dead-letter queue when the run started
+func (r *syncRun) hadFailed(instanceID string) bool {
+	return r.failed[instanceID]
+}
+
+// observeLabel records a form label seen while mapping
+func (r *syncRun) observeLabel(label string, mapped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.labels[label] = true
+	if !mapped {
+		r.unmapped[label] = true
+	}
+}
+
+// formDrift compares this run's labels with the previous sync's and returns the sorted
+// label list along with the drift. Returns nil labels if no forms were mapped in this run.
+func (r *syncRun) formDrift(previous []string) ([]string, *FormDrift) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.labels) == 0 {
+		return nil, nil
+	}
+
+	labels := sortedKeys(r.labels)
+	drift := &FormDrift{Unmapped: sortedKeys(r.unmapped)}
+	if previous != nil {
+		prev := make(map[string]bool, len(previous))
+		for _, label := range previous {
+			prev[label] = true
+			if !r.labels[label] {
+				drift.Disappeared = append(drift.Disappeared, label)
+			}
+		}
+		for _, label := range labels {
+			if !prev[label] {
+				drift.Appeared = append(drift.Appeared, label)
+			}
+		}
+	}
+	return labels, drift
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// newSyncRun prepares per-run state, loading the form field mapping for the process code
+func (s *Service) newSyncRun(ctx context.Context, processCode string) *syncRun {
+	mappings, err := s.repo.ListFieldMappings(ctx, processCode)
+	if err != nil {
+		s.logger.Error("Failed to load form field mappings, using defaults", zap.Error(err))
+	}
+	source := s.sourceFor(processCode)
+	if len(mappings) == 0 && source != nil {
+		mappings = source.FieldMappings
+	}
+	if len(mappings) == 0 {
+		mappings = DefaultFieldMappings
+	}
+	for _, m := range mappings {
+		if !IsMappableColumn(m.ColumnName) {
+			s.logger.Warn("Ignoring form field mapping for unknown column",
+				zap.String("column", m.ColumnName),
+				zap.String("label", m.Label))
+		}
+	}
+
+	stageMappings, err := s.repo.ListStageMappings(ctx, processCode)
+	if err != nil {
+		s.logger.Error("Failed to load workflow stage mappings", zap.Error(err))
+	}
+	if len(stageMappings) == 0 {
+		s.logger.Warn("No workflow stage mapping configured, assigning stages by operation order",
+			zap.String("process_code", processCode))
+	}
+
+	failed := make(map[string]bool)
+	failedIDs, err := s.repo.ListSyncFailureIDs(ctx, processCode)
+	if err != nil {
+		s.logger.Error("Failed to load sync failures", zap.Error(err))
+	}
+	for _, id := range failedIDs {
+		failed[id] = true
+	}
+
+	run := &syncRun{
+		processCode: processCode,
+		approvals:   s.clientsFor(processCode).Approvals,
+		live:        true,
+		stages:      NewStageMapper(stageMappings),
+		users:       dingtalk.NewUserNameCache(),
+		fields:      NewFieldMapper(mappings),
+		failed:      failed,
+		labels:      make(map[string]bool),
+		unmapped:    make(map[string]bool),
+	}
+	if source != nil {
+		run.source = source.Name
+	}
+	return run
+}
+
+// SyncApprovals runs an incremental sync from the stored watermark
 func (s *Service) SyncApprovals(ctx context.Context, processCode string, syncType string) (*SyncLog, error) {
+	return s.SyncApprovalsWithOptions(ctx, processCode, syncType, SyncOptions{})
+}
+
+// SyncApprovalsWithOptions syncs approvals from DingTalk.
+// Instance IDs are listed in windows no wider than dingtalk.MaxListIDsRange, starting at the
+// per-process-code watermark. The watermark only advances past windows that processed cleanly.
+// Instances still RUNNING locally are always re-fetched; final ones only when forced.
+// If another sync of the process code is running, its log is returned with ErrSyncInProgress.
+func (s *Service) SyncApprovalsWithOptions(ctx context.Context, processCode string, syncType string, opts SyncOptions) (*SyncLog, error) {
+	syncID := uuid.New()
+
+	// Only one sync per process code at a time, across replicas
+	ctx, unlock, running, err := s.lockSync(ctx, processCode, syncID)
+	if err != nil {
+		return running, err
+	}
+	defer unlock()
+
 	// Create sync log
 	syncLog := &SyncLog{
-		ID:       uuid.New(),
-		SyncType: syncType,
-		Status:   "started",
+		ID:          syncID,
+		SyncType:    syncType,
+		ProcessCode: processCode,
+		Source:      s.sourceName(processCode),
+		Status:      "started",
 	}
 	if err := s.repo.CreateSyncLog(ctx, syncLog); err != nil {
 		return nil, err
 	}
 
-	// Determine start time based on existing data
-	var startTime time.Time
+	counters := newSyncCounters()
+	counters.syncID = syncID
+	counters.onProgress = opts.Progress
+	counters.setPhase(PhaseStarted, nil)
+	ctx = dingtalk.WithCallCounter(ctx, &counters.apiCalls)
+
+	// Publish progress through the log and stop when any replica requests cancellation
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer s.watchSync(ctx, cancel, syncID, counters)()
+
+	run := s.newSyncRun(ctx, processCode)
+	run.syncID = &syncID
+	seen := make(map[string]bool)
+
+	if !opts.RunningOnly {
+		startTime, err := s.resolveStartTime(ctx, processCode, opts)
+		if err != nil {
+			return s.failSync(syncLog, counters, err)
+		}
+		endTime := time.Now()
+
+		windows := dingtalk.SplitTimeRange(startTime, endTime, dingtalk.MaxListIDsRange)
+		s.logger.Info("Syncing approvals",
+			zap.Time("start_time", startTime),
+			zap.Int("windows", len(windows)))
+
+		advanceWatermark := true
+		for _, window := range windows {
+			counters.setPhase(PhaseListing, &window)
+			ids, err := s.listInstanceIDs(ctx, processCode, window)
+			if err != nil {
+				s.logger.Error("Failed to fetch instance IDs", zap.Error(err))
+				return s.failSync(syncLog, counters, err)
+			}
+			counters.update(func() {
+				counters.phase = PhaseProcessing
+				counters.idsFetched += len(ids)
+			})
+
+			s.logger.Info("Fetched instance IDs",
+				zap.Time("window_start", window.Start),
+				zap.Time("window_end", window.End),
+				zap.Int("count", len(ids)))
+
+			transientBefore := counters.transientFailures()
+			s.processInstances(ctx, run, ids, opts, seen, counters)
+			if ctx.Err() != nil {
+				return s.failSync(syncLog, counters, ctx.Err())
+			}
+
+			// Keep the watermark contiguous: stop advancing at the first window with transient
+			// failures. Permanent ones (deleted instance, no permission) would never succeed anyway.
+			if counters.transientFailures() > transientBefore {
+				advanceWatermark = false
+			}
+			if advanceWatermark {
+				if err := s.repo.SaveSyncState(ctx, &SyncState{
+					ProcessCode:   processCode,
+					HighWaterMark: window.End,
+					LastSyncID:    &syncLog.ID,
+				}); err != nil {
+					s.logger.Error("Failed to save sync watermark", zap.Error(err))
+				}
+			}
+		}
+	}
+
+	// Retry instances that failed in earlier syncs and haven't used up their attempts
+	failedIDs, err := s.repo.ListRetryableFailureIDs(ctx, processCode, maxAutoRetries)
+	if err != nil {
+		s.logger.Error("Failed to list failed instances", zap.Error(err))
+	}
+	counters.update(func() {
+		counters.phase = PhaseRetrying
+		counters.idsFetched += len(failedIDs)
+	})
+	s.processInstances(ctx, run, failedIDs, SyncOptions{Force: true}, seen, counters)
+	if ctx.Err() != nil {
+		return s.failSync(syncLog, counters, ctx.Err())
+	}
 
-	// Check if database has any data
-	hasData, err := s.repo.HasAnyData(ctx)
+	// Re-fetch the source's instances that were still in progress at the last sync, even if
+	// they started before the listing window
+	runningIDs, err := s.repo.ListRunningInstanceIDs(ctx, run.source)
 	if err != nil {
-		s.logger.Error("Failed to check existing data", zap.Error(err))
-		hasData = false
+		s.logger.Error("Failed to list running instances", zap.Error(err))
+	}
+	counters.update(func() {
+		counters.phase = PhaseRunning
+		counters.idsFetched += len(runningIDs)
+	})
+	s.processInstances(ctx, run, runningIDs, SyncOptions{Force: true}, seen, counters)
+	if ctx.Err() != nil {
+		return s.failSync(syncLog, counters, ctx.Err())
+	}
+
+	s.recordFormDrift(ctx, run, syncLog)
+
+	// Update sync log; failed instances are queued for the next sync
+	now := time.Now()
+	syncLog.Status = PhaseCompleted
+	if counters.failures() > 0 {
+		syncLog.Status = PhasePartial
+	}
+	counters.apply(syncLog)
+	syncLog.CompletedAt = &now
+	s.repo.UpdateSyncLog(ctx, syncLog)
+	counters.update(func() {
+		counters.phase = syncLog.Status
+		counters.current = ""
+	})
+
+	s.logger.Info("Sync completed",
+		zap.Int("processed", syncLog.RecordsProcessed),
+		zap.Int("created", syncLog.RecordsCreated),
+		zap.Int("updated", syncLog.RecordsUpdated),
+		zap.Int("skipped", syncLog.RecordsSkipped),
+		zap.Int("failed", counters.failures()),
+		zap.Int("api_calls", syncLog.APICalls),
+		zap.Float64("throughput", syncLog.Throughput))
+
+	return syncLog, nil
+}
+
+// recordFormDrift stores the form labels seen in this sync and how they changed since the last one
+func (s *Service) recordFormDrift(ctx context.Context, run *syncRun, syncLog *SyncLog) {
+	previous, err := s.repo.GetLastFormLabels(ctx, run.processCode)
+	if err != nil {
+		s.logger.Error("Failed to load previous form labels", zap.Error(err))
+	}
+
+	labels, drift := run.formDrift(previous)
+	if labels == nil {
+		return
+	}
+	syncLog.FormLabels = labels
+	syncLog.FormDrift = drift
+
+	if drift.HasChanges() {
+		s.logger.Warn("Form schema drift detected",
+			zap.String("process_code", run.processCode),
+			zap.Strings("appeared", drift.Appeared),
+			zap.Strings("disappeared", drift.Disappeared))
+	}
+	if len(drift.Unmapped) > 0 {
+		s.logger.Warn("Unmapped form fields", zap.Strings("labels", drift.Unmapped))
+	}
+}
+
+// resolveStartTime picks the listing start: explicit override, stored watermark,
+// newest local record of the source, or the initial backfill date
+func (s *Service) resolveStartTime(ctx context.Context, processCode string, opts SyncOptions) (time.Time, error) {
+	if opts.Since != nil {
+		return *opts.Since, nil
+	}
+
+	state, err := s.repo.GetSyncState(ctx, processCode)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if state != nil {
+		return state.HighWaterMark.Add(-syncOverlap), nil
 	}
 
-	if hasData {
-		// If data exists, fetch from 5 days ago
-		startTime = time.Now().AddDate(0, 0, -5)
-		s.logger.Info("Database has data, syncing from 5 days ago", zap.Time("start_time", startTime))
-	} else {
-		// If no data, fetch from November 1, 2025
-		startTime = time.Date(2025, time.November, 1, 0, 0, 0, 0, time.UTC)
-		s.logger.Info("Database is empty, syncing from November 1, 2025", zap.Time("start_time", startTime))
+	// No watermark yet: continue from the source's newest stored instance if it has any data
+	latest, err := s.repo.GetLatestCreateTime(ctx, s.sourceName(processCode))
+	if err != nil {
+		s.logger.Error("Failed to check existing data", zap.Error(err))
+	}
+	if latest != nil {
+		return latest.Add(-syncOverlap), nil
 	}
 
-	var allInstanceIDs []string
+	return defaultSyncStart, nil
+}
+
+// listInstanceIDs fetches all instance IDs started within a window, following the cursor
+func (s *Service) listInstanceIDs(ctx context.Context, processCode string, window dingtalk.TimeWindow) ([]string, error) {
+	approvals := s.clientsFor(processCode).Approvals
+	var ids []string
 	var cursor int64 = 0
 
-	// Fetch all instance IDs with pagination (no endTime)
 	for {
-		resp, err := s.client.GetApprovalInstanceIDs(processCode, startTime, cursor, 20)
+		resp, err := approvals.GetApprovalInstanceIDs(ctx, processCode, window.Start, window.End, cursor, 20)
 		if err != nil {
-			s.logger.Error("Failed to fetch instance IDs", zap.Error(err))
-			syncLog.Status = "failed"
-			syncLog.ErrorMessage = err.Error()
-			now := time.Now()
-			syncLog.CompletedAt = &now
-			s.repo.UpdateSyncLog(ctx, syncLog)
-			return syncLog, err
+			return nil, err
 		}
 
-		allInstanceIDs = append(allInstanceIDs, resp.Result.List...)
+		ids = append(ids, resp.Result.List...)
 
 		if resp.Result.NextCursor == 0 || len(resp.Result.List) == 0 {
 			break
@@ -85,166 +594,293 @@ func (s *Service) SyncApprovals(ctx context.Context, processCode string, syncTyp
 		cursor = resp.Result.NextCursor
 	}
 
-	s.logger.Info("Fetched instance IDs", zap.Int("count", len(allInstanceIDs)))
+	return ids, nil
+}
+
+// processInstances fetches and stores instances on a bounded worker pool, skipping ones already
+// handled in this run and ones stored in a final state unless opts.Force is set.
+// Request pacing is left to the client's rate limiter.
+func (s *Service) processInstances(ctx context.Context, run *syncRun, ids []string, opts SyncOptions, seen map[string]bool, counters *syncCounters) {
+	statuses, err := s.repo.GetStatusesByInstanceIDs(ctx, ids)
+	if err != nil {
+		s.logger.Error("Failed to load stored statuses", zap.Error(err))
+		statuses = map[string]string{}
+	}
 
-	// Cache for user names
-	userNameCache := make(map[string]string)
-	created := 0
-	updated := 0
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for instanceID := range jobs {
+				counters.update(func() { counters.current = instanceID })
+				instanceCtx, cancel := context.WithTimeout(ctx, instanceTimeout)
+				isNew, err := s.syncInstance(instanceCtx, run, instanceID)
+				cancel()
+				s.recordOutcome(ctx, run, instanceID, err)
+				counters.record(isNew, err)
+			}
+		}()
+	}
 
-	// Process each instance
-	for _, instanceID := range allInstanceIDs {
-		detail, err := s.client.GetApprovalInstanceDetail(instanceID)
-		if err != nil {
-			s.logger.Error("Failed to fetch instance detail",
-				zap.String("instance_id", instanceID),
-				zap.Error(err))
+dispatch:
+	for _, instanceID := range ids {
+		if seen[instanceID] {
 			continue
 		}
+		seen[instanceID] = true
 
-		// Skip if no process instance data
-		if detail.ProcessInstance == nil {
-			s.logger.Warn("No process instance data",
-				zap.String("instance_id", instanceID))
+		if status, ok := statuses[instanceID]; ok && status != "RUNNING" && !opts.Force {
+			counters.mu.Lock()
+			counters.skipped++
+			counters.mu.Unlock()
 			continue
 		}
 
-		// Check if exists
-		existing, _ := s.repo.GetByProcessInstanceID(ctx, instanceID)
-		isNew := existing == nil
-
-		// Get originator name via DingTalk User API
-		originatorName := s.client.GetUserName(detail.ProcessInstance.OriginatorUserID, userNameCache)
-
-		// Create NCR approval with mapped fields
-		approval := &NCRApproval{
-			ProcessInstanceID:  instanceID,
-			BusinessID:         detail.ProcessInstance.BusinessID,
-			Title:              detail.ProcessInstance.Title,
-			Status:             detail.ProcessInstance.Status,
-			Result:             detail.ProcessInstance.Result,
-			OriginatorUserID:   detail.ProcessInstance.OriginatorUserID,
-			OriginatorName:     originatorName,
-			OriginatorDeptID:   detail.ProcessInstance.OriginatorDeptID,
-			OriginatorDeptName: detail.ProcessInstance.OriginatorDeptName,
-			DingTalkCreateTime: dingtalk.ParseDingTalkTime(detail.ProcessInstance.CreateTime),
-			DingTalkFinishTime: dingtalk.ParseDingTalkTime(detail.ProcessInstance.FinishTime),
-			LastSyncedAt:       time.Now(),
+		select {
+		case jobs <- instanceID:
+			counters.mu.Lock()
+			counters.processed++
+			counters.mu.Unlock()
+		case <-ctx.Done():
+			break dispatch
 		}
+	}
 
-		if existing != nil {
-			approval.ID = existing.ID
-			approval.CreatedAt = existing.CreatedAt
-		}
+	close(jobs)
+	wg.Wait()
+}
 
-		// Map form component values to specific fields
-		s.mapFormValues(approval, detail.ProcessInstance.FormComponentValues)
+// failSync marks the sync log as failed (or cancelled, if its context was) and returns the error
+func (s *Service) failSync(syncLog *SyncLog, counters *syncCounters, err error) (*SyncLog, error) {
+	now := time.Now()
+	syncLog.Status = PhaseFailed
+	if errors.Is(err, context.Canceled) {
+		syncLog.Status = PhaseCancelled
+	}
+	syncLog.ErrorMessage = err.Error()
+	counters.apply(syncLog)
+	syncLog.CompletedAt = &now
+	// Use a fresh context so cancellation still gets recorded
+	s.repo.UpdateSyncLog(context.Background(), syncLog)
+	counters.update(func() {
+		counters.phase = syncLog.Status
+		counters.current = ""
+	})
+	return syncLog, err
+}
 
-		// Map operation records to analysis/action fields and build comments
-		s.mapOperationRecords(approval, detail.ProcessInstance.OperationRecords, userNameCache)
+// apply copies the counters and throughput figures onto a sync log
+func (c *syncCounters) apply(syncLog *SyncLog) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		if err := s.repo.UpsertApproval(ctx, approval); err != nil {
-			s.logger.Error("Failed to upsert approval", zap.Error(err))
-			continue
+	elapsed := time.Since(c.startedAt)
+	syncLog.RecordsProcessed = c.processed
+	syncLog.RecordsCreated = c.created
+	syncLog.RecordsUpdated = c.updated
+	syncLog.RecordsSkipped = c.skipped
+	syncLog.RecordsFailed = c.failed
+	syncLog.APICalls = int(atomic.LoadInt64(&c.apiCalls))
+	syncLog.DurationMs = elapsed.Milliseconds()
+	if elapsed > 0 {
+		syncLog.Throughput = float64(c.processed) / elapsed.Seconds()
+	}
+}
+
+// SyncInstance re-fetches a single process instance from DingTalk and upserts it.
+// Used by the event callback receiver so changes show up without waiting for the next scheduled sync.
+// It waits for the instance's lock rather than the process code's, so a running sync only delays
+// it while that sync writes the same instance.
+func (s *Service) SyncInstance(ctx context.Context, processCode, instanceID string) error {
+	return s.syncSingle(ctx, s.newSyncRun(ctx, processCode), instanceID)
+}
+
+// syncSingle syncs one instance outside a full sync, under its lock, and updates the failure
+// queue with the outcome
+func (s *Service) syncSingle(ctx context.Context, run *syncRun, instanceID string) error {
+	instanceCtx, cancel := context.WithTimeout(ctx, instanceTimeout)
+	_, err := s.syncInstance(instanceCtx, run, instanceID)
+	cancel()
+	s.recordOutcome(ctx, run, instanceID, err)
+	return err
+}
+
+// syncInstance fetches, maps, stores and archives one instance under its lock. Returns whether
+// the row was newly created.
+func (s *Service) syncInstance(ctx context.Context, run *syncRun, instanceID string) (bool, error) {
+	ctx, unlock, err := s.lockInstance(ctx, instanceID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return s.syncInstanceLocked(ctx, run, instanceID)
+}
+
+// syncInstanceLocked is syncInstance for callers already holding the instance's lock
+func (s *Service) syncInstanceLocked(ctx context.Context, run *syncRun, instanceID string) (bool, error) {
+	detail, err := run.approvals.GetApprovalInstanceDetail(ctx, instanceID)
+	if err != nil {
+		s.logger.Error("Failed to fetch instance detail",
+			zap.String("instance_id", instanceID),
+			zap.Bool("transient", dingtalk.IsTransient(err)),
+			zap.Error(err))
+		return false, err
+	}
+
+	// Skip if no process instance data
+	if detail.ProcessInstance == nil {
+		s.logger.Warn("No process instance data",
+			zap.String("instance_id", instanceID))
+		return false, fmt.Errorf("%w: no process instance data for %s", dingtalk.ErrNotFound, instanceID)
+	}
+
+	isNew, err := s.projectInstance(ctx, run, s.userLookup(), instanceID, detail.ProcessInstance)
+
+	// Archive even if projection failed so the payload can be re-projected once fixed
+	s.archivePayload(ctx, run, instanceID, detail)
+
+	return isNew, err
+}
+
+// projectInstance maps a process instance onto ncr_approvals, its attachments and workflow rows.
+// User names are resolved through lookup (the live source, or archived names when re-projecting).
+func (s *Service) projectInstance(ctx context.Context, run *syncRun, lookup dingtalk.UserLookup, instanceID string, pi *dingtalk.ProcessInstance) (bool, error) {
+	resolveName := func(userID string) string {
+		return run.users.Resolve(ctx, lookup, userID)
+	}
+
+	// Check if exists
+	existing, _ := s.repo.GetByProcessInstanceID(ctx, instanceID)
+	isNew := existing == nil
+
+	// Create NCR approval with mapped fields
+	approval := &NCRApproval{
+		ProcessInstanceID:  instanceID,
+		BusinessID:         pi.BusinessID,
+		Title:              pi.Title,
+		Status:             pi.Status,
+		Result:             pi.Result,
+		OriginatorUserID:   pi.OriginatorUserID,
+		OriginatorName:     resolveName(pi.OriginatorUserID),
+		OriginatorDeptID:   pi.OriginatorDeptID,
+		OriginatorDeptName: pi.OriginatorDeptName,
+		DingTalkCreateTime: dingtalk.ParseDingTalkTime(pi.CreateTime),
+		DingTalkFinishTime: dingtalk.ParseDingTalkTime(pi.FinishTime),
+		LastSyncedAt:       time.Now(),
+	}
+
+	if s.directory != nil {
+		if name, path, ok := s.directory.Department(ctx, pi.OriginatorDeptID); ok {
+			approval.OriginatorDeptName = name
+			approval.OriginatorDeptPath = path
 		}
+	}
 
-		// Get approval ID (might be new)
-		if isNew {
-			existing, _ = s.repo.GetByProcessInstanceID(ctx, instanceID)
-			if existing != nil {
-				approval.ID = existing.ID
-			}
-			created++
-		} else {
-			updated++
+	approval.Source = run.source
+	if existing != nil {
+		approval.ID = existing.ID
+		approval.CreatedAt = existing.CreatedAt
+		if approval.Source == "" {
+			approval.Source = existing.Source
+		}
+		// Only a live fetch proves the instance still exists; an archived payload doesn't
+		if !run.live {
+			approval.TombstonedAt = existing.TombstonedAt
+			approval.TombstoneReason = existing.TombstoneReason
 		}
+	}
+
+	// Map form component values to specific fields
+	s.mapFormValues(approval, pi.FormComponentValues, run)
 
-		// Handle attachments
-		s.repo.DeleteAttachments(ctx, approval.ID)
-		s.processAttachments(ctx, approval.ID, detail.ProcessInstance.FormComponentValues)
+	// Map operation records to analysis/action fields and build comments
+	s.mapOperationRecords(approval, pi.OperationRecords, pi.Tasks, run.stages, resolveName)
 
-		// Small delay to avoid rate limiting
-		time.Sleep(100 * time.Millisecond)
+	if err := s.repo.UpsertApproval(ctx, approval); err != nil {
+		s.logger.Error("Failed to upsert approval", zap.Error(err))
+		return false, err
 	}
 
-	// Update sync log
-	now := time.Now()
-	syncLog.Status = "completed"
-	syncLog.RecordsProcessed = len(allInstanceIDs)
-	syncLog.RecordsCreated = created
-	syncLog.RecordsUpdated = updated
-	syncLog.CompletedAt = &now
-	s.repo.UpdateSyncLog(ctx, syncLog)
+	if existing != nil {
+		s.recordRevision(ctx, run, existing, approval)
+	}
 
-	s.logger.Info("Sync completed",
-		zap.Int("processed", len(allInstanceIDs)),
-		zap.Int("created", created),
-		zap.Int("updated", updated))
+	// Get approval ID (might be new)
+	if isNew {
+		existing, _ = s.repo.GetByProcessInstanceID(ctx, instanceID)
+		if existing != nil {
+			approval.ID = existing.ID
+		}
+	}
 
-	return syncLog, nil
+	// Handle attachments
+	s.processAttachments(ctx, approval.ID, pi)
+
+	// Keep the normalized operation records and tasks for the timeline
+	s.saveWorkflow(ctx, approval.ID, pi, resolveName)
+
+	return isNew, nil
 }
 
-// mapFormValues maps DingTalk form component values to NCRApproval fields
-func (s *Service) mapFormValues(approval *NCRApproval, formValues []dingtalk.FormComponentValue) {
+// mapFormValues maps DingTalk form component values to NCRApproval fields using the configured
+// field mapping. Values with no mapping are kept in ExtraFields so form changes don't lose data.
+func (s *Service) mapFormValues(approval *NCRApproval, formValues []dingtalk.FormComponentValue, run *syncRun) {
 	for _, fv := range formValues {
-		fieldName := strings.TrimSpace(fv.Name)
-		value := fv.Value
-
-		// Parse multi-select values (JSON arrays) to comma-separated string
-		if fv.ComponentType == "DDMultiSelectField" {
-			var values []string
-			if err := json.Unmarshal([]byte(value), &values); err == nil {
-				value = strings.Join(values, ", ")
-			}
+		// Photos/files are handled by processAttachments and text notes carry no data
+		if nonDataComponents[fv.ComponentType] {
+			continue
+		}
+
+		label := strings.TrimSpace(fv.Name)
+		if label == "" {
+			label = fv.ID
 		}
 
-		// Map by field name
-		switch fieldName {
-		case "TANGGAL :":
-			if t, err := time.Parse("2006-01-02", value); err == nil {
-				approval.Tanggal = &t
+		mapping, ok := run.fields.Resolve(fv)
+		run.observeLabel(label, ok)
+		if !ok {
+			if fv.Value != "" && fv.Value != "null" {
+				if approval.ExtraFields == nil {
+					approval.ExtraFields = JSONMap{}
+				}
+				approval.ExtraFields[label] = fv.Value
 			}
-		case "DITUJUKAN KEPADA :":
-			approval.DitujukanKepada = value
-		case "DILAPORKAN OLEH :":
-			approval.DilaporkanOleh = value
-		case "KATEGORI :":
-			approval.Kategori = value
-		case "NAMA PROJECT :":
-			approval.NamaProject = value
-		case "NOMOR FPPP : ", "NOMOR FPPP :":
-			approval.NomorFPPP = value
-		case "NOMOR PRODUCTION ORDER :":
-			approval.NomorProductionOrder = value
-		case "NAMA  ITEM / PRODUCT :", "NAMA ITEM / PRODUCT :":
-			approval.NamaItemProduct = value
-		case "DESKRIPSI MASALAH :":
-			approval.DeskripsiMasalah = value
-		case "TO/TIDAK TO :":
-			approval.ToTidakTo = value
-		case "URGENT , BUTUH KAPAN : ", "URGENT , BUTUH KAPAN :":
-			approval.UrgentButuhKapan = value
-		case "CATATAN TAMBAHAN : ", "CATATAN TAMBAHAN :":
-			approval.CatatanTambahan = value
-		case "DETAIL MATERIAL YANG DIBUTUHKAN :":
-			approval.DetailMaterialYangDibutuhkan = value
+			continue
+		}
+		if !mapping.Apply(approval, fv) {
+			s.logger.Warn("Failed to convert form value",
+				zap.String("field", fv.Name),
+				zap.String("field_type", mapping.FieldType),
+				zap.String("value", fv.Value))
 		}
 	}
 }
 
-// mapOperationRecords maps operation records to analysis/action fields and builds formatted comments
-// Note: DingTalk API does not provide showName in operation_records, so we map EXECUTE_TASK_NORMAL
-// operations by order: 1st=analisis, 2nd=nama, 3rd=perbaikan, 4th=pencegahan
-func (s *Service) mapOperationRecords(approval *NCRApproval, records []dingtalk.OperationRecord, userNameCache map[string]string) {
+// nonDataComponents are component types never mapped to columns
+var nonDataComponents = map[string]bool{
+	"DDPhotoField": true,
+	"DDAttachment": true,
+	"TextNote":     true,
+}
+
+// mapOperationRecords maps workflow stage remarks to analysis/action fields and builds formatted comments.
+// EXECUTE_TASK_NORMAL remarks are assigned by the activity of the task they completed, using
+// workflow_stage_mappings; a later remark for the same stage (after a redo) replaces the earlier one.
+// Remarks whose activity can't be determined go to comments and the instance is flagged for review.
+// Without any stage mapping configured, the legacy order-based assignment is used.
+func (s *Service) mapOperationRecords(approval *NCRApproval, records []dingtalk.OperationRecord, tasks []dingtalk.Task, stages *StageMapper, resolveName func(userID string) string) {
 	var comments []string
 	executeTaskIndex := 0
+	unresolved := 0
 
 	for _, op := range records {
 		if op.Remark == "" || op.Remark == "-" || op.Remark == "null" {
 			continue
 		}
 
-		userName := s.client.GetUserName(op.UserID, userNameCache)
+		userName := resolveName(op.UserID)
 
 		// Format timestamp
 		var timeStr string
@@ -258,79 +894,73 @@ func (s *Service) mapOperationRecords(approval *NCRApproval, records []dingtalk.
 			zap.String("remark_preview", op.Remark[:min(50, len(op.Remark))]),
 			zap.Int("execute_task_index", executeTaskIndex))
 
-		// Map by operation type
-		switch op.OperationType {
-		case "EXECUTE_TASK_NORMAL":
-			// These are the workflow stage responses
-			// Map by order: 1=analisis, 2=nama, 3=perbaikan, 4=pencegahan
-			switch executeTaskIndex {
-			case 0:
-				approval.AnalisisPenyebabMasalah = op.Remark
-			case 1:
-				approval.NamaYangMelakukanMasalah = op.Remark
-			case 2:
-				approval.TindakanPerbaikan = op.Remark
-			case 3:
-				approval.TindakanPencegahan = op.Remark
-			default:
-				// Additional workflow steps go to comments
-				if timeStr != "" {
-					comments = append(comments, fmt.Sprintf("(User) %s - %s :\n%s", userName, timeStr, op.Remark))
+		// Workflow stage responses go to their stage column
+		if op.OperationType == "EXECUTE_TASK_NORMAL" {
+			var column string
+			if stages.Configured() {
+				if activityID, ok := activityForRecord(op, tasks); ok {
+					// Activities without a mapping (extra approvers) fall through to comments
+					column, _ = stages.Column(activityID)
 				} else {
-					comments = append(comments, fmt.Sprintf("(User) %s :\n%s", userName, op.Remark))
+					unresolved++
 				}
+			} else if executeTaskIndex < len(legacyStageOrder) {
+				column = legacyStageOrder[executeTaskIndex]
 			}
 			executeTaskIndex++
-		case "ADD_REMARK":
-			// Regular comments go to remark_comment
-			if timeStr != "" {
-				comments = append(comments, fmt.Sprintf("(User) %s - %s :\n%s", userName, timeStr, op.Remark))
-			} else {
-				comments = append(comments, fmt.Sprintf("(User) %s :\n%s", userName, op.Remark))
-			}
-		default:
-			// Other operation types with remarks also go to comments
-			if op.Remark != "" {
-				if timeStr != "" {
-					comments = append(comments, fmt.Sprintf("(User) %s - %s :\n%s", userName, timeStr, op.Remark))
-				} else {
-					comments = append(comments, fmt.Sprintf("(User) %s :\n%s", userName, op.Remark))
-				}
+
+			if column != "" {
+				*stageColumns[column](approval) = op.Remark
+				continue
 			}
 		}
+
+		// Regular remarks, other operation types and unassigned stage remarks go to remark_comment
+		if timeStr != "" {
+			comments = append(comments, fmt.Sprintf("(User) %s - %s :\n%s", userName, timeStr, op.Remark))
+		} else {
+			comments = append(comments, fmt.Sprintf("(User) %s :\n%s", userName, op.Remark))
+		}
 	}
 
 	if len(comments) > 0 {
 		approval.RemarkComment = strings.Join(comments, "\n\n")
 	}
+
+	if unresolved > 0 {
+		approval.NeedsReview = true
+		approval.ReviewReason = fmt.Sprintf("%d workflow remark(s) could not be matched to a stage", unresolved)
+	}
 }
 
-// processAttachments extracts and saves attachments from form values
-func (s *Service) processAttachments(ctx context.Context, approvalID uuid.UUID, formValues []dingtalk.FormComponentValue) {
-	for _, fv := range formValues {
+// processAttachments extracts attachments from form values and operation records and replaces
+// the stored ones. Rows that were already downloaded keep their ID and local copy.
+func (s *Service) processAttachments(ctx context.Context, approvalID uuid.UUID, pi *dingtalk.ProcessInstance) {
+	var attachments []NCRAttachment
+	for _, fv := range pi.FormComponentValues {
 		if fv.ComponentType == "DDPhotoField" {
 			var urls []string
 			if err := json.Unmarshal([]byte(fv.Value), &urls); err == nil {
 				for _, url := range urls {
-					s.repo.CreateAttachments(ctx, []NCRAttachment{{
+					attachments = append(attachments, NCRAttachment{
 						NCRApprovalID:  approvalID,
 						AttachmentType: "photo",
 						FieldName:      fv.Name,
 						FileURL:        url,
-					}})
+					})
 				}
 			}
 		} else if fv.ComponentType == "DDAttachment" {
-			var attachments []struct {
+			var files []struct {
 				SpaceID  string `json:"spaceId"`
 				FileName string `json:"fileName"`
 				FileSize int64  `json:"fileSize"`
 				FileType string `json:"fileType"`
 				FileID   string `json:"fileId"`
 			}
-			if err := json.Unmarshal([]byte(fv.Value), &attachments); err == nil {
-				for _, att := range attachments {
-					s.repo.CreateAttachments(ctx, []NCRAttachment{{
+			if err := json.Unmarshal([]byte(fv.Value), &files); err == nil {
+				for _, att := range files {
+					attachments = append(attachments, NCRAttachment{
 						NCRApprovalID:  approvalID,
 						AttachmentType: "file",
 						FieldName:      fv.Name,
@@ -339,11 +969,115 @@ func (s *Service) processAttachments(ctx context.Context, approvalID uuid.UUID,
 						FileType:       att.FileType,
 						SpaceID:        att.SpaceID,
 						FileID:         att.FileID,
-					}})
+					})
 				}
 			}
 		}
 	}
+
+	attachments = append(attachments, operationAttachments(approvalID, pi)...)
+
+	existing, err := s.repo.ListAttachments(ctx, approvalID)
+	if err != nil {
+		s.logger.Error("Failed to load attachments", zap.Error(err))
+		return
+	}
+	carryOverDownloads(attachments, existing)
+
+	if err := s.repo.ReplaceAttachments(ctx, approvalID, attachments); err != nil {
+		s.logger.Error("Failed to save attachments",
+			zap.String("approval_id", approvalID.String()),
+			zap.Error(err))
+	}
+}
+
+// operationAttachments extracts the images and files approvers added to workflow operations
+func operationAttachments(approvalID uuid.UUID, pi *dingtalk.ProcessInstance) []NCRAttachment {
+	var attachments []NCRAttachment
+	for i, op := range pi.OperationRecords {
+		if len(op.Images) == 0 && len(op.Attachments) == 0 {
+			continue
+		}
+		seq := i
+		activityID, _ := activityForRecord(op, pi.Tasks)
+
+		for _, url := range op.Images {
+			attachments = append(attachments, NCRAttachment{
+				NCRApprovalID:  approvalID,
+				AttachmentType: "operation_photo",
+				FieldName:      op.OperationType,
+				FileURL:        url,
+				OperationSeq:   &seq,
+				ActivityID:     activityID,
+			})
+		}
+		for _, att := range op.Attachments {
+			size, _ := strconv.ParseInt(att.FileSize, 10, 64)
+			attachments = append(attachments, NCRAttachment{
+				NCRApprovalID:  approvalID,
+				AttachmentType: "operation_file",
+				FieldName:      op.OperationType,
+				FileName:       att.FileName,
+				FileSize:       size,
+				FileType:       att.FileType,
+				FileID:         att.FileID,
+				OperationSeq:   &seq,
+				ActivityID:     activityID,
+			})
+		}
+	}
+	return attachments
+}
+
+// attachmentKey identifies the same attachment across syncs
+func attachmentKey(a NCRAttachment) string {
+	seq := ""
+	if a.OperationSeq != nil {
+		seq = strconv.Itoa(*a.OperationSeq)
+	}
+	return a.AttachmentType + "|" + a.FieldName + "|" + seq + "|" + a.FileID + "|" + a.FileURL
+}
+
+// carryOverDownloads copies the ID and local copy of previously stored attachments onto
+// their re-extracted counterparts, so links and downloads survive a re-sync
+func carryOverDownloads(attachments, existing []NCRAttachment) {
+	previous := make(map[string]NCRAttachment, len(existing))
+	for _, a := range existing {
+		previous[attachmentKey(a)] = a
+	}
+
+	for i := range attachments {
+		old, ok := previous[attachmentKey(attachments[i])]
+		if !ok {
+			continue
+		}
+		delete(previous, attachmentKey(old))
+
+		attachments[i].ID = old.ID
+		attachments[i].CreatedAt = old.CreatedAt
+		attachments[i].Checksum = old.Checksum
+		attachments[i].StorageKey = old.StorageKey
+		attachments[i].ContentType = old.ContentType
+		attachments[i].DownloadedAt = old.DownloadedAt
+		attachments[i].DownloadAttempts = old.DownloadAttempts
+		attachments[i].DownloadError = old.DownloadError
+		if old.DownloadedAt != nil {
+			attachments[i].FileSize = old.FileSize
+		}
+	}
+}
+
+// ApplyDirectory rewrites stored user names and departments from the user directory, so NCRs
+// synced before a user or department was known (or renamed) match the current directory
+func (s *Service) ApplyDirectory(ctx context.Context) error {
+	updated, err := s.repo.ApplyDirectory(ctx)
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		s.logger.Info("Applied user directory to stored NCRs", zap.Int64("rows", updated))
+	}
+	return nil
 }
 
 // ListApprovals lists approvals with filters
@@ -351,9 +1085,37 @@ func (s *Service) ListApprovals(ctx context.Context, params ListParams) ([]NCRAp
 	return s.repo.ListApprovals(ctx, params)
 }
 
-// GetApproval gets a single approval with details
+// GetAttachment gets a single attachment
+func (s *Service) GetAttachment(ctx context.Context, id uuid.UUID) (*NCRAttachment, error) {
+	return s.repo.GetAttachment(ctx, id)
+}
+
+// GetApproval gets a single approval with details, including its workflow steps
+// with the attachments added to each
 func (s *Service) GetApproval(ctx context.Context, id uuid.UUID) (*NCRApproval, error) {
-	return s.repo.GetApprovalWithDetails(ctx, id)
+	approval, err := s.repo.GetApprovalWithDetails(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	records, _, err := s.repo.GetWorkflow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	activityIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		if record.ActivityID != "" {
+			activityIDs = append(activityIDs, record.ActivityID)
+		}
+	}
+	stageNames, err := s.repo.GetStageNames(ctx, activityIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	approval.WorkflowSteps = workflowSteps(records, approval.Attachments, stageNames)
+	return approval, nil
 }
 
 // GetStats gets dashboard statistics (backwards compatible, no filters)
@@ -366,14 +1128,35 @@ func (s *Service) GetStatsWithFilters(ctx context.Context, params StatsParams) (
 	return s.repo.GetStatsWithFilters(ctx, params)
 }
 
-// GetFilterOptions gets distinct values for filter dropdowns
-func (s *Service) GetFilterOptions(ctx context.Context) (*FilterOptions, error) {
-	return s.repo.GetFilterOptions(ctx)
+// GetFilterOptions gets distinct values for filter dropdowns, optionally of one source's NCRs only
+func (s *Service) GetFilterOptions(ctx context.Context, source string) (*FilterOptions, error) {
+	options, err := s.repo.GetFilterOptions(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	options.Sources = s.Sources()
+	return options, nil
+}
+
+// ListUnmappedFields lists form labels with no field mapping and how often they occur,
+// optionally in one source's NCRs only
+func (s *Service) ListUnmappedFields(ctx context.Context, source string) ([]UnmappedField, error) {
+	return s.repo.ListUnmappedFields(ctx, source)
+}
+
+// ListSyncLogs lists sync logs, optionally of one source only
+func (s *Service) ListSyncLogs(ctx context.Context, source string, page, pageSize int) ([]SyncLog, int64, error) {
+	return s.repo.ListSyncLogs(ctx, source, page, pageSize)
+}
+
+// GetSyncLog returns a sync log by ID
+func (s *Service) GetSyncLog(ctx context.Context, id uuid.UUID) (*SyncLog, error) {
+	return s.repo.GetSyncLog(ctx, id)
 }
 
-// ListSyncLogs lists sync logs
-func (s *Service) ListSyncLogs(ctx context.Context, page, pageSize int) ([]SyncLog, int64, error) {
-	return s.repo.ListSyncLogs(ctx, page, pageSize)
+// DeleteSyncLogsBefore removes finished sync logs older than the cutoff
+func (s *Service) DeleteSyncLogsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return s.repo.DeleteSyncLogsBefore(ctx, cutoff)
 }
 
 // min returns the smaller of two integers
@@ -0,0 +1,148 @@
+package approval
+
+import (
+	"errors"
+	"fmt"
+
+	"dingtalk-dashboard/internal/config"
+	"dingtalk-dashboard/internal/dingtalk"
+)
+
+// ErrUnknownSource is returned when a request names a source that isn't configured
+var ErrUnknownSource = errors.New("unknown source")
+
+// Source is one DingTalk approval form synced into ncr_approvals. Its Name is stored in the
+// source column of every NCR and sync log it produces.
+type Source struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	ProcessCode string `json:"process_code"`
+
+	// FieldMappings apply when form_field_mappings has no rows for the process code;
+	// empty falls back to DefaultFieldMappings
+	FieldMappings []FormFieldMapping `json:"-"`
+}
+
+// SourceFieldMappings converts a configured source's field mappings. Mappings without a field
+// type are text.
+func SourceFieldMappings(source config.Source) []FormFieldMapping {
+	mappings := make([]FormFieldMapping, 0, len(source.FieldMappings))
+	for _, m := range source.FieldMappings {
+		fieldType := m.FieldType
+		if fieldType == "" {
+			fieldType = FieldTypeText
+		}
+		mappings = append(mappings, FormFieldMapping{
+			ProcessCode: source.ProcessCode,
+			ColumnName:  m.Column,
+			ComponentID: m.ComponentID,
+			BizAlias:    m.BizAlias,
+			Label:       m.Label,
+			FieldType:   fieldType,
+		})
+	}
+	return mappings
+}
+
+// SourceClients are the DingTalk clients a source is read and written through. Comments and
+// Creator may be nil, disabling comments and new NCRs for the source.
+type SourceClients struct {
+	Approvals dingtalk.ApprovalSource
+	Comments  dingtalk.CommentWriter
+	Creator   dingtalk.InstanceCreator
+}
+
+// registeredSource is a source with its clients
+type registeredSource struct {
+	Source
+	clients SourceClients
+}
+
+// AddSource registers a source. The first source added is the default for requests that
+// don't name one. Must be called before the service is used.
+func (s *Service) AddSource(source Source, clients SourceClients) {
+	if clients.Approvals == nil {
+		clients.Approvals = s.source
+	}
+	s.sources = append(s.sources, &registeredSource{Source: source, clients: clients})
+}
+
+// Sources lists the registered sources in the order they were added
+func (s *Service) Sources() []Source {
+	sources := make([]Source, 0, len(s.sources))
+	for _, source := range s.sources {
+		sources = append(sources, source.Source)
+	}
+	return sources
+}
+
+// ResolveSource returns the source with the given name, or the default source if name is empty
+func (s *Service) ResolveSource(name string) (Source, error) {
+	if name == "" {
+		if len(s.sources) == 0 {
+			return Source{}, fmt.Errorf("%w: no sources configured", ErrUnknownSource)
+		}
+		return s.sources[0].Source, nil
+	}
+	for _, source := range s.sources {
+		if source.Name == name {
+			return source.Source, nil
+		}
+	}
+	return Source{}, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+}
+
+// SourceForProcessCode returns the source registered for a process code. An empty process code
+// resolves to the default source.
+func (s *Service) SourceForProcessCode(processCode string) (Source, bool) {
+	if processCode == "" {
+		source, err := s.ResolveSource("")
+		return source, err == nil
+	}
+	if source := s.sourceFor(processCode); source != nil {
+		return source.Source, true
+	}
+	return Source{}, false
+}
+
+// sourceFor returns the source registered for a process code, or nil
+func (s *Service) sourceFor(processCode string) *registeredSource {
+	for _, source := range s.sources {
+		if source.ProcessCode == processCode {
+			return source
+		}
+	}
+	return nil
+}
+
+// sourceName returns the name of the source registered for a process code, or ""
+func (s *Service) sourceName(processCode string) string {
+	if source := s.sourceFor(processCode); source != nil {
+		return source.Name
+	}
+	return ""
+}
+
+// clientsFor returns the clients of the source registered for a process code. Unregistered
+// process codes are read through the service's default client and can't be written to.
+func (s *Service) clientsFor(processCode string) SourceClients {
+	if source := s.sourceFor(processCode); source != nil {
+		return source.clients
+	}
+	return SourceClients{Approvals: s.source}
+}
+
+// processCodeOf returns the process code of the source a stored NCR came from. NCRs from a
+// source that is no longer configured are attributed to the default source.
+func (s *Service) processCodeOf(approval *NCRApproval) (string, error) {
+	for _, source := range s.sources {
+		if source.Name == approval.Source {
+			return source.ProcessCode, nil
+		}
+	}
+	source, err := s.ResolveSource("")
+	if err != nil {
+		return "", err
+	}
+	return source.ProcessCode, nil
+}
@@ -0,0 +1,110 @@
+package approval
+
+import (
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+)
+
+// WorkflowStageMapping maps a workflow activity (node) to the ncr_approvals column its
+// EXECUTE_TASK_NORMAL remark should be written to
+type WorkflowStageMapping struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ProcessCode string    `gorm:"size:100;not null;default:''" json:"process_code"` // Empty applies to every form
+	ActivityID  string    `gorm:"size:200;not null" json:"activity_id"`
+	ColumnName  string    `gorm:"size:100;not null" json:"column_name"`
+	StageName   string    `gorm:"size:300" json:"stage_name"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (WorkflowStageMapping) TableName() string {
+	return "workflow_stage_mappings"
+}
+
+// stageColumns exposes the columns a workflow stage can be mapped to
+var stageColumns = map[string]func(a *NCRApproval) *string{
+	"analisis_penyebab_masalah":   func(a *NCRApproval) *string { return &a.AnalisisPenyebabMasalah },
+	"nama_yang_melakukan_masalah": func(a *NCRApproval) *string { return &a.NamaYangMelakukanMasalah },
+	"tindakan_perbaikan":          func(a *NCRApproval) *string { return &a.TindakanPerbaikan },
+	"tindakan_pencegahan":         func(a *NCRApproval) *string { return &a.TindakanPencegahan },
+}
+
+// legacyStageOrder is the order-based assignment used when no stage mapping is configured
+var legacyStageOrder = []string{
+	"analisis_penyebab_masalah",
+	"nama_yang_melakukan_masalah",
+	"tindakan_perbaikan",
+	"tindakan_pencegahan",
+}
+
+// taskMatchTolerance is how far apart an operation record and its task's finish time may be
+const taskMatchTolerance = 5 * time.Second
+
+// StageMapper resolves operation records to stage columns by activity ID
+type StageMapper struct {
+	byActivity map[string]string
+}
+
+// NewStageMapper indexes stage mappings. Mappings targeting unknown columns are ignored.
+func NewStageMapper(mappings []WorkflowStageMapping) *StageMapper {
+	m := &StageMapper{byActivity: make(map[string]string)}
+	for _, mapping := range mappings {
+		if _, ok := stageColumns[mapping.ColumnName]; ok {
+			m.byActivity[mapping.ActivityID] = mapping.ColumnName
+		}
+	}
+	return m
+}
+
+// Configured reports whether any stage mapping exists; without one the legacy order applies
+func (m *StageMapper) Configured() bool {
+	return len(m.byActivity) > 0
+}
+
+// Column returns the stage column mapped to an activity
+func (m *StageMapper) Column(activityID string) (string, bool) {
+	column, ok := m.byActivity[activityID]
+	return column, ok
+}
+
+// activityForRecord finds the workflow activity an operation record belongs to. The legacy
+// API does not put the activity on operation records, so it is taken from the task the same
+// user finished at the same time. Returns false if no task, or tasks of several activities, match.
+func activityForRecord(op dingtalk.OperationRecord, tasks []dingtalk.Task) (string, bool) {
+	if op.ActivityID != "" {
+		return op.ActivityID, true
+	}
+
+	opTime := dingtalk.ParseDingTalkTime(op.Date)
+	if opTime == nil {
+		return "", false
+	}
+
+	candidates := make(map[string]bool)
+	for _, task := range tasks {
+		if task.UserID != op.UserID || task.ActivityID == "" {
+			continue
+		}
+		finish := dingtalk.ParseDingTalkTime(task.FinishTime)
+		if finish == nil {
+			continue
+		}
+		diff := finish.Sub(*opTime)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= taskMatchTolerance {
+			candidates[task.ActivityID] = true
+		}
+	}
+
+	if len(candidates) != 1 {
+		return "", false
+	}
+	for activityID := range candidates {
+		return activityID, true
+	}
+	return "", false
+}
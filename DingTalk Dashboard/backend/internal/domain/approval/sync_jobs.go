@@ -0,0 +1,270 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// finishedJobRetention is how long a finished job stays available for late event subscribers
+const finishedJobRetention = 10 * time.Minute
+
+// SyncJob is a sync running in the background on this server. Its ID is the sync log ID.
+type SyncJob struct {
+	ID          uuid.UUID
+	ProcessCode string
+	SyncType    string
+
+	cancel  context.CancelFunc
+	started chan struct{}
+	done    chan struct{}
+
+	mu          sync.Mutex
+	latest      SyncProgress
+	subscribers map[chan SyncProgress]struct{}
+	log         *SyncLog
+	err         error
+}
+
+// Cancel stops the job; the sync records itself as cancelled
+func (j *SyncJob) Cancel() {
+	j.cancel()
+}
+
+// Done is closed when the job has finished
+func (j *SyncJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result returns the final sync log and error once Done is closed
+func (j *SyncJob) Result() (*SyncLog, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.log, j.err
+}
+
+// Latest returns the most recent progress snapshot
+func (j *SyncJob) Latest() SyncProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.latest
+}
+
+// Subscribe returns a channel receiving progress snapshots, starting with the latest one.
+// Slow readers only see the newest snapshot. Call unsubscribe when done reading.
+func (j *SyncJob) Subscribe() (<-chan SyncProgress, func()) {
+	ch := make(chan SyncProgress, 1)
+
+	j.mu.Lock()
+	j.subscribers[ch] = struct{}{}
+	ch <- j.latest
+	j.mu.Unlock()
+
+	unsubscribe := func() {
+		j.mu.Lock()
+		delete(j.subscribers, ch)
+		j.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// publish records a progress snapshot and hands it to every subscriber
+func (j *SyncJob) publish(progress SyncProgress) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.ID == uuid.Nil {
+		j.ID = progress.SyncID
+	}
+	j.latest = progress
+	for ch := range j.subscribers {
+		// Replace an unread snapshot rather than block the sync
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- progress
+	}
+}
+
+// finish stores the outcome and releases waiters
+func (j *SyncJob) finish(syncLog *SyncLog, err error) {
+	j.mu.Lock()
+	j.log = syncLog
+	j.err = err
+	if err != nil {
+		j.latest.Error = err.Error()
+	}
+	j.mu.Unlock()
+	close(j.done)
+}
+
+// JobManager runs syncs in the background and keeps track of them by ID
+type JobManager struct {
+	service *Service
+
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*SyncJob
+}
+
+// NewJobManager creates a job manager for the service's syncs
+func NewJobManager(service *Service) *JobManager {
+	return &JobManager{
+		service: service,
+		jobs:    make(map[uuid.UUID]*SyncJob),
+	}
+}
+
+// Start launches a sync and returns as soon as it holds the sync lock and has a log.
+// If another sync of the process code is running, the running sync's log is returned with
+// ErrSyncInProgress, along with its job when it runs on this server.
+func (m *JobManager) Start(processCode, syncType string, opts SyncOptions) (*SyncJob, *SyncLog, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &SyncJob{
+		ProcessCode: processCode,
+		SyncType:    syncType,
+		cancel:      cancel,
+		started:     make(chan struct{}),
+		done:        make(chan struct{}),
+		subscribers: make(map[chan SyncProgress]struct{}),
+	}
+
+	var startOnce sync.Once
+	opts.Progress = func(progress SyncProgress) {
+		job.publish(progress)
+		startOnce.Do(func() { close(job.started) })
+	}
+
+	go func() {
+		defer cancel()
+		syncLog, err := m.service.SyncApprovalsWithOptions(ctx, processCode, syncType, opts)
+		job.finish(syncLog, err)
+		time.AfterFunc(finishedJobRetention, func() { m.remove(job.ID) })
+	}()
+
+	select {
+	case <-job.started:
+	case <-job.done:
+	}
+
+	// A very short sync may already be done; it still counts as started
+	select {
+	case <-job.started:
+		m.mu.Lock()
+		m.jobs[job.ID] = job
+		m.mu.Unlock()
+		return job, nil, nil
+	default:
+	}
+
+	// Finished without starting: locked out, or failed before creating its log
+	syncLog, err := job.Result()
+	if errors.Is(err, ErrSyncInProgress) && syncLog != nil {
+		running, _ := m.Get(syncLog.ID)
+		return running, syncLog, err
+	}
+	return nil, syncLog, err
+}
+
+// Get returns a job started on this server
+func (m *JobManager) Get(id uuid.UUID) (*SyncJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// remove forgets a finished job
+func (m *JobManager) remove(id uuid.UUID) {
+	m.mu.Lock()
+	delete(m.jobs, id)
+	m.mu.Unlock()
+}
+
+var (
+	// ErrSyncNotFound is returned for a sync log ID that isn't stored
+	ErrSyncNotFound = errors.New("sync not found")
+	// ErrSyncNotRunning is returned when cancelling a sync that has already finished
+	ErrSyncNotRunning = errors.New("sync is not running")
+)
+
+// syncProgressInterval is how often a running sync stores its progress and checks for a cancel request
+const syncProgressInterval = 2 * time.Second
+
+// watchSync stores a running sync's progress on its log until ctx is done, so replicas other than
+// this one can follow it, and calls cancel once a cancellation is requested through the log.
+// Returns a function that stops watching.
+func (s *Service) watchSync(ctx context.Context, cancel context.CancelFunc, syncID uuid.UUID, counters *syncCounters) func() {
+	watchCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(syncProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-ticker.C:
+				cancelRequested, err := s.repo.SaveSyncProgress(watchCtx, syncID, counters.snapshot())
+				if err != nil {
+					if watchCtx.Err() == nil {
+						s.logger.Warn("Failed to store sync progress", zap.String("sync_id", syncID.String()), zap.Error(err))
+					}
+					continue
+				}
+				if cancelRequested {
+					s.logger.Info("Sync cancellation requested, stopping", zap.String("sync_id", syncID.String()))
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		stop()
+		<-done
+	}
+}
+
+// RequestSyncCancel asks the sync with the given log ID to stop, wherever it runs. The sync
+// notices within a few seconds and records itself as cancelled. Returns ErrSyncNotRunning with
+// the log if the sync has already finished.
+func (s *Service) RequestSyncCancel(ctx context.Context, id uuid.UUID) (*SyncLog, error) {
+	requested, err := s.repo.RequestSyncCancel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	syncLog, err := s.repo.GetSyncLog(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSyncNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !requested {
+		return syncLog, ErrSyncNotRunning
+	}
+	return syncLog, nil
+}
+
+// SyncRunning reports whether the sync of an unfinished log is still running on some replica,
+// i.e. still holds its process code's sync lock. Without leases no other replica can run it.
+func (s *Service) SyncRunning(ctx context.Context, syncLog *SyncLog) bool {
+	if syncLog.CompletedAt != nil || s.leases == nil {
+		return false
+	}
+	current, err := s.leases.Get(ctx, syncLockName(syncLog.ProcessCode))
+	if err != nil {
+		// Assume it still runs rather than end a stream on a transient error
+		return true
+	}
+	return current != nil && current.Meta == syncLog.ID.String()
+}
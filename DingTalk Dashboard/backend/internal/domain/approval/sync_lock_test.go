@@ -0,0 +1,116 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/lease"
+
+	"github.com/google/uuid"
+)
+
+// newLockingReplayService is newReplayService with the sync and instance locks enabled
+func newLockingReplayService(t *testing.T, replay *dingtalk.ReplaySource) (*Service, *Repository) {
+	t.Helper()
+	service, repo := newReplayService(t, replay)
+	service.SetLeases(lease.NewManager(repo.db))
+	return service, repo
+}
+
+func TestSyncInstanceWaitsForInstanceLock(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("RUNNING", "", "2026-01-05 11:40:18"))
+	service, repo := newLockingReplayService(t, replay)
+	ctx := context.Background()
+
+	if err := service.SyncInstance(ctx, testProcessCode, "inst-1"); err != nil {
+		t.Fatalf("SyncInstance: %v", err)
+	}
+
+	// A sync writing the instance holds its lock; the callback's refresh waits for it
+	_, unlock, err := service.lockInstance(ctx, "inst-1")
+	if err != nil {
+		t.Fatalf("lockInstance: %v", err)
+	}
+	replay.AddInstance(testProcessCode, "inst-1", newReplayInstance("COMPLETED", "agree", "2026-01-05 11:40:18"))
+
+	done := make(chan error, 1)
+	go func() { done <- service.SyncInstance(ctx, testProcessCode, "inst-1") }()
+
+	select {
+	case err := <-done:
+		unlock()
+		t.Fatalf("SyncInstance finished while the instance was locked: %v", err)
+	case <-time.After(time.Second):
+	}
+	if stored, _ := repo.GetByProcessInstanceID(ctx, "inst-1"); stored == nil || stored.Status != "RUNNING" {
+		t.Errorf("instance written while locked: %+v", stored)
+	}
+
+	unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("SyncInstance: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("SyncInstance still waiting after the lock was released")
+	}
+	if stored, _ := repo.GetByProcessInstanceID(ctx, "inst-1"); stored == nil || stored.Status != "COMPLETED" {
+		t.Errorf("instance not refreshed after the lock was released: %+v", stored)
+	}
+}
+
+func TestLockSync(t *testing.T) {
+	service, repo := newLockingReplayService(t, dingtalk.NewReplaySource())
+	ctx := context.Background()
+
+	running := &SyncLog{ID: uuid.New(), SyncType: "manual", ProcessCode: testProcessCode, Source: "ncr", Status: "started"}
+	if err := repo.CreateSyncLog(ctx, running); err != nil {
+		t.Fatalf("CreateSyncLog: %v", err)
+	}
+	_, unlock, _, err := service.lockSync(ctx, testProcessCode, running.ID)
+	if err != nil {
+		t.Fatalf("lockSync: %v", err)
+	}
+
+	// A second sync of the same process code is turned away with the running one's log
+	_, _, current, err := service.lockSync(ctx, testProcessCode, uuid.New())
+	if !errors.Is(err, ErrSyncInProgress) {
+		t.Fatalf("second lockSync = %v, want ErrSyncInProgress", err)
+	}
+	if current == nil || current.ID != running.ID {
+		t.Errorf("running sync = %+v, want log %s", current, running.ID)
+	}
+	// Other process codes have locks of their own
+	_, unlockOther, _, err := service.lockSync(ctx, "PROC-OTHER", uuid.New())
+	if err != nil {
+		t.Fatalf("lockSync of another process code: %v", err)
+	}
+	unlockOther()
+
+	unlock()
+	_, unlock, _, err = service.lockSync(ctx, testProcessCode, uuid.New())
+	if err != nil {
+		t.Fatalf("lockSync after unlock: %v", err)
+	}
+	unlock()
+
+	// A replica that crashed holding the lock stops blocking syncs once its lease expires
+	acquired, err := service.leases.TryAcquire(ctx, syncLockName(testProcessCode), "crashed-replica/"+uuid.NewString(), uuid.NewString(), time.Second)
+	if err != nil || !acquired {
+		t.Fatalf("TryAcquire = %v, %v; want the lock", acquired, err)
+	}
+	if _, _, _, err := service.lockSync(ctx, testProcessCode, uuid.New()); !errors.Is(err, ErrSyncInProgress) {
+		t.Fatalf("lockSync before expiry = %v, want ErrSyncInProgress", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	_, unlock, _, err = service.lockSync(ctx, testProcessCode, uuid.New())
+	if err != nil {
+		t.Fatalf("lockSync after expiry: %v", err)
+	}
+	unlock()
+}
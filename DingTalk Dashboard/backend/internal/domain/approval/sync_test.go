@@ -0,0 +1,123 @@
+package approval
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"go.uber.org/zap"
+)
+
+const testProcessCode = "PROC-TEST"
+
+// newReplayInstance builds a hand-written detail response for the replay source
+func newReplayInstance(status, result, createTime string, values ...dingtalk.FormComponentValue) *dingtalk.ApprovalDetailResponse {
+	return &dingtalk.ApprovalDetailResponse{
+		ProcessInstance: &dingtalk.ProcessInstance{
+			Title:               "NCR " + createTime,
+			Status:              status,
+			Result:              result,
+			OriginatorUserID:    "user-1",
+			OriginatorDeptName:  "Produksi",
+			CreateTime:          createTime,
+			FormComponentValues: values,
+			OperationRecords: []dingtalk.OperationRecord{
+				{UserID: "user-1", Date: createTime, OperationType: "ADD_REMARK", Remark: "Mohon dicek"},
+			},
+		},
+	}
+}
+
+// newReplayService returns a service syncing testProcessCode from replay into a test database
+func newReplayService(t *testing.T, replay *dingtalk.ReplaySource) (*Service, *Repository) {
+	t.Helper()
+	repo := newTestRepository(t)
+	service := NewService(repo, replay, 2, zap.NewNop())
+	service.AddSource(Source{Name: "ncr", ProcessCode: testProcessCode}, SourceClients{Approvals: replay, Comments: replay})
+	return service, repo
+}
+
+func TestSyncApprovalsProjectsReplayInstances(t *testing.T) {
+	replay := dingtalk.NewReplaySource()
+	user := &dingtalk.UserInfoResponse{}
+	user.Result.UserID = "user-1"
+	user.Result.Name = "Budi"
+	replay.AddUser("user-1", user)
+
+	replay.AddInstance(testProcessCode, "inst-running", newReplayInstance("RUNNING", "", "2026-01-05 11:40:18",
+		dingtalk.FormComponentValue{Name: "NAMA PROJECT :", Value: "Gedung A", ComponentType: "TextField"},
+		dingtalk.FormComponentValue{Name: "KATEGORI :", Value: `["Material","Proses"]`, ComponentType: "DDMultiSelectField"},
+		dingtalk.FormComponentValue{Name: "TANGGAL :", Value: "2026-01-05", ComponentType: "DDDateField"},
+		dingtalk.FormComponentValue{Name: "CATATAN BARU :", Value: "belum dipetakan", ComponentType: "TextField"},
+	))
+	replay.AddInstance(testProcessCode, "inst-done", newReplayInstance("COMPLETED", "agree", "2026-01-06 08:00:00",
+		dingtalk.FormComponentValue{Name: "NAMA PROJECT :", Value: "Gedung B", ComponentType: "TextField"},
+	))
+	// Another process code's instances are never listed
+	replay.AddInstance("PROC-OTHER", "inst-other", newReplayInstance("RUNNING", "", "2026-01-05 12:00:00"))
+
+	service, repo := newReplayService(t, replay)
+	ctx := context.Background()
+
+	log, err := service.SyncApprovals(ctx, testProcessCode, "manual")
+	if err != nil {
+		t.Fatalf("SyncApprovals: %v", err)
+	}
+	if log.Status != PhaseCompleted {
+		t.Errorf("status = %q, want %q (error: %s)", log.Status, PhaseCompleted, log.ErrorMessage)
+	}
+	if log.RecordsCreated != 2 {
+		t.Errorf("records created = %d, want 2", log.RecordsCreated)
+	}
+
+	running, err := repo.GetByProcessInstanceID(ctx, "inst-running")
+	if err != nil {
+		t.Fatalf("GetByProcessInstanceID: %v", err)
+	}
+	if running.Source != "ncr" {
+		t.Errorf("source = %q, want %q", running.Source, "ncr")
+	}
+	if running.Status != "RUNNING" {
+		t.Errorf("status = %q, want RUNNING", running.Status)
+	}
+	if running.OriginatorName != "Budi" {
+		t.Errorf("originator name = %q, want %q", running.OriginatorName, "Budi")
+	}
+	if running.NamaProject != "Gedung A" {
+		t.Errorf("nama project = %q, want %q", running.NamaProject, "Gedung A")
+	}
+	if running.Kategori != "Material, Proses" {
+		t.Errorf("kategori = %q, want %q", running.Kategori, "Material, Proses")
+	}
+	if running.Tanggal == nil || running.Tanggal.Format("2006-01-02") != "2026-01-05" {
+		t.Errorf("tanggal = %v, want 2026-01-05", running.Tanggal)
+	}
+	if got := running.ExtraFields["CATATAN BARU :"]; got != "belum dipetakan" {
+		t.Errorf("extra field = %v, want %q", got, "belum dipetakan")
+	}
+	if !strings.Contains(running.RemarkComment, "Budi") || !strings.Contains(running.RemarkComment, "Mohon dicek") {
+		t.Errorf("remark comment = %q, want the remark by Budi", running.RemarkComment)
+	}
+
+	done, err := repo.GetByProcessInstanceID(ctx, "inst-done")
+	if err != nil {
+		t.Fatalf("GetByProcessInstanceID: %v", err)
+	}
+	if done.Status != "COMPLETED" || done.Result != "agree" {
+		t.Errorf("status/result = %q/%q, want COMPLETED/agree", done.Status, done.Result)
+	}
+	if other, _ := repo.GetByProcessInstanceID(ctx, "inst-other"); other != nil {
+		t.Error("instance of another process code was synced")
+	}
+
+	// A second sync finds nothing new
+	log, err = service.SyncApprovals(ctx, testProcessCode, "manual")
+	if err != nil {
+		t.Fatalf("second SyncApprovals: %v", err)
+	}
+	if log.Status != PhaseCompleted || log.RecordsCreated != 0 {
+		t.Errorf("second sync: status = %q, created = %d; want %q, 0", log.Status, log.RecordsCreated, PhaseCompleted)
+	}
+}
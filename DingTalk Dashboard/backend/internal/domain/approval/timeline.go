@@ -0,0 +1,193 @@
+package approval
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Timeline event types
+const (
+	TimelineCreated      = "created"
+	TimelineTaskAssigned = "task_assigned"
+	TimelineTaskFinished = "task_finished"
+	TimelineOperation    = "operation"
+	TimelineFinished     = "finished"
+)
+
+// buildWorkflow converts the operation records and tasks of an instance into rows
+func buildWorkflow(approvalID uuid.UUID, pi *dingtalk.ProcessInstance, resolveName func(userID string) string) ([]NCROperationRecord, []NCRTask) {
+	records := make([]NCROperationRecord, 0, len(pi.OperationRecords))
+	for i, op := range pi.OperationRecords {
+		activityID, _ := activityForRecord(op, pi.Tasks)
+		records = append(records, NCROperationRecord{
+			NCRApprovalID:   approvalID,
+			Seq:             i,
+			UserID:          op.UserID,
+			UserName:        resolveName(op.UserID),
+			OperationType:   op.OperationType,
+			OperationResult: op.OperationResult,
+			Remark:          op.Remark,
+			ActivityID:      activityID,
+			OperatedAt:      dingtalk.ParseDingTalkTime(op.Date),
+		})
+	}
+
+	tasks := make([]NCRTask, 0, len(pi.Tasks))
+	for _, task := range pi.Tasks {
+		var taskID string
+		if task.TaskID != nil {
+			// taskid arrives as a JSON number or string
+			taskID = fmt.Sprint(task.TaskID)
+		}
+		tasks = append(tasks, NCRTask{
+			NCRApprovalID: approvalID,
+			TaskID:        taskID,
+			UserID:        task.UserID,
+			UserName:      resolveName(task.UserID),
+			Status:        task.Status,
+			Result:        task.Result,
+			ActivityID:    task.ActivityID,
+			AssignedAt:    dingtalk.ParseDingTalkTime(task.CreateTime),
+			FinishedAt:    dingtalk.ParseDingTalkTime(task.FinishTime),
+		})
+	}
+
+	return records, tasks
+}
+
+// saveWorkflow replaces the stored operation records and tasks of an approval
+func (s *Service) saveWorkflow(ctx context.Context, approvalID uuid.UUID, pi *dingtalk.ProcessInstance, resolveName func(userID string) string) {
+	records, tasks := buildWorkflow(approvalID, pi, resolveName)
+	if err := s.repo.ReplaceWorkflow(ctx, approvalID, records, tasks); err != nil {
+		s.logger.Error("Failed to save workflow records",
+			zap.String("approval_id", approvalID.String()),
+			zap.Error(err))
+	}
+}
+
+// workflowSteps pairs each operation record with the attachments added to it
+func workflowSteps(records []NCROperationRecord, attachments []NCRAttachment, stageNames map[string]string) []WorkflowStep {
+	bySeq := make(map[int][]NCRAttachment)
+	for _, attachment := range attachments {
+		if attachment.OperationSeq != nil {
+			bySeq[*attachment.OperationSeq] = append(bySeq[*attachment.OperationSeq], attachment)
+		}
+	}
+
+	steps := make([]WorkflowStep, 0, len(records))
+	for _, record := range records {
+		stepAttachments := bySeq[record.Seq]
+		if stepAttachments == nil {
+			stepAttachments = []NCRAttachment{}
+		}
+		steps = append(steps, WorkflowStep{
+			Seq:             record.Seq,
+			OperationType:   record.OperationType,
+			OperationResult: record.OperationResult,
+			UserID:          record.UserID,
+			UserName:        record.UserName,
+			ActivityID:      record.ActivityID,
+			StageName:       stageNames[record.ActivityID],
+			Remark:          record.Remark,
+			OperatedAt:      record.OperatedAt,
+			Attachments:     stepAttachments,
+		})
+	}
+	return steps
+}
+
+// GetTimeline builds the chronological workflow timeline of an approval: creation, task
+// assignments, every operation (approvals and remarks), task completions and the final result.
+// Task events carry how long the task was held; open tasks are measured up to now.
+func (s *Service) GetTimeline(ctx context.Context, id uuid.UUID) ([]TimelineEvent, error) {
+	approval, err := s.repo.GetApprovalWithDetails(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	records, tasks, err := s.repo.GetWorkflow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []TimelineEvent{{
+		At:       approval.DingTalkCreateTime,
+		Event:    TimelineCreated,
+		UserID:   approval.OriginatorUserID,
+		UserName: approval.OriginatorName,
+	}}
+
+	now := time.Now()
+	for _, task := range tasks {
+		var held *int64
+		if task.AssignedAt != nil {
+			end := now
+			if task.FinishedAt != nil {
+				end = *task.FinishedAt
+			}
+			seconds := int64(end.Sub(*task.AssignedAt).Seconds())
+			held = &seconds
+		}
+
+		if task.AssignedAt != nil {
+			events = append(events, TimelineEvent{
+				At:             task.AssignedAt,
+				Event:          TimelineTaskAssigned,
+				UserID:         task.UserID,
+				UserName:       task.UserName,
+				ActivityID:     task.ActivityID,
+				HeldForSeconds: held,
+			})
+		}
+		if task.FinishedAt != nil {
+			events = append(events, TimelineEvent{
+				At:             task.FinishedAt,
+				Event:          TimelineTaskFinished,
+				UserID:         task.UserID,
+				UserName:       task.UserName,
+				Result:         task.Result,
+				ActivityID:     task.ActivityID,
+				HeldForSeconds: held,
+			})
+		}
+	}
+
+	for _, record := range records {
+		events = append(events, TimelineEvent{
+			At:            record.OperatedAt,
+			Event:         TimelineOperation,
+			UserID:        record.UserID,
+			UserName:      record.UserName,
+			OperationType: record.OperationType,
+			Result:        record.OperationResult,
+			Remark:        record.Remark,
+			ActivityID:    record.ActivityID,
+		})
+	}
+
+	if approval.DingTalkFinishTime != nil {
+		events = append(events, TimelineEvent{
+			At:     approval.DingTalkFinishTime,
+			Event:  TimelineFinished,
+			Result: approval.Result,
+		})
+	}
+
+	// Creation stays first and the finish event last on equal timestamps; undated events go to the end
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i].At, events[j].At
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.Before(*b)
+	})
+
+	return events, nil
+}
@@ -0,0 +1,79 @@
+package directory
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// User is a DingTalk user from the contact directory
+type User struct {
+	UserID      string    `gorm:"primaryKey;size:100" json:"user_id"`
+	Name        string    `gorm:"size:200" json:"name"`
+	Title       string    `gorm:"size:200" json:"title"`
+	Email       string    `gorm:"size:200" json:"email,omitempty"`
+	OrgEmail    string    `gorm:"size:200" json:"org_email,omitempty"`
+	DeptIDs     Int64List `gorm:"column:dept_ids;type:jsonb" json:"dept_ids"`
+	MainDeptID  int64     `json:"main_dept_id"`
+	Active      bool      `gorm:"column:active" json:"active"` // False once the user no longer appears in the directory
+	RefreshedAt time.Time `json:"refreshed_at"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (User) TableName() string {
+	return "dt_users"
+}
+
+// Department is a DingTalk department with its position in the hierarchy
+type Department struct {
+	DeptID      int64     `gorm:"primaryKey;autoIncrement:false" json:"dept_id"`
+	Name        string    `gorm:"size:200" json:"name"`
+	ParentID    int64     `json:"parent_id"`
+	Path        string    `gorm:"type:text" json:"path"` // Names from the root down, e.g. "Company / Produksi / Welding"
+	RefreshedAt time.Time `json:"refreshed_at"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (Department) TableName() string {
+	return "dt_departments"
+}
+
+// RefreshResult summarizes a full directory refresh
+type RefreshResult struct {
+	Skipped     bool `json:"skipped"` // The directory was still within its TTL
+	Departments int  `json:"departments"`
+	Users       int  `json:"users"`
+	Deactivated int  `json:"deactivated"`
+}
+
+// Int64List is an int64 slice stored in a JSONB column
+type Int64List []int64
+
+// Value implements driver.Valuer
+func (l Int64List) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (l *Int64List) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", src)
+	}
+}
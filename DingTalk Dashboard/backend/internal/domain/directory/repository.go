@@ -0,0 +1,101 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Repository handles directory data access
+type Repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// GetUser finds a user by DingTalk user ID; returns nil if not stored
+func (r *Repository) GetUser(ctx context.Context, userID string) (*User, error) {
+	var user User
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByEmail finds an active user by personal or organization email, ignoring case;
+// returns nil if no user has it
+func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	err := r.db.WithContext(ctx).
+		Where("active = ? AND (LOWER(email) = LOWER(?) OR LOWER(org_email) = LOWER(?))", true, email, email).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpsertUsers creates or updates users
+func (r *Repository) UpsertUsers(ctx context.Context, users []User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "title", "email", "org_email", "dept_ids", "main_dept_id", "active", "refreshed_at", "updated_at"}),
+	}).CreateInBatches(&users, 200).Error
+}
+
+// DeactivateUsersNotSeenSince marks users missing from a full refresh started at since as inactive
+func (r *Repository) DeactivateUsersNotSeenSince(ctx context.Context, since time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&User{}).
+		Where("active = ? AND refreshed_at < ?", true, since).
+		Update("active", false)
+	return result.RowsAffected, result.Error
+}
+
+// GetDepartment finds a department by ID; returns nil if not stored
+func (r *Repository) GetDepartment(ctx context.Context, deptID int64) (*Department, error) {
+	var dept Department
+	err := r.db.WithContext(ctx).Where("dept_id = ?", deptID).First(&dept).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dept, nil
+}
+
+// UpsertDepartments creates or updates departments
+func (r *Repository) UpsertDepartments(ctx context.Context, depts []Department) error {
+	if len(depts) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "dept_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "parent_id", "path", "refreshed_at", "updated_at"}),
+	}).CreateInBatches(&depts, 200).Error
+}
+
+// LastRefresh returns when departments were last refreshed, or nil if never
+func (r *Repository) LastRefresh(ctx context.Context) (*time.Time, error) {
+	var last *time.Time
+	err := r.db.WithContext(ctx).Model(&Department{}).
+		Select("MAX(refreshed_at)").
+		Scan(&last).Error
+	return last, err
+}
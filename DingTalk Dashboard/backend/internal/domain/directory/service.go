@@ -0,0 +1,297 @@
+package directory
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// rootDeptID is the top-level department of every DingTalk organization
+	rootDeptID = 1
+	// userPageSize is the largest page the list department users API allows
+	userPageSize = 100
+)
+
+// Service keeps the dt_users/dt_departments directory in sync with the DingTalk contact API
+// and resolves users and departments from it
+type Service struct {
+	repo     *Repository
+	contacts []dingtalk.ContactSource // One per DingTalk app
+	ttl      time.Duration
+	logger   *zap.Logger
+
+	refreshMu sync.Mutex
+}
+
+// NewService creates a directory service. Stored entries older than ttl are refreshed from DingTalk.
+func NewService(repo *Repository, contacts dingtalk.ContactSource, ttl time.Duration, logger *zap.Logger) *Service {
+	return &Service{
+		repo:     repo,
+		contacts: []dingtalk.ContactSource{contacts},
+		ttl:      ttl,
+		logger:   logger,
+	}
+}
+
+// AddContacts makes the directory also crawl and look up users through another app's contact
+// API. Each app only sees the part of the organization in its contact scope.
+func (s *Service) AddContacts(contacts dingtalk.ContactSource) {
+	s.contacts = append(s.contacts, contacts)
+}
+
+// Refresh crawls the department tree and its users from DingTalk and stores them. Unless
+// force is set, it does nothing while the last refresh is younger than the TTL. Users no
+// longer in any department are kept (old NCRs reference them) but marked inactive.
+func (s *Service) Refresh(ctx context.Context, force bool) (*RefreshResult, error) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	if !force {
+		last, err := s.repo.LastRefresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if last != nil && time.Since(*last) < s.ttl {
+			return &RefreshResult{Skipped: true}, nil
+		}
+	}
+
+	startedAt := time.Now()
+
+	// Apps with overlapping contact scopes see the same departments and users; they are merged
+	var depts []Department
+	seenDepts := make(map[int64]bool)
+	users := make(map[string]*User)
+	for _, contacts := range s.contacts {
+		if err := s.crawl(ctx, contacts, &depts, seenDepts, users, startedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.UpsertDepartments(ctx, depts); err != nil {
+		return nil, err
+	}
+
+	userRows := make([]User, 0, len(users))
+	for _, user := range users {
+		userRows = append(userRows, *user)
+	}
+	if err := s.repo.UpsertUsers(ctx, userRows); err != nil {
+		return nil, err
+	}
+
+	deactivated, err := s.repo.DeactivateUsersNotSeenSince(ctx, startedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RefreshResult{
+		Departments: len(depts),
+		Users:       len(userRows),
+		Deactivated: int(deactivated),
+	}
+	s.logger.Info("User directory refreshed",
+		zap.Int("departments", result.Departments),
+		zap.Int("users", result.Users),
+		zap.Int("deactivated", result.Deactivated),
+		zap.Duration("duration", time.Since(startedAt)))
+
+	return result, nil
+}
+
+// crawl walks the department tree one app can see, breadth-first, appending departments not
+// seen yet to depts and their users to users. Paths are built from the parent's path.
+func (s *Service) crawl(ctx context.Context, contacts dingtalk.ContactSource, depts *[]Department, seen map[int64]bool, users map[string]*User, refreshedAt time.Time) error {
+	root, err := contacts.GetDepartment(ctx, rootDeptID)
+	if err != nil {
+		return err
+	}
+
+	queue := []Department{{DeptID: root.DeptID, Name: root.Name, Path: root.Name, RefreshedAt: refreshedAt}}
+	for i := 0; i < len(queue); i++ {
+		parent := queue[i]
+		if seen[parent.DeptID] {
+			continue
+		}
+		seen[parent.DeptID] = true
+		*depts = append(*depts, parent)
+
+		children, err := contacts.ListSubDepartments(ctx, parent.DeptID)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			queue = append(queue, Department{
+				DeptID:      child.DeptID,
+				Name:        child.Name,
+				ParentID:    parent.DeptID,
+				Path:        parent.Path + " / " + child.Name,
+				RefreshedAt: refreshedAt,
+			})
+		}
+
+		if err := s.collectUsers(ctx, contacts, parent.DeptID, users, refreshedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectUsers adds the users directly in a department to users, merging users found in several departments
+func (s *Service) collectUsers(ctx context.Context, contacts dingtalk.ContactSource, deptID int64, users map[string]*User, refreshedAt time.Time) error {
+	var cursor int64
+	for {
+		page, err := contacts.ListDepartmentUsers(ctx, deptID, cursor, userPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range page.Result.List {
+			if user, ok := users[entry.UserID]; ok {
+				user.DeptIDs = mergeDeptIDs(user.DeptIDs, entry.DeptIDList)
+				continue
+			}
+			users[entry.UserID] = &User{
+				UserID:      entry.UserID,
+				Name:        entry.Name,
+				Title:       entry.Title,
+				Email:       entry.Email,
+				OrgEmail:    entry.OrgEmail,
+				DeptIDs:     mergeDeptIDs(nil, entry.DeptIDList),
+				MainDeptID:  mainDept(entry.DeptIDList, deptID),
+				Active:      true,
+				RefreshedAt: refreshedAt,
+			}
+		}
+
+		if !page.Result.HasMore {
+			return nil
+		}
+		cursor = page.Result.NextCursor
+	}
+}
+
+// GetUserInfo resolves a user from the directory, fetching and storing it when it is missing
+// or older than the TTL. Apps are asked in turn until one can see the user. A stale entry is
+// still returned if DingTalk can't be reached.
+// It implements dingtalk.UserLookup so the sync resolves names through the directory.
+func (s *Service) GetUserInfo(ctx context.Context, userID string) (*dingtalk.UserInfoResponse, error) {
+	stored, err := s.repo.GetUser(ctx, userID)
+	if err != nil {
+		s.logger.Warn("Failed to read user directory", zap.String("user_id", userID), zap.Error(err))
+	}
+	if stored != nil && time.Since(stored.RefreshedAt) < s.ttl {
+		return userInfo(stored), nil
+	}
+
+	info, err := s.fetchUser(ctx, userID)
+	if err != nil {
+		if stored != nil {
+			return userInfo(stored), nil
+		}
+		return nil, err
+	}
+
+	user := User{
+		UserID:      userID,
+		Name:        info.Result.Name,
+		Title:       info.Result.Title,
+		Email:       info.Result.Email,
+		OrgEmail:    info.Result.OrgEmail,
+		DeptIDs:     mergeDeptIDs(nil, info.Result.DeptIDList),
+		MainDeptID:  mainDept(info.Result.DeptIDList, 0),
+		Active:      true,
+		RefreshedAt: time.Now(),
+	}
+	if err := s.repo.UpsertUsers(ctx, []User{user}); err != nil {
+		s.logger.Warn("Failed to store user", zap.String("user_id", userID), zap.Error(err))
+	}
+	return info, nil
+}
+
+// fetchUser gets a user from the first app whose contact API returns it
+func (s *Service) fetchUser(ctx context.Context, userID string) (*dingtalk.UserInfoResponse, error) {
+	var err error
+	for _, contacts := range s.contacts {
+		var info *dingtalk.UserInfoResponse
+		if info, err = contacts.GetUserInfo(ctx, userID); err == nil {
+			return info, nil
+		}
+	}
+	return nil, err
+}
+
+// Department resolves a department ID, as given on an instance, to its name and full path.
+// Only the stored directory is consulted; ok is false for unknown departments.
+func (s *Service) Department(ctx context.Context, deptID string) (name, path string, ok bool) {
+	id, err := strconv.ParseInt(strings.TrimSpace(deptID), 10, 64)
+	if err != nil || id <= 0 {
+		return "", "", false
+	}
+
+	dept, err := s.repo.GetDepartment(ctx, id)
+	if err != nil || dept == nil {
+		return "", "", false
+	}
+	return dept.Name, dept.Path, true
+}
+
+// UserIDByEmail finds the DingTalk user with the given email in the stored directory
+func (s *Service) UserIDByEmail(ctx context.Context, email string) (string, bool) {
+	if strings.TrimSpace(email) == "" {
+		return "", false
+	}
+	user, err := s.repo.GetUserByEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		s.logger.Warn("Failed to read user directory", zap.String("email", email), zap.Error(err))
+		return "", false
+	}
+	if user == nil {
+		return "", false
+	}
+	return user.UserID, true
+}
+
+// userInfo converts a stored user to the contact API response shape
+func userInfo(user *User) *dingtalk.UserInfoResponse {
+	info := &dingtalk.UserInfoResponse{}
+	info.Result.UserID = user.UserID
+	info.Result.Name = user.Name
+	info.Result.Title = user.Title
+	info.Result.Email = user.Email
+	info.Result.OrgEmail = user.OrgEmail
+	info.Result.DeptIDList = user.DeptIDs
+	return info
+}
+
+// mergeDeptIDs appends the IDs in add that ids doesn't contain yet
+func mergeDeptIDs(ids Int64List, add []int64) Int64List {
+	for _, id := range add {
+		found := false
+		for _, existing := range ids {
+			if existing == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// mainDept picks a user's main department: the first listed one, or fallback
+func mainDept(deptIDs []int64, fallback int64) int64 {
+	if len(deptIDs) > 0 {
+		return deptIDs[0]
+	}
+	return fallback
+}
@@ -25,6 +25,7 @@ func NewAIHandler(aiService *ai.Service) *AIHandler {
 func (h *AIHandler) GetInsights(c *fiber.Ctx) error {
 	// Parse filter parameters (same as stats endpoint)
 	params := approval.StatsParams{
+		Source:          c.Query("source"),
 		Status:          c.Query("status"),
 		Search:          c.Query("search"),
 		Department:      c.Query("department"),
@@ -1,6 +1,12 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -15,13 +21,15 @@ import (
 type ApprovalHandler struct {
 	service   *approval.Service
 	scheduler *scheduler.Scheduler
+	loc       *time.Location // Time zone of the since date of a manual sync
 }
 
-// NewApprovalHandler creates a new handler
-func NewApprovalHandler(service *approval.Service, scheduler *scheduler.Scheduler) *ApprovalHandler {
+// NewApprovalHandler creates a new handler. A manual sync's since date is midnight in loc.
+func NewApprovalHandler(service *approval.Service, scheduler *scheduler.Scheduler, loc *time.Location) *ApprovalHandler {
 	return &ApprovalHandler{
 		service:   service,
 		scheduler: scheduler,
+		loc:       loc,
 	}
 }
 
@@ -40,6 +48,7 @@ func (h *ApprovalHandler) ListApprovals(c *fiber.Ctx) error {
 	params := approval.ListParams{
 		Page:            page,
 		PageSize:        pageSize,
+		Source:          c.Query("source"),
 		Status:          c.Query("status"),
 		Search:          c.Query("search"),
 		BusinessID:      c.Query("business_id"),
@@ -48,6 +57,12 @@ func (h *ApprovalHandler) ListApprovals(c *fiber.Ctx) error {
 		DilaporkanOleh:  c.Query("dilaporkan_oleh"),
 		Kategori:        c.Query("kategori"),
 		ToTidakTo:       c.Query("to_tidak_to"),
+		Tombstoned:      c.QueryBool("tombstoned"),
+	}
+
+	if needsReview := c.Query("needs_review"); needsReview != "" {
+		flag := needsReview == "true"
+		params.NeedsReview = &flag
 	}
 
 	// Parse date filters
@@ -88,8 +103,9 @@ func (h *ApprovalHandler) ListApprovals(c *fiber.Ctx) error {
 }
 
 // GetFilterOptions handles GET /api/v1/approvals/filter-options
+// Optional query param: source
 func (h *ApprovalHandler) GetFilterOptions(c *fiber.Ctx) error {
-	options, err := h.service.GetFilterOptions(c.Context())
+	options, err := h.service.GetFilterOptions(c.Context(), c.Query("source"))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -105,6 +121,25 @@ func (h *ApprovalHandler) GetFilterOptions(c *fiber.Ctx) error {
 	})
 }
 
+// ListUnmappedFields handles GET /api/v1/approvals/unmapped-fields
+// Optional query param: source
+func (h *ApprovalHandler) ListUnmappedFields(c *fiber.Ctx) error {
+	fields, err := h.service.ListUnmappedFields(c.Context(), c.Query("source"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch unmapped fields",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Unmapped fields fetched successfully",
+		"data":    fields,
+	})
+}
+
 // GetApproval handles GET /api/v1/approvals/:id
 func (h *ApprovalHandler) GetApproval(c *fiber.Ctx) error {
 	idStr := c.Params("id")
@@ -131,10 +166,81 @@ func (h *ApprovalHandler) GetApproval(c *fiber.Ctx) error {
 	})
 }
 
+// GetTimeline handles GET /api/v1/approvals/:id/timeline
+func (h *ApprovalHandler) GetTimeline(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid approval ID",
+		})
+	}
+
+	timeline, err := h.service.GetTimeline(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Approval not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Timeline fetched successfully",
+		"data":    timeline,
+	})
+}
+
+// GetHistory handles GET /api/v1/approvals/:id/history
+// Lists the field changes syncs have made to the NCR, newest first
+func (h *ApprovalHandler) GetHistory(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid approval ID",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	revisions, total, err := h.service.GetHistory(c.Context(), id, page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch approval history",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Approval history fetched successfully",
+		"data": fiber.Map{
+			"revisions": revisions,
+			"pagination": fiber.Map{
+				"page":        page,
+				"page_size":   pageSize,
+				"total":       total,
+				"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+			},
+		},
+	})
+}
+
 // GetStats handles GET /api/v1/approvals/stats
 func (h *ApprovalHandler) GetStats(c *fiber.Ctx) error {
 	// Parse filter parameters
 	params := approval.StatsParams{
+		Source:          c.Query("source"),
 		Status:          c.Query("status"),
 		Search:          c.Query("search"),
 		Department:      c.Query("department"),
@@ -173,8 +279,45 @@ func (h *ApprovalHandler) GetStats(c *fiber.Ctx) error {
 }
 
 // TriggerSync handles POST /api/v1/sync/trigger
+// Optional query params: source (defaults to the first configured source), force=true
+// (re-fetch completed instances), running_only=true, since=YYYY-MM-DD (override the stored watermark)
 func (h *ApprovalHandler) TriggerSync(c *fiber.Ctx) error {
-	syncLog, err := h.scheduler.RunManualSync(c.Context())
+	source, err := h.service.ResolveSource(c.Query("source"))
+	if err != nil {
+		return unknownSource(c, err)
+	}
+
+	opts := approval.SyncOptions{
+		Force:       c.QueryBool("force"),
+		RunningOnly: c.QueryBool("running_only"),
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, h.loc)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid since date, expected YYYY-MM-DD",
+			})
+		}
+		opts.Since = &t
+	}
+
+	job, syncLog, err := h.scheduler.StartManualSync(source.ProcessCode, opts)
+	if errors.Is(err, approval.ErrSyncInProgress) {
+		data := fiber.Map{"sync_log": syncLog}
+		if syncLog != nil {
+			data["job_id"] = syncLog.ID
+		}
+		if job != nil {
+			data["progress"] = job.Latest()
+		}
+		return c.JSON(fiber.Map{
+			"success":     true,
+			"message":     "Sync already in progress",
+			"in_progress": true,
+			"data":        data,
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -183,14 +326,209 @@ func (h *ApprovalHandler) TriggerSync(c *fiber.Ctx) error {
 		})
 	}
 
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "Sync started",
+		"data": fiber.Map{
+			"job_id":   job.ID,
+			"progress": job.Latest(),
+		},
+	})
+}
+
+// unknownSource responds to a request naming a source that isn't configured
+func unknownSource(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"success": false,
+		"message": "Unknown source",
+		"error":   err.Error(),
+	})
+}
+
+// GetSyncJobEvents handles GET /api/v1/sync/jobs/:id/events
+// Streams the job's progress as server-sent events: "progress" events while it runs and a
+// final "done" event carrying the sync log. Jobs running on another replica are followed
+// through the progress stored on their log; finished ones get a single "done" event.
+func (h *ApprovalHandler) GetSyncJobEvents(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid job ID",
+		})
+	}
+
+	job, ok := h.scheduler.SyncJob(id)
+	var stored *approval.SyncLog
+	if !ok {
+		stored, err = h.service.GetSyncLog(c.Context(), id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Sync job not found",
+			})
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if job == nil {
+			h.pollSyncLog(w, stored)
+			return
+		}
+
+		events, unsubscribe := job.Subscribe()
+		defer unsubscribe()
+
+		ping := time.NewTicker(sseKeepAlive)
+		defer ping.Stop()
+
+		for {
+			select {
+			case progress := <-events:
+				if writeSSE(w, "progress", progress) != nil {
+					return // Client went away
+				}
+			case <-ping.C:
+				if _, err := w.WriteString(": ping\n\n"); err != nil || w.Flush() != nil {
+					return
+				}
+			case <-job.Done():
+				syncLog, err := job.Result()
+				done := fiber.Map{"sync_log": syncLog, "progress": job.Latest()}
+				if err != nil {
+					done["error"] = err.Error()
+				}
+				writeSSE(w, "done", done)
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// pollSyncLog streams a sync running on another replica from its stored log, until the log
+// is finished or the sync no longer holds its lock (its replica died)
+func (h *ApprovalHandler) pollSyncLog(w *bufio.Writer, syncLog *approval.SyncLog) {
+	poll := time.NewTicker(syncPollInterval)
+	defer poll.Stop()
+	ping := time.NewTicker(sseKeepAlive)
+	defer ping.Stop()
+
+	var last []byte
+	for {
+		if syncLog.CompletedAt != nil {
+			writeSSE(w, "done", fiber.Map{"sync_log": syncLog, "progress": syncLog.Progress})
+			return
+		}
+		if !h.service.SyncRunning(context.Background(), syncLog) {
+			writeSSE(w, "done", fiber.Map{"sync_log": syncLog, "progress": syncLog.Progress, "error": "sync is no longer running"})
+			return
+		}
+		if syncLog.Progress != nil {
+			// Only send progress that changed since the last poll
+			if payload, _ := json.Marshal(syncLog.Progress); !bytes.Equal(payload, last) {
+				if writeSSE(w, "progress", syncLog.Progress) != nil {
+					return // Client went away
+				}
+				last = payload
+			}
+		}
+
+		select {
+		case <-ping.C:
+			if _, err := w.WriteString(": ping\n\n"); err != nil || w.Flush() != nil {
+				return
+			}
+		case <-poll.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		latest, err := h.service.GetSyncLog(ctx, syncLog.ID)
+		cancel()
+		if err == nil {
+			syncLog = latest
+		}
+	}
+}
+
+// CancelSyncJob handles DELETE /api/v1/sync/jobs/:id
+// A job running on this server is stopped at once and its cancelled log returned. For a job on
+// another replica the request is recorded on its log; that replica stops it within a few
+// seconds, so the response is 202 Accepted.
+func (h *ApprovalHandler) CancelSyncJob(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid job ID",
+		})
+	}
+
+	job, ok := h.scheduler.SyncJob(id)
+	if !ok {
+		syncLog, err := h.service.RequestSyncCancel(c.Context(), id)
+		switch {
+		case errors.Is(err, approval.ErrSyncNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Sync job not found",
+			})
+		case errors.Is(err, approval.ErrSyncNotRunning):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": "Sync job is not running",
+				"data":    syncLog,
+			})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to cancel sync",
+				"error":   err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"success": true,
+			"message": "Sync cancellation requested",
+			"data":    syncLog,
+		})
+	}
+
+	job.Cancel()
+	<-job.Done()
+	syncLog, _ := job.Result()
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": "Sync triggered successfully",
+		"message": "Sync cancelled",
 		"data":    syncLog,
 	})
 }
 
+// sseKeepAlive is how often an idle event stream sends a comment to keep proxies from closing it
+const sseKeepAlive = 15 * time.Second
+
+// syncPollInterval is how often the stored log of a sync running on another replica is re-read
+const syncPollInterval = 2 * time.Second
+
+// writeSSE writes one server-sent event with a JSON payload and flushes it
+func writeSSE(w *bufio.Writer, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
 // ListSyncLogs handles GET /api/v1/sync/logs
+// Optional query param: source
 func (h *ApprovalHandler) ListSyncLogs(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	pageSize, _ := strconv.Atoi(c.Query("page_size", "20"))
@@ -202,7 +540,7 @@ func (h *ApprovalHandler) ListSyncLogs(c *fiber.Ctx) error {
 		pageSize = 20
 	}
 
-	logs, total, err := h.service.ListSyncLogs(c.Context(), page, pageSize)
+	logs, total, err := h.service.ListSyncLogs(c.Context(), c.Query("source"), page, pageSize)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -225,3 +563,209 @@ func (h *ApprovalHandler) ListSyncLogs(c *fiber.Ctx) error {
 		},
 	})
 }
+
+// ListSyncChanges handles GET /api/v1/sync/logs/:id/changes
+// Lists the field changes one sync made, one revision per changed NCR
+func (h *ApprovalHandler) ListSyncChanges(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid sync ID",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	syncLog, err := h.service.GetSyncLog(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Sync log not found",
+		})
+	}
+
+	revisions, total, err := h.service.ListSyncChanges(c.Context(), id, page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch sync changes",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Sync changes fetched successfully",
+		"data": fiber.Map{
+			"sync_log":  syncLog,
+			"revisions": revisions,
+			"pagination": fiber.Map{
+				"page":        page,
+				"page_size":   pageSize,
+				"total":       total,
+				"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+			},
+		},
+	})
+}
+
+// ListReconciliationReports handles GET /api/v1/sync/reconciliations
+// Optional query param: source
+func (h *ApprovalHandler) ListReconciliationReports(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	reports, total, err := h.service.ListReconciliationReports(c.Context(), c.Query("source"), page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch reconciliation reports",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Reconciliation reports fetched successfully",
+		"data": fiber.Map{
+			"reports": reports,
+			"pagination": fiber.Map{
+				"page":        page,
+				"page_size":   pageSize,
+				"total":       total,
+				"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+			},
+		},
+	})
+}
+
+// GetReconciliationReport handles GET /api/v1/sync/reconciliations/:id
+func (h *ApprovalHandler) GetReconciliationReport(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid report ID",
+		})
+	}
+
+	report, err := h.service.GetReconciliationReport(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch reconciliation report",
+			"error":   err.Error(),
+		})
+	}
+	if report == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Reconciliation report not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Reconciliation report fetched successfully",
+		"data":    report,
+	})
+}
+
+// ListSyncFailures handles GET /api/v1/sync/failures
+// Lists instances that failed to sync and are queued for retry
+// Optional query param: source
+func (h *ApprovalHandler) ListSyncFailures(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	failures, total, err := h.service.ListSyncFailures(c.Context(), c.Query("source"), page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch sync failures",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Sync failures fetched successfully",
+		"data": fiber.Map{
+			"failures": failures,
+			"pagination": fiber.Map{
+				"page":        page,
+				"page_size":   pageSize,
+				"total":       total,
+				"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+			},
+		},
+	})
+}
+
+// RetrySyncFailures handles POST /api/v1/sync/failures/retry
+// Body: {"instance_ids": [...]}; without IDs the oldest queued instances are retried
+func (h *ApprovalHandler) RetrySyncFailures(c *fiber.Ctx) error {
+	var body struct {
+		InstanceIDs []string `json:"instance_ids"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid request body",
+			})
+		}
+	}
+
+	results, err := h.service.RetryFailures(c.Context(), body.InstanceIDs)
+	if errors.Is(err, approval.ErrSyncInProgress) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "Sync in progress, retry later",
+			"data":    results,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to retry sync failures",
+			"error":   err.Error(),
+		})
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": fmt.Sprintf("Retried %d instances, %d succeeded", len(results), succeeded),
+		"data":    results,
+	})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	"dingtalk-dashboard/internal/domain/approval"
+	"dingtalk-dashboard/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// AttachmentHandler serves locally stored NCR attachments
+type AttachmentHandler struct {
+	service *approval.Service
+	store   storage.Store
+}
+
+// NewAttachmentHandler creates a new attachment handler
+func NewAttachmentHandler(service *approval.Service, store storage.Store) *AttachmentHandler {
+	return &AttachmentHandler{service: service, store: store}
+}
+
+// GetAttachment handles GET /api/v1/attachments/:id
+func (h *AttachmentHandler) GetAttachment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid attachment ID",
+		})
+	}
+
+	attachment, err := h.service.GetAttachment(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Attachment not found",
+		})
+	}
+
+	if attachment.StorageKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Attachment has not been downloaded yet",
+		})
+	}
+
+	// Stored content never changes, so the checksum is a strong ETag
+	etag := fmt.Sprintf("%q", attachment.Checksum)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	reader, err := h.store.Open(c.Context(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"message": "Attachment content is missing from storage",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to read attachment",
+		})
+	}
+
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = fiber.MIMEOctetStream
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	if attachment.FileName != "" {
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", attachment.FileName))
+	}
+
+	// The stream is closed by fasthttp once the body has been written
+	return c.SendStream(reader, int(attachment.FileSize))
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/domain/approval"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// CallbackHandler receives DingTalk event subscription callbacks
+type CallbackHandler struct {
+	keys    *dingtalk.CallbackKeyring
+	service *approval.Service
+	logger  *zap.Logger
+}
+
+// NewCallbackHandler creates a new callback handler. Callbacks are accepted from every app in
+// keys, and events for the process codes of every configured source.
+func NewCallbackHandler(keys *dingtalk.CallbackKeyring, service *approval.Service, logger *zap.Logger) *CallbackHandler {
+	return &CallbackHandler{
+		keys:    keys,
+		service: service,
+		logger:  logger,
+	}
+}
+
+// HandleEvent handles POST /api/v1/dingtalk/callback
+func (h *CallbackHandler) HandleEvent(c *fiber.Ctx) error {
+	signature := c.Query("msg_signature", c.Query("signature"))
+	timestamp := c.Query("timestamp")
+	nonce := c.Query("nonce")
+
+	var req dingtalk.CallbackRequest
+	if err := c.BodyParser(&req); err != nil || req.Encrypt == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid callback body",
+		})
+	}
+
+	crypto, plain, err := h.keys.Open(signature, timestamp, nonce, req.Encrypt)
+	if errors.Is(err, dingtalk.ErrInvalidSignature) {
+		h.logger.Warn("Rejected DingTalk callback", zap.Error(err))
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid signature",
+		})
+	}
+	if errors.Is(err, dingtalk.ErrStaleTimestamp) {
+		h.logger.Warn("Rejected DingTalk callback", zap.Error(err))
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Stale timestamp",
+		})
+	}
+	if err != nil {
+		h.logger.Warn("Failed to decrypt DingTalk callback", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to decrypt callback",
+		})
+	}
+
+	var event dingtalk.CallbackEvent
+	if err := json.Unmarshal(plain, &event); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid callback event",
+		})
+	}
+
+	h.logger.Info("Received DingTalk callback",
+		zap.String("event_type", event.EventType),
+		zap.String("app", crypto.OwnerKey()),
+		zap.String("process_instance_id", event.ProcessInstanceID),
+		zap.String("type", event.Type))
+
+	switch event.EventType {
+	case dingtalk.EventBpmsInstanceChange, dingtalk.EventBpmsTaskChange:
+		if source, ok := h.service.SourceForProcessCode(event.ProcessCode); ok && event.ProcessInstanceID != "" {
+			// DingTalk expects the ack within a few seconds, so re-fetch in the background
+			go h.refreshInstance(source.ProcessCode, event.ProcessInstanceID)
+		}
+	}
+
+	ack, err := crypto.SuccessResponse(timestamp, nonce)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to build callback response",
+		})
+	}
+
+	return c.JSON(ack)
+}
+
+// refreshInstance re-syncs the instance referenced by a callback event
+func (h *CallbackHandler) refreshInstance(processCode, instanceID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := h.service.SyncInstance(ctx, processCode, instanceID); err != nil {
+		h.logger.Error("Callback instance refresh failed",
+			zap.String("instance_id", instanceID),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/domain/approval"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"go.uber.org/zap"
+)
+
+// newCallbackServer serves a callback handler accepting events signed by crypto
+func newCallbackServer(t *testing.T, crypto *dingtalk.CallbackCrypto) *httptest.Server {
+	t.Helper()
+	// No sources are registered, so no event triggers a refresh and the repository isn't used
+	service := approval.NewService(nil, dingtalk.NewReplaySource(), 1, zap.NewNop())
+	callbackHandler := NewCallbackHandler(dingtalk.NewCallbackKeyring(crypto), service, zap.NewNop())
+
+	app := fiber.New()
+	app.Post("/callback", callbackHandler.HandleEvent)
+	server := httptest.NewServer(adaptor.FiberApp(app))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newCallbackCrypto(t *testing.T, token string, seed byte, ownerKey string) *dingtalk.CallbackCrypto {
+	t.Helper()
+	aesKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{seed}, 32))[:43]
+	crypto, err := dingtalk.NewCallbackCrypto(token, aesKey, ownerKey)
+	if err != nil {
+		t.Fatalf("NewCallbackCrypto: %v", err)
+	}
+	return crypto
+}
+
+func TestCallbackHandlerAcknowledgesSignedEvents(t *testing.T) {
+	crypto := newCallbackCrypto(t, "token", 1, "app-key")
+	server := newCallbackServer(t, crypto)
+
+	for _, event := range []*dingtalk.CallbackEvent{
+		{EventType: dingtalk.EventCheckURL},
+		{EventType: dingtalk.EventBpmsInstanceChange, ProcessInstanceID: "inst-1", ProcessCode: "PROC-UNKNOWN", Type: "finish"},
+	} {
+		ack, err := dingtalk.PostCallbackEvent(context.Background(), server.URL+"/callback", crypto, event)
+		if err != nil {
+			t.Fatalf("%s: %v", event.EventType, err)
+		}
+		if string(ack) != "success" {
+			t.Errorf("%s: ack = %q, want %q", event.EventType, ack, "success")
+		}
+	}
+}
+
+func TestCallbackHandlerRejectsUnknownSigner(t *testing.T) {
+	server := newCallbackServer(t, newCallbackCrypto(t, "token", 1, "app-key"))
+
+	stranger := newCallbackCrypto(t, "other-token", 2, "app-key")
+	_, err := dingtalk.PostCallbackEvent(context.Background(), server.URL+"/callback", stranger, &dingtalk.CallbackEvent{EventType: dingtalk.EventCheckURL})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("event from an unknown app: err = %v, want HTTP 401", err)
+	}
+}
+
+func TestCallbackHandlerRejectsStaleTimestamp(t *testing.T) {
+	crypto := newCallbackCrypto(t, "token", 1, "app-key")
+	server := newCallbackServer(t, crypto)
+
+	// A correctly signed callback replayed an hour later
+	timestamp := strconv.FormatInt(time.Now().Add(-time.Hour).UnixMilli(), 10)
+	sealed, err := crypto.SealMessage([]byte(`{"EventType":"check_url"}`), timestamp, "nonce123")
+	if err != nil {
+		t.Fatalf("SealMessage: %v", err)
+	}
+	query := url.Values{}
+	query.Set("signature", sealed.MsgSignature)
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", sealed.Nonce)
+	body, _ := json.Marshal(dingtalk.CallbackRequest{Encrypt: sealed.Encrypt})
+
+	resp, err := server.Client().Post(server.URL+"/callback?"+query.Encode(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+}
+
+func TestCallbackHandlerRejectsInvalidBody(t *testing.T) {
+	server := newCallbackServer(t, newCallbackCrypto(t, "token", 1, "app-key"))
+
+	resp, err := server.Client().Post(server.URL+"/callback", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+}
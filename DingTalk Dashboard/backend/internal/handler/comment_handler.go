@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/domain/approval"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// maxCommentFileSize is the largest file that can be attached to a comment
+const maxCommentFileSize = 20 << 20
+
+// CommentHandler posts comments to DingTalk on behalf of dashboard users
+type CommentHandler struct {
+	service *approval.Service
+	users   *DingTalkUsers
+}
+
+// NewCommentHandler creates a new comment handler
+func NewCommentHandler(service *approval.Service, users *DingTalkUsers) *CommentHandler {
+	return &CommentHandler{
+		service: service,
+		users:   users,
+	}
+}
+
+// AddComment handles POST /api/v1/approvals/:id/comments
+// Body: JSON {"text": "..."} or multipart form with "text" and an optional "file"
+func (h *CommentHandler) AddComment(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid approval ID",
+		})
+	}
+
+	var body struct {
+		Text string `json:"text" form:"text"`
+	}
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Text) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Comment text is required",
+		})
+	}
+
+	var upload *approval.CommentUpload
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		if fileHeader.Size > maxCommentFileSize {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"success": false,
+				"message": "File is too large (max 20 MB)",
+			})
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to read file",
+			})
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to read file",
+			})
+		}
+		upload = &approval.CommentUpload{Name: fileHeader.Filename, Content: content}
+	}
+
+	userID, ok := h.users.Resolve(c)
+	if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "Your account is not linked to a DingTalk user",
+		})
+	}
+
+	result, err := h.service.AddComment(c.Context(), id, userID, strings.TrimSpace(body.Text), upload)
+	if err != nil {
+		status := fiber.StatusBadGateway
+		message := "DingTalk rejected the comment"
+		switch {
+		case errors.Is(err, approval.ErrApprovalNotFound):
+			status, message = fiber.StatusNotFound, "Approval not found"
+		case errors.Is(err, approval.ErrCommentsUnavailable):
+			status, message = fiber.StatusServiceUnavailable, "Commenting on DingTalk is not available"
+		case errors.Is(err, dingtalk.ErrPermission):
+			status, message = fiber.StatusForbidden, "DingTalk denied the comment"
+		case dingtalk.IsTransient(err):
+			status, message = fiber.StatusServiceUnavailable, "DingTalk is unavailable, try again later"
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+			"error":   err.Error(),
+		})
+	}
+
+	message := "Comment posted"
+	if !result.Refreshed {
+		message = "Comment posted; it will appear after the next sync"
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": message,
+		"data":    result,
+	})
+}
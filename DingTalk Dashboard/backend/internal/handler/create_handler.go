@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"dingtalk-dashboard/internal/dingtalk"
+	"dingtalk-dashboard/internal/domain/approval"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateHandler creates NCRs in DingTalk on behalf of dashboard users
+type CreateHandler struct {
+	service *approval.Service
+	users   *DingTalkUsers
+}
+
+// NewCreateHandler creates a new NCR create handler
+func NewCreateHandler(service *approval.Service, users *DingTalkUsers) *CreateHandler {
+	return &CreateHandler{
+		service: service,
+		users:   users,
+	}
+}
+
+// GetFormSchema handles GET /api/v1/approvals/form-schema
+// Optional query param: source (defaults to the first configured source)
+func (h *CreateHandler) GetFormSchema(c *fiber.Ctx) error {
+	source, err := h.service.ResolveSource(c.Query("source"))
+	if err != nil {
+		return unknownSource(c, err)
+	}
+
+	schema, err := h.service.GetFormSchema(c.Context(), source.ProcessCode)
+	if err != nil {
+		return createError(c, err, "Failed to fetch form schema")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Form schema fetched successfully",
+		"data":    schema,
+	})
+}
+
+// CreateApproval handles POST /api/v1/approvals
+// Body: NCR fields by column name, e.g. {"tanggal": "2026-01-05", "kategori": ["Material"],
+// "nama_project": "..."}. Values are strings or arrays of strings (for multi-select fields).
+// Optional query param: source (defaults to the first configured source)
+func (h *CreateHandler) CreateApproval(c *fiber.Ctx) error {
+	source, err := h.service.ResolveSource(c.Query("source"))
+	if err != nil {
+		return unknownSource(c, err)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil || len(body) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request body",
+		})
+	}
+
+	fields := make(map[string][]string, len(body))
+	for column, raw := range body {
+		var value string
+		if err := json.Unmarshal(raw, &value); err == nil {
+			fields[column] = []string{value}
+			continue
+		}
+		var values []string
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": fmt.Sprintf("Field %s must be a string or an array of strings", column),
+			})
+		}
+		fields[column] = values
+	}
+
+	userID, ok := h.users.Resolve(c)
+	if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "Your account is not linked to a DingTalk user",
+		})
+	}
+
+	result, err := h.service.CreateApproval(c.Context(), source.ProcessCode, userID, fields)
+	if err != nil {
+		var invalid *approval.FormValidationError
+		if errors.As(err, &invalid) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"success": false,
+				"message": "Invalid NCR fields",
+				"errors":  invalid.Fields,
+			})
+		}
+		return createError(c, err, "DingTalk rejected the NCR")
+	}
+
+	message := "NCR created"
+	if !result.Synced {
+		message = "NCR created; it will appear after the next sync"
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": message,
+		"data":    result,
+	})
+}
+
+// createError maps a create or schema failure to a response
+func createError(c *fiber.Ctx, err error, message string) error {
+	status := fiber.StatusBadGateway
+	switch {
+	case errors.Is(err, approval.ErrCreateUnavailable):
+		status, message = fiber.StatusServiceUnavailable, "Creating NCRs in DingTalk is not available"
+	case errors.Is(err, dingtalk.ErrPermission):
+		status, message = fiber.StatusForbidden, "DingTalk denied the request"
+	case dingtalk.IsTransient(err):
+		status, message = fiber.StatusServiceUnavailable, "DingTalk is unavailable, try again later"
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": false,
+		"message": message,
+		"error":   err.Error(),
+	})
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserResolver finds the DingTalk user ID of a dashboard account by email
+type UserResolver interface {
+	UserIDByEmail(ctx context.Context, email string) (string, bool)
+}
+
+// DingTalkUsers maps signed-in dashboard accounts to DingTalk users, for actions taken in
+// DingTalk on their behalf
+type DingTalkUsers struct {
+	resolver  UserResolver      // May be nil when the user directory isn't available
+	overrides map[string]string // Email -> DingTalk user ID
+}
+
+// NewDingTalkUsers creates a user mapping that checks overrides before the resolver
+func NewDingTalkUsers(resolver UserResolver, overrides map[string]string) *DingTalkUsers {
+	return &DingTalkUsers{resolver: resolver, overrides: overrides}
+}
+
+// Resolve returns the DingTalk user ID of the account that made the request, matched by the
+// email in its token
+func (u *DingTalkUsers) Resolve(c *fiber.Ctx) (string, bool) {
+	email, _ := c.Locals("email").(string)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", false
+	}
+	for mapped, userID := range u.overrides {
+		if strings.ToLower(mapped) == email {
+			return userID, true
+		}
+	}
+	if u.resolver == nil {
+		return "", false
+	}
+	return u.resolver.UserIDByEmail(c.Context(), email)
+}
@@ -25,6 +25,7 @@ func NewExportHandler(service *approval.Service) *ExportHandler {
 func (h *ExportHandler) ExportApprovals(c *fiber.Ctx) error {
 	// Parse filter parameters (same as list approvals)
 	params := approval.ListParams{
+		Source:          c.Query("source"),
 		Search:          c.Query("search"),
 		BusinessID:      c.Query("business_id"),
 		Status:          c.Query("status"),
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"dingtalk-dashboard/internal/lease"
+	"dingtalk-dashboard/internal/scheduler"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JobHandler handles the scheduled job admin endpoints
+type JobHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(scheduler *scheduler.Scheduler) *JobHandler {
+	return &JobHandler{scheduler: scheduler}
+}
+
+// jobError maps scheduler errors to responses
+func jobError(c *fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		status = fiber.StatusNotFound
+		message = "Job not found"
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, scheduler.ErrJobRunning):
+		status = fiber.StatusConflict
+		message = "Job is already running"
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": false,
+		"message": message,
+		"error":   err.Error(),
+	})
+}
+
+// ListJobs handles GET /api/v1/jobs
+// Also reports which replica is the scheduler leader and whether it is the one answering.
+func (h *JobHandler) ListJobs(c *fiber.Ctx) error {
+	jobs, err := h.scheduler.Jobs(c.Context())
+	if err != nil {
+		return jobError(c, err, "Failed to fetch jobs")
+	}
+	leader, err := h.scheduler.Leader(c.Context())
+	if err != nil {
+		return jobError(c, err, "Failed to fetch scheduler leader")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Jobs fetched successfully",
+		"data":    jobs,
+		"scheduler": fiber.Map{
+			"instance":  lease.InstanceID(),
+			"leader":    leader,
+			"is_leader": h.scheduler.IsLeader(),
+		},
+	})
+}
+
+// ListJobRuns handles GET /api/v1/jobs/:name/runs
+func (h *JobHandler) ListJobRuns(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	runs, total, err := h.scheduler.Runs(c.Context(), c.Params("name"), page, pageSize)
+	if err != nil {
+		return jobError(c, err, "Failed to fetch job runs")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Job runs fetched successfully",
+		"data": fiber.Map{
+			"runs": runs,
+			"pagination": fiber.Map{
+				"page":        page,
+				"page_size":   pageSize,
+				"total":       total,
+				"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+			},
+		},
+	})
+}
+
+// UpdateJobSchedule handles PUT /api/v1/jobs/:name/schedule
+// Body: {"schedule": "<cron spec>"}; an empty schedule restores the configured or default one
+func (h *JobHandler) UpdateJobSchedule(c *fiber.Ctx) error {
+	var body struct {
+		Schedule string `json:"schedule"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request body",
+		})
+	}
+
+	job, err := h.scheduler.SetSchedule(c.Context(), c.Params("name"), body.Schedule)
+	if err != nil {
+		return jobError(c, err, "Failed to update schedule")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Schedule updated",
+		"data":    job,
+	})
+}
+
+// PauseJob handles POST /api/v1/jobs/:name/pause
+func (h *JobHandler) PauseJob(c *fiber.Ctx) error {
+	job, err := h.scheduler.Pause(c.Context(), c.Params("name"))
+	if err != nil {
+		return jobError(c, err, "Failed to pause job")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Job paused",
+		"data":    job,
+	})
+}
+
+// ResumeJob handles POST /api/v1/jobs/:name/resume
+func (h *JobHandler) ResumeJob(c *fiber.Ctx) error {
+	job, err := h.scheduler.Resume(c.Context(), c.Params("name"))
+	if err != nil {
+		return jobError(c, err, "Failed to resume job")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Job resumed",
+		"data":    job,
+	})
+}
+
+// RunJob handles POST /api/v1/jobs/:name/run
+// Starts the job in the background, even if it is paused; the response carries the run to poll.
+func (h *JobHandler) RunJob(c *fiber.Ctx) error {
+	run, err := h.scheduler.RunNow(c.Params("name"))
+	if err != nil {
+		return jobError(c, err, "Failed to start job")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "Job started",
+		"data":    run,
+	})
+}
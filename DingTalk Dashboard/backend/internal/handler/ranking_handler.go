@@ -22,6 +22,7 @@ func NewRankingHandler(service *ranking.Service) *RankingHandler {
 // parseRankingFilters extracts filter params from request
 func parseRankingFilters(c *fiber.Ctx) ranking.RankingFilters {
 	filters := ranking.RankingFilters{
+		Source:          c.Query("source"),
 		Department:      c.Query("department"),
 		Kategori:        c.Query("kategori"),
 		DitujukanKepada: c.Query("ditujukan_kepada"),
@@ -53,14 +54,26 @@ func (h *RankingHandler) GetProblemRanking(c *fiber.Ctx) error {
 	// Check if debug mode is requested
 	debug := c.Query("debug") == "true"
 
-	// Get top 6 problems with optional stats
-	problems, stats, err := h.service.GetTopProblemsWithStats(c.Context(), 6, filters)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to get problem ranking",
-			"error":   err.Error(),
-		})
+	// Unfiltered requests are served from the precomputed snapshot while it is fresh
+	var (
+		problems   []ranking.RankedProblem
+		stats      *ranking.ClusterStats
+		computedAt *time.Time
+		cached     bool
+	)
+	if filters.IsEmpty() {
+		problems, stats, computedAt, cached = h.service.CachedTopProblems(c.Context())
+	}
+	if !cached {
+		var err error
+		problems, stats, err = h.service.GetTopProblemsWithStats(c.Context(), ranking.TopProblemsLimit, filters)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to get problem ranking",
+				"error":   err.Error(),
+			})
+		}
 	}
 
 	// Log stats to console
@@ -75,6 +88,10 @@ func (h *RankingHandler) GetProblemRanking(c *fiber.Ctx) error {
 		"data":    problems,
 	}
 
+	if computedAt != nil {
+		response["computed_at"] = computedAt
+	}
+
 	// Include stats in response if debug mode
 	if debug && stats != nil {
 		response["algorithm_stats"] = stats
@@ -87,14 +104,22 @@ func (h *RankingHandler) GetProblemRanking(c *fiber.Ctx) error {
 func (h *RankingHandler) GetWordCloud(c *fiber.Ctx) error {
 	filters := parseRankingFilters(c)
 
-	// Get word frequencies for word cloud (top 30 words)
-	wordFreqs, err := h.service.GetWordCloud(c.Context(), 30, filters)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to get word cloud data",
-			"error":   err.Error(),
-		})
+	// Get word frequencies for word cloud (top 30 words), precomputed when unfiltered
+	var wordFreqs []ranking.WordFrequency
+	cached := false
+	if filters.IsEmpty() {
+		wordFreqs, cached = h.service.CachedWordCloud(c.Context())
+	}
+	if !cached {
+		var err error
+		wordFreqs, err = h.service.GetWordCloud(c.Context(), ranking.WordCloudLimit, filters)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Failed to get word cloud data",
+				"error":   err.Error(),
+			})
+		}
 	}
 
 	return c.JSON(fiber.Map{
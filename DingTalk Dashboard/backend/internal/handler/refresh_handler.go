@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+
+	"dingtalk-dashboard/internal/domain/approval"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RefreshHandler re-fetches single NCRs or small batches from DingTalk on request
+type RefreshHandler struct {
+	service *approval.Service
+}
+
+// NewRefreshHandler creates a new refresh handler
+func NewRefreshHandler(service *approval.Service) *RefreshHandler {
+	return &RefreshHandler{service: service}
+}
+
+// RefreshApproval handles POST /api/v1/approvals/:id/refresh
+func (h *RefreshHandler) RefreshApproval(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid approval ID",
+		})
+	}
+
+	result, err := h.service.RefreshApproval(c.Context(), id)
+	if errors.Is(err, approval.ErrApprovalNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Approval not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to refresh approval",
+			"error":   err.Error(),
+		})
+	}
+	if !result.Success {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch the instance from DingTalk",
+			"error":   result.Error,
+			"data":    result,
+		})
+	}
+
+	message := "Approval refreshed, no changes"
+	if len(result.Changes) > 0 {
+		message = "Approval refreshed"
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": message,
+		"data":    result,
+	})
+}
+
+// RefreshInstances handles POST /api/v1/sync/instances
+// Body: {"instance_ids": [...], "source": "..."}, where each entry is a process instance ID or a
+// business ID and source defaults to the first configured source
+func (h *RefreshHandler) RefreshInstances(c *fiber.Ctx) error {
+	var body struct {
+		InstanceIDs []string `json:"instance_ids"`
+		Source      string   `json:"source"`
+	}
+	if err := c.BodyParser(&body); err != nil || len(body.InstanceIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "instance_ids is required",
+		})
+	}
+
+	source, err := h.service.ResolveSource(body.Source)
+	if err != nil {
+		return unknownSource(c, err)
+	}
+
+	results, err := h.service.RefreshInstances(c.Context(), source.ProcessCode, body.InstanceIDs)
+	if errors.Is(err, approval.ErrTooManyInstances) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to refresh instances",
+			"error":   err.Error(),
+		})
+	}
+
+	var succeeded, created, changed, failed int
+	for _, result := range results {
+		switch {
+		case !result.Success:
+			failed++
+		case result.Created:
+			succeeded++
+			created++
+		default:
+			succeeded++
+			if len(result.Changes) > 0 {
+				changed++
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Instances refreshed",
+		"data": fiber.Map{
+			"summary": fiber.Map{
+				"requested": len(results),
+				"succeeded": succeeded,
+				"created":   created,
+				"changed":   changed,
+				"failed":    failed,
+			},
+			"results": results,
+		},
+	})
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"strconv"
+
+	"dingtalk-dashboard/internal/report"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ReportHandler serves generated report digests
+type ReportHandler struct {
+	service *report.Service
+}
+
+// NewReportHandler creates a new report handler
+func NewReportHandler(service *report.Service) *ReportHandler {
+	return &ReportHandler{service: service}
+}
+
+// ListDigests handles GET /api/v1/reports/digests
+func (h *ReportHandler) ListDigests(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	pageSize, _ := strconv.Atoi(c.Query("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	digests, total, err := h.service.ListDigests(c.Context(), page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch report digests",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Report digests fetched successfully",
+		"data": fiber.Map{
+			"digests": digests,
+			"pagination": fiber.Map{
+				"page":        page,
+				"page_size":   pageSize,
+				"total":       total,
+				"total_pages": (total + int64(pageSize) - 1) / int64(pageSize),
+			},
+		},
+	})
+}
+
+// GetDigest handles GET /api/v1/reports/digests/:id
+func (h *ReportHandler) GetDigest(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid digest ID",
+		})
+	}
+
+	digest, err := h.service.GetDigest(c.Context(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Failed to fetch report digest",
+			"error":   err.Error(),
+		})
+	}
+	if digest == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Report digest not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Report digest fetched successfully",
+		"data":    digest,
+	})
+}
@@ -0,0 +1,149 @@
+// Package lease implements named, expiring locks in Postgres that are shared by every
+// server replica. A holder must renew its lease before it expires; a lease whose holder
+// crashed simply runs out and can be taken by someone else.
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Lease is a row of the leases table
+type Lease struct {
+	Name       string    `gorm:"primaryKey;size:200" json:"name"`
+	Holder     string    `gorm:"size:200;not null" json:"holder"`
+	Meta       string    `gorm:"type:text" json:"meta"` // Free-form data for other replicas, e.g. the running sync ID
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (Lease) TableName() string {
+	return "leases"
+}
+
+// instanceID identifies this process among the replicas
+var instanceID = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}()
+
+// InstanceID returns the identity of this server process
+func InstanceID() string {
+	return instanceID
+}
+
+// Manager acquires, renews and releases leases
+type Manager struct {
+	db *gorm.DB
+}
+
+// NewManager creates a lease manager
+func NewManager(db *gorm.DB) *Manager {
+	return &Manager{db: db}
+}
+
+// TryAcquire takes the lease for holder if it is free or expired. Returns false if another
+// holder (or an earlier call with the same holder) still has it. Expiry uses the database clock,
+// so replicas with skewed clocks agree.
+func (m *Manager) TryAcquire(ctx context.Context, name, holder, meta string, ttl time.Duration) (bool, error) {
+	result := m.db.WithContext(ctx).Exec(`
+		INSERT INTO leases (name, holder, meta, acquired_at, renewed_at, expires_at)
+		VALUES (?, ?, ?, NOW(), NOW(), NOW() + make_interval(secs => ?))
+		ON CONFLICT (name) DO UPDATE SET
+			holder = EXCLUDED.holder,
+			meta = EXCLUDED.meta,
+			acquired_at = EXCLUDED.acquired_at,
+			renewed_at = EXCLUDED.renewed_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE leases.expires_at < NOW()`,
+		name, holder, meta, ttl.Seconds())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Renew extends a lease held by holder. Returns false if the lease was lost to another holder.
+func (m *Manager) Renew(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	result := m.db.WithContext(ctx).Exec(`
+		UPDATE leases SET renewed_at = NOW(), expires_at = NOW() + make_interval(secs => ?)
+		WHERE name = ? AND holder = ?`,
+		ttl.Seconds(), name, holder)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Release gives up a lease held by holder
+func (m *Manager) Release(ctx context.Context, name, holder string) error {
+	return m.db.WithContext(ctx).
+		Where("name = ? AND holder = ?", name, holder).
+		Delete(&Lease{}).Error
+}
+
+// Get returns the unexpired lease with the given name, or nil if it is free
+func (m *Manager) Get(ctx context.Context, name string) (*Lease, error) {
+	var lease Lease
+	err := m.db.WithContext(ctx).
+		Where("name = ? AND expires_at >= NOW()", name).
+		First(&lease).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// DeleteExpired removes leases that expired before the cutoff
+func (m *Manager) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := m.db.WithContext(ctx).
+		Where("expires_at < ?", cutoff).
+		Delete(&Lease{})
+	return result.RowsAffected, result.Error
+}
+
+// Keep renews a held lease every ttl/3 until ctx is done, then releases it. If the lease
+// is lost (taken over, or not renewed within ttl), onLost is called once and renewal stops.
+func (m *Manager) Keep(ctx context.Context, name, holder string, ttl time.Duration, onLost func()) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			m.Release(releaseCtx, name, holder)
+			cancel()
+			return
+		case <-ticker.C:
+			renewed, err := m.Renew(ctx, name, holder, ttl)
+			if err != nil {
+				// A transient database error is retried on the next tick while the lease is still valid
+				if time.Since(renewedAt) < ttl {
+					continue
+				}
+				onLost()
+				return
+			}
+			if !renewed {
+				onLost()
+				return
+			}
+			renewedAt = time.Now()
+		}
+	}
+}
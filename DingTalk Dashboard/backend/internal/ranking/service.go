@@ -27,6 +27,7 @@ func NewService(db *gorm.DB) *Service {
 
 // RankingFilters contains all filter parameters
 type RankingFilters struct {
+	Source          string
 	Department      string
 	Kategori        string
 	DitujukanKepada string
@@ -53,10 +54,14 @@ func (NCRApprovalForRanking) TableName() string {
 	return "ncr_approvals"
 }
 
-// applyFilters adds WHERE clauses based on filter params
+// applyFilters adds WHERE clauses based on filter params. NCRs removed from DingTalk are left out.
 func (s *Service) applyFilters(query *gorm.DB, filters RankingFilters) *gorm.DB {
+	query = query.Where("tombstoned_at IS NULL")
+	if filters.Source != "" {
+		query = query.Where("source = ?", filters.Source)
+	}
 	if filters.Department != "" {
-		query = query.Where("originator_dept_name ILIKE ?", "%"+filters.Department+"%")
+		query = query.Where("(originator_dept_name ILIKE ? OR originator_dept_path ILIKE ?)", "%"+filters.Department+"%", "%"+filters.Department+"%")
 	}
 	if filters.Kategori != "" {
 		query = query.Where("kategori ILIKE ?", "%"+filters.Kategori+"%")
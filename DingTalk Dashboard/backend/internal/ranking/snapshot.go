@@ -0,0 +1,126 @@
+package ranking
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// TopProblemsLimit is how many problem clusters the dashboard shows
+	TopProblemsLimit = 6
+	// WordCloudLimit is how many words the dashboard word cloud shows
+	WordCloudLimit = 30
+
+	// defaultSnapshot names the snapshot of the unfiltered ranking
+	defaultSnapshot = "default"
+	// snapshotMaxAge is how long a snapshot is served; older ones (e.g. while the precompute
+	// job is paused) fall back to computing on request
+	snapshotMaxAge = 6 * time.Hour
+)
+
+// Snapshot is a precomputed ranking, so the unfiltered dashboard doesn't recluster every NCR per request
+type Snapshot struct {
+	Name       string          `gorm:"primaryKey;size:100" json:"name"`
+	Problems   json.RawMessage `gorm:"type:jsonb" json:"problems"`
+	Stats      json.RawMessage `gorm:"type:jsonb" json:"stats"`
+	WordCloud  json.RawMessage `gorm:"type:jsonb" json:"word_cloud"`
+	ComputedAt time.Time       `json:"computed_at"`
+}
+
+func (Snapshot) TableName() string {
+	return "ranking_snapshots"
+}
+
+// PrecomputeResult summarizes a precompute run
+type PrecomputeResult struct {
+	Problems   int       `json:"problems"`
+	Clusters   int       `json:"clusters"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// IsEmpty reports whether no filter is set
+func (f RankingFilters) IsEmpty() bool {
+	return f == RankingFilters{}
+}
+
+// Precompute computes the unfiltered ranking and word cloud and stores them as the default snapshot
+func (s *Service) Precompute(ctx context.Context) (*PrecomputeResult, error) {
+	problems, stats, err := s.GetTopProblemsWithStats(ctx, TopProblemsLimit, RankingFilters{})
+	if err != nil {
+		return nil, err
+	}
+	words, err := s.GetWordCloud(ctx, WordCloudLimit, RankingFilters{})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{Name: defaultSnapshot, ComputedAt: time.Now()}
+	if snapshot.Problems, err = json.Marshal(problems); err != nil {
+		return nil, err
+	}
+	if snapshot.Stats, err = json.Marshal(stats); err != nil {
+		return nil, err
+	}
+	if snapshot.WordCloud, err = json.Marshal(words); err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"problems", "stats", "word_cloud", "computed_at"}),
+	}).Create(&snapshot).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrecomputeResult{
+		Problems:   stats.TotalProblems,
+		Clusters:   stats.ClusterCount,
+		ComputedAt: snapshot.ComputedAt,
+	}, nil
+}
+
+// loadSnapshot returns the default snapshot if it is fresh; nil otherwise
+func (s *Service) loadSnapshot(ctx context.Context) *Snapshot {
+	var snapshot Snapshot
+	err := s.db.WithContext(ctx).
+		Where("name = ? AND computed_at > ?", defaultSnapshot, time.Now().Add(-snapshotMaxAge)).
+		First(&snapshot).Error
+	if err != nil {
+		// Missing, stale or unreadable: the caller computes the ranking live
+		return nil
+	}
+	return &snapshot
+}
+
+// CachedTopProblems returns the precomputed unfiltered ranking; ok is false if there is no fresh snapshot
+func (s *Service) CachedTopProblems(ctx context.Context) ([]RankedProblem, *ClusterStats, *time.Time, bool) {
+	snapshot := s.loadSnapshot(ctx)
+	if snapshot == nil {
+		return nil, nil, nil, false
+	}
+
+	var problems []RankedProblem
+	var stats ClusterStats
+	if json.Unmarshal(snapshot.Problems, &problems) != nil || json.Unmarshal(snapshot.Stats, &stats) != nil {
+		return nil, nil, nil, false
+	}
+	return problems, &stats, &snapshot.ComputedAt, true
+}
+
+// CachedWordCloud returns the precomputed unfiltered word cloud; ok is false if there is no fresh snapshot
+func (s *Service) CachedWordCloud(ctx context.Context) ([]WordFrequency, bool) {
+	snapshot := s.loadSnapshot(ctx)
+	if snapshot == nil {
+		return nil, false
+	}
+
+	var words []WordFrequency
+	if json.Unmarshal(snapshot.WordCloud, &words) != nil {
+		return nil, false
+	}
+	return words, true
+}
@@ -0,0 +1,36 @@
+package report
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PeriodWeekly is a Monday-to-Monday digest period in the server's timezone
+const PeriodWeekly = "weekly"
+
+// Digest summarizes NCR activity over one period
+type Digest struct {
+	ID              uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Period          string          `gorm:"size:20;not null" json:"period"`
+	PeriodStart     time.Time       `gorm:"not null" json:"period_start"`
+	PeriodEnd       time.Time       `gorm:"not null" json:"period_end"`
+	CreatedCount    int64           `json:"created_count"`                  // NCRs raised in the period
+	CompletedCount  int64           `json:"completed_count"`                // NCRs approved in the period
+	TerminatedCount int64           `json:"terminated_count"`               // NCRs rejected or withdrawn in the period
+	OpenCount       int64           `json:"open_count"`                     // NCRs still running when the digest was generated
+	Departments     json.RawMessage `gorm:"type:jsonb" json:"departments"`  // NCRs raised per originator department
+	TopProblems     json.RawMessage `gorm:"type:jsonb" json:"top_problems"` // Problem ranking over the period
+	GeneratedAt     time.Time       `json:"generated_at"`
+}
+
+func (Digest) TableName() string {
+	return "report_digests"
+}
+
+// DepartmentCount is the number of NCRs raised by one department
+type DepartmentCount struct {
+	Department string `json:"department"`
+	Count      int64  `json:"count"`
+}
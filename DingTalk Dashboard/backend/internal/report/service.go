@@ -0,0 +1,157 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"dingtalk-dashboard/internal/ranking"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// digestDepartments is how many departments a digest lists
+const digestDepartments = 10
+
+// Service generates and serves report digests
+type Service struct {
+	db      *gorm.DB
+	ranking *ranking.Service
+	loc     *time.Location
+	logger  *zap.Logger
+}
+
+// NewService creates a report service. Digest periods start at midnight in loc.
+func NewService(db *gorm.DB, rankingService *ranking.Service, loc *time.Location, logger *zap.Logger) *Service {
+	return &Service{
+		db:      db,
+		ranking: rankingService,
+		loc:     loc,
+		logger:  logger,
+	}
+}
+
+// GenerateWeekly builds the digest of the last full week before now. Regenerating a week
+// replaces its digest.
+func (s *Service) GenerateWeekly(ctx context.Context, now time.Time) (*Digest, error) {
+	local := now.In(s.loc)
+	daysSinceMonday := (int(local.Weekday()) + 6) % 7
+	end := time.Date(local.Year(), local.Month(), local.Day()-daysSinceMonday, 0, 0, 0, 0, s.loc)
+	start := end.AddDate(0, 0, -7)
+	return s.Generate(ctx, PeriodWeekly, start, end)
+}
+
+// Generate builds and stores the digest of [start, end)
+func (s *Service) Generate(ctx context.Context, period string, start, end time.Time) (*Digest, error) {
+	// The ID is left to the database so an upsert returns the existing digest's ID
+	digest := &Digest{
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: time.Now(),
+	}
+
+	// NCRs removed from DingTalk don't count
+	approvals := func() *gorm.DB {
+		return s.db.WithContext(ctx).Table("ncr_approvals").Where("tombstoned_at IS NULL")
+	}
+	if err := approvals().
+		Where("dingtalk_create_time >= ? AND dingtalk_create_time < ?", start, end).
+		Count(&digest.CreatedCount).Error; err != nil {
+		return nil, err
+	}
+	if err := approvals().
+		Where("status = ? AND dingtalk_finish_time >= ? AND dingtalk_finish_time < ?", "COMPLETED", start, end).
+		Count(&digest.CompletedCount).Error; err != nil {
+		return nil, err
+	}
+	if err := approvals().
+		Where("status IN ? AND dingtalk_finish_time >= ? AND dingtalk_finish_time < ?", []string{"TERMINATED", "CANCELED"}, start, end).
+		Count(&digest.TerminatedCount).Error; err != nil {
+		return nil, err
+	}
+	if err := approvals().Where("status = ?", "RUNNING").Count(&digest.OpenCount).Error; err != nil {
+		return nil, err
+	}
+
+	var departments []DepartmentCount
+	if err := approvals().
+		Select("COALESCE(NULLIF(originator_dept_name, ''), '-') AS department, COUNT(*) AS count").
+		Where("dingtalk_create_time >= ? AND dingtalk_create_time < ?", start, end).
+		Group("1").
+		Order("count DESC").
+		Limit(digestDepartments).
+		Scan(&departments).Error; err != nil {
+		return nil, err
+	}
+
+	// Ranking filters are inclusive and work on the NCR date
+	lastDay := end.Add(-time.Second)
+	problems, err := s.ranking.GetTopProblemsFiltered(ctx, ranking.TopProblemsLimit, ranking.RankingFilters{
+		StartDate: &start,
+		EndDate:   &lastDay,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if digest.Departments, err = json.Marshal(departments); err != nil {
+		return nil, err
+	}
+	if digest.TopProblems, err = json.Marshal(problems); err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "period"}, {Name: "period_start"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"period_end", "created_count", "completed_count", "terminated_count", "open_count",
+			"departments", "top_problems", "generated_at",
+		}),
+	}).Create(digest).Error
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Report digest generated",
+		zap.String("period", period),
+		zap.Time("start", start),
+		zap.Int64("created", digest.CreatedCount),
+		zap.Int64("completed", digest.CompletedCount))
+
+	return digest, nil
+}
+
+// ListDigests returns digests, newest period first
+func (s *Service) ListDigests(ctx context.Context, page, pageSize int) ([]Digest, int64, error) {
+	var digests []Digest
+	var total int64
+
+	query := s.db.WithContext(ctx).Model(&Digest{})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("period_start DESC").Offset(offset).Limit(pageSize).Find(&digests).Error; err != nil {
+		return nil, 0, err
+	}
+	return digests, total, nil
+}
+
+// GetDigest returns a digest by ID; nil if not found
+func (s *Service) GetDigest(ctx context.Context, id uuid.UUID) (*Digest, error) {
+	var digest Digest
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&digest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &digest, nil
+}
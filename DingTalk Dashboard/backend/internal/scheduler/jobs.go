@@ -0,0 +1,221 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"dingtalk-dashboard/internal/domain/approval"
+	"dingtalk-dashboard/internal/domain/directory"
+	"dingtalk-dashboard/internal/lease"
+	"dingtalk-dashboard/internal/ranking"
+	"dingtalk-dashboard/internal/report"
+)
+
+// Built-in job names, as used in JOB_SCHEDULES and the job endpoints
+const (
+	JobApprovalSync       = "approval_sync"
+	JobAttachmentDownload = "attachment_download"
+	JobDirectoryRefresh   = "directory_refresh"
+	JobRankingPrecompute  = "ranking_precompute"
+	JobReportDigest       = "report_digest"
+	JobRetentionCleanup   = "retention_cleanup"
+	JobReconciliation     = "reconciliation"
+)
+
+// reconcileLookback is how far back reconciliation compares instances
+const reconcileLookback = 180 * 24 * time.Hour
+
+// ApprovalSyncJob syncs approvals of every configured source from DingTalk, one sync per source
+func ApprovalSyncJob(service *approval.Service) Job {
+	return Job{
+		Name:        JobApprovalSync,
+		Description: "Sync NCR approvals from DingTalk",
+		Schedule:    "0 8,11,13,16,18 * * *", // 8AM, 11AM, 1PM, 4PM, 6PM daily
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) (interface{}, error) {
+			return forEachSource(ctx, service, "another sync is in progress", func(ctx context.Context, source approval.Source) (interface{}, error) {
+				syncLog, err := service.SyncApprovals(ctx, source.ProcessCode, "scheduled")
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{
+					"sync_id":   syncLog.ID,
+					"processed": syncLog.RecordsProcessed,
+					"created":   syncLog.RecordsCreated,
+					"updated":   syncLog.RecordsUpdated,
+					"skipped":   syncLog.RecordsSkipped,
+				}, nil
+			})
+		},
+	}
+}
+
+// ReconciliationJob compares recent instances in DingTalk with stored NCRs of every configured
+// source, tombstoning ones that were deleted and re-checking revoked ones
+func ReconciliationJob(service *approval.Service) Job {
+	return Job{
+		Name:        JobReconciliation,
+		Description: "Reconcile stored NCRs with DingTalk and report deleted or changed instances",
+		Schedule:    "0 3 * * 0", // Sunday 3AM
+		Timeout:     2 * time.Hour,
+		Run: func(ctx context.Context) (interface{}, error) {
+			end := time.Now()
+			return forEachSource(ctx, service, "a sync is in progress", func(ctx context.Context, source approval.Source) (interface{}, error) {
+				report, err := service.Reconcile(ctx, source.ProcessCode, end.Add(-reconcileLookback), end)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{
+					"report_id":      report.ID,
+					"listed":         report.Listed,
+					"stored":         report.Stored,
+					"added":          report.Added,
+					"tombstoned":     report.Tombstoned,
+					"restored":       report.Restored,
+					"unlisted":       report.Unlisted,
+					"status_changed": report.StatusChanged,
+					"errors":         report.Errors,
+				}, nil
+			})
+		},
+	}
+}
+
+// forEachSource runs fn for every configured source and returns the results by source name.
+// A source whose sync is in progress is skipped; the run is only skipped if all of them were.
+// Failures of one source don't stop the others and are returned together.
+func forEachSource(ctx context.Context, service *approval.Service, busy string, fn func(ctx context.Context, source approval.Source) (interface{}, error)) (interface{}, error) {
+	sources := service.Sources()
+	results := make(map[string]interface{}, len(sources))
+	var errs []error
+	skipped := 0
+
+	for _, source := range sources {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		result, err := fn(ctx, source)
+		switch {
+		case errors.Is(err, approval.ErrSyncInProgress):
+			skipped++
+			results[source.Name] = map[string]interface{}{"skipped": busy}
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name, err))
+			results[source.Name] = map[string]interface{}{"error": err.Error()}
+		default:
+			results[source.Name] = result
+		}
+	}
+
+	if len(sources) > 0 && skipped == len(sources) {
+		return nil, fmt.Errorf("%w: %s", ErrSkipped, busy)
+	}
+	return results, errors.Join(errs...)
+}
+
+// AttachmentDownloadJob copies new attachments to storage before their DingTalk links expire
+func AttachmentDownloadJob(downloader *approval.AttachmentDownloader) Job {
+	return Job{
+		Name:        JobAttachmentDownload,
+		Description: "Download new NCR attachments into attachment storage",
+		Schedule:    "*/30 * * * *",
+		Timeout:     25 * time.Minute,
+		Run: func(ctx context.Context) (interface{}, error) {
+			return downloader.Run(ctx)
+		},
+	}
+}
+
+// DirectoryRefreshJob re-crawls the user directory once its TTL has passed and applies it to stored NCRs
+func DirectoryRefreshJob(dir *directory.Service, service *approval.Service) Job {
+	return Job{
+		Name:        JobDirectoryRefresh,
+		Description: "Refresh the DingTalk user and department directory",
+		Schedule:    "@hourly",
+		Timeout:     30 * time.Minute,
+		RunOnStart:  true,
+		Run: func(ctx context.Context) (interface{}, error) {
+			result, err := dir.Refresh(ctx, false)
+			if err != nil {
+				return nil, err
+			}
+			if result.Skipped {
+				return nil, fmt.Errorf("%w: directory is still within its TTL", ErrSkipped)
+			}
+			if err := service.ApplyDirectory(ctx); err != nil {
+				return result, fmt.Errorf("apply directory: %w", err)
+			}
+			return result, nil
+		},
+	}
+}
+
+// RankingPrecomputeJob stores the unfiltered problem ranking and word cloud for the dashboard
+func RankingPrecomputeJob(rankingService *ranking.Service) Job {
+	return Job{
+		Name:        JobRankingPrecompute,
+		Description: "Precompute the unfiltered problem ranking and word cloud",
+		Schedule:    "15 * * * *",
+		Timeout:     15 * time.Minute,
+		RunOnStart:  true,
+		Run: func(ctx context.Context) (interface{}, error) {
+			return rankingService.Precompute(ctx)
+		},
+	}
+}
+
+// ReportDigestJob generates the digest of the previous week
+func ReportDigestJob(reports *report.Service) Job {
+	return Job{
+		Name:        JobReportDigest,
+		Description: "Generate the weekly NCR report digest",
+		Schedule:    "0 7 * * 1", // Monday 7AM, for the week before
+		Timeout:     15 * time.Minute,
+		Run: func(ctx context.Context) (interface{}, error) {
+			digest, err := reports.GenerateWeekly(ctx, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"digest_id":    digest.ID,
+				"period_start": digest.PeriodStart,
+				"period_end":   digest.PeriodEnd,
+			}, nil
+		},
+	}
+}
+
+// RetentionCleanupJob deletes sync logs and job runs older than retention, and long-expired leases
+func RetentionCleanupJob(service *approval.Service, repo *Repository, leases *lease.Manager, retention time.Duration) Job {
+	return Job{
+		Name:        JobRetentionCleanup,
+		Description: "Delete old sync logs, job runs and expired leases",
+		Schedule:    "30 2 * * *",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) (interface{}, error) {
+			cutoff := time.Now().Add(-retention)
+			result := map[string]int64{}
+
+			deleted, err := service.DeleteSyncLogsBefore(ctx, cutoff)
+			if err != nil {
+				return result, fmt.Errorf("sync logs: %w", err)
+			}
+			result["sync_logs"] = deleted
+
+			if deleted, err = repo.DeleteRunsBefore(ctx, cutoff); err != nil {
+				return result, fmt.Errorf("job runs: %w", err)
+			}
+			result["job_runs"] = deleted
+
+			if deleted, err = leases.DeleteExpired(ctx, time.Now().Add(-24*time.Hour)); err != nil {
+				return result, fmt.Errorf("leases: %w", err)
+			}
+			result["leases"] = deleted
+
+			return result, nil
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job run statuses
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunSkipped   = "skipped"
+)
+
+// Job run triggers
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+	TriggerStartup   = "startup"
+)
+
+// Schedule sources, from lowest to highest precedence
+const (
+	SourceDefault  = "default"
+	SourceConfig   = "config"
+	SourceDatabase = "database"
+)
+
+// JobSetting holds the admin overrides for a job. An empty schedule means the configured
+// or default schedule applies.
+type JobSetting struct {
+	Name      string    `gorm:"primaryKey;size:100" json:"name"`
+	Schedule  string    `gorm:"size:100" json:"schedule"`
+	Paused    bool      `gorm:"default:false" json:"paused"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (JobSetting) TableName() string {
+	return "scheduler_jobs"
+}
+
+// JobRun is one execution of a job
+type JobRun struct {
+	ID           uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	JobName      string          `gorm:"size:100;not null" json:"job_name"`
+	Trigger      string          `gorm:"size:20;not null" json:"trigger"`
+	Status       string          `gorm:"size:20;not null" json:"status"`
+	Instance     string          `gorm:"size:200" json:"instance"` // Server process that ran the job
+	Result       json.RawMessage `gorm:"type:jsonb" json:"result,omitempty"`
+	ErrorMessage string          `gorm:"type:text" json:"error_message,omitempty"`
+	DurationMs   int64           `gorm:"default:0" json:"duration_ms"`
+	StartedAt    time.Time       `json:"started_at"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+}
+
+func (JobRun) TableName() string {
+	return "scheduler_job_runs"
+}
+
+// JobStatus describes a registered job for the admin API
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Schedule       string     `json:"schedule"`
+	ScheduleSource string     `json:"schedule_source"` // default, config or database
+	Paused         bool       `json:"paused"`
+	Running        bool       `json:"running"` // Running on this server
+	NextRun        *time.Time `json:"next_run,omitempty"`
+	LastRun        *JobRun    `json:"last_run,omitempty"`
+}
@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Repository handles scheduler settings and run history
+type Repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// ListSettings returns the stored job overrides keyed by job name
+func (r *Repository) ListSettings(ctx context.Context) (map[string]JobSetting, error) {
+	var settings []JobSetting
+	if err := r.db.WithContext(ctx).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]JobSetting, len(settings))
+	for _, setting := range settings {
+		byName[setting.Name] = setting
+	}
+	return byName, nil
+}
+
+// GetSetting returns a job's overrides; nil if it has none
+func (r *Repository) GetSetting(ctx context.Context, name string) (*JobSetting, error) {
+	var setting JobSetting
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &setting, nil
+}
+
+// SetSchedule stores a schedule override; an empty schedule removes the override
+func (r *Repository) SetSchedule(ctx context.Context, name, schedule string) error {
+	setting := JobSetting{Name: name, Schedule: schedule}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"schedule", "updated_at"}),
+	}).Create(&setting).Error
+}
+
+// SetPaused pauses or resumes a job
+func (r *Repository) SetPaused(ctx context.Context, name string, paused bool) error {
+	setting := JobSetting{Name: name, Paused: paused}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"paused", "updated_at"}),
+	}).Create(&setting).Error
+}
+
+// CreateRun records the start of a job run
+func (r *Repository) CreateRun(ctx context.Context, run *JobRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+// FinishRun records the outcome of a job run
+func (r *Repository) FinishRun(ctx context.Context, run *JobRun) error {
+	return r.db.WithContext(ctx).Model(&JobRun{}).
+		Where("id = ?", run.ID).
+		Updates(map[string]interface{}{
+			"status":        run.Status,
+			"result":        run.Result,
+			"error_message": run.ErrorMessage,
+			"duration_ms":   run.DurationMs,
+			"finished_at":   run.FinishedAt,
+		}).Error
+}
+
+// ListRuns returns a job's runs, newest first
+func (r *Repository) ListRuns(ctx context.Context, name string, page, pageSize int) ([]JobRun, int64, error) {
+	var runs []JobRun
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&JobRun{}).Where("job_name = ?", name)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("started_at DESC").Offset(offset).Limit(pageSize).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// LastRuns returns the most recent run of every job that has run, keyed by job name
+func (r *Repository) LastRuns(ctx context.Context) (map[string]JobRun, error) {
+	var runs []JobRun
+	err := r.db.WithContext(ctx).
+		Raw(`SELECT DISTINCT ON (job_name) * FROM scheduler_job_runs ORDER BY job_name, started_at DESC`).
+		Scan(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]JobRun, len(runs))
+	for _, run := range runs {
+		byName[run.JobName] = run
+	}
+	return byName, nil
+}
+
+// DeleteRunsBefore removes finished runs started before the cutoff
+func (r *Repository) DeleteRunsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("started_at < ? AND status <> ?", cutoff, RunRunning).
+		Delete(&JobRun{})
+	return result.RowsAffected, result.Error
+}
@@ -2,66 +2,632 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"dingtalk-dashboard/internal/domain/approval"
+	"dingtalk-dashboard/internal/lease"
 
+	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 )
 
-// Scheduler handles scheduled sync jobs
+const (
+	// reloadSchedule is how often schedule overrides are re-read, so changes made through
+	// another replica take effect here too
+	reloadSchedule = "@every 1m"
+
+	// leaderLeaseName is the lease held by the replica that runs scheduled jobs
+	leaderLeaseName = "scheduler-leader"
+	// leaderLeaseTTL is how long a dead leader blocks failover; it is renewed every third of it
+	leaderLeaseTTL = 30 * time.Second
+	// leaderRetryInterval is how often followers try to take over the leader lease
+	leaderRetryInterval = 10 * time.Second
+
+	// jobLeaseTTL is how long a crashed replica blocks a job it was running; it is renewed every third of it
+	jobLeaseTTL = 30 * time.Second
+)
+
+var (
+	// ErrUnknownJob is returned for a job name that isn't registered
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned when a job is started while it is still running on any replica
+	ErrJobRunning = errors.New("job is already running")
+	// ErrInvalidSchedule is returned for a schedule that isn't a valid cron spec
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	// ErrSkipped is returned (wrapped with the reason) by jobs that had nothing to do
+	ErrSkipped = errors.New("skipped")
+
+	// errLeadershipLost cancels scheduled runs when the leader lease is lost
+	errLeadershipLost = errors.New("scheduler leadership lost")
+	// errJobLeaseLost cancels a run when its job lease is lost
+	errJobLeaseLost = errors.New("job lease lost")
+)
+
+// jobLeaseName is the lease held while a job runs, so it runs on one replica at a time
+func jobLeaseName(name string) string {
+	return "scheduler-job:" + name
+}
+
+// Job is a named task run on a cron schedule
+type Job struct {
+	Name        string
+	Description string
+	// Schedule is the default cron spec; JOB_SCHEDULES and the database override it
+	Schedule string
+	Timeout  time.Duration
+	// RunOnStart also runs the job once when this replica becomes the leader
+	RunOnStart bool
+	// Run does the work. Its result is stored as JSON with the run.
+	Run func(ctx context.Context) (interface{}, error)
+}
+
+// scheduledEntry is a job's current cron entry
+type scheduledEntry struct {
+	id   cron.EntryID
+	spec string
+}
+
+// Scheduler runs the registered jobs and keeps their run history
 type Scheduler struct {
-	cron        *cron.Cron
-	service     *approval.Service
-	processCode string
-	logger      *zap.Logger
+	cron      *cron.Cron
+	repo      *Repository
+	schedules map[string]string // Schedules from config, by job name
+	logger    *zap.Logger
+
+	mu      sync.Mutex
+	jobs    []*Job
+	byName  map[string]*Job
+	entries map[string]scheduledEntry
+	running map[string]bool
+
+	// Leader election; without leases every replica runs scheduled jobs
+	leases       *lease.Manager
+	leader       atomic.Bool
+	leading      context.Context // Cancelled when leadership ends; nil while not leading
+	stopCampaign context.CancelFunc
+	campaignDone chan struct{}
+
+	// Manual approval syncs
+	service  *approval.Service
+	syncJobs *approval.JobManager
 }
 
-// NewScheduler creates a new scheduler
-func NewScheduler(service *approval.Service, processCode string, loc *time.Location, logger *zap.Logger) *Scheduler {
+// NewScheduler creates a new scheduler. schedules overrides the default schedule of jobs by name.
+func NewScheduler(repo *Repository, service *approval.Service, schedules map[string]string, loc *time.Location, logger *zap.Logger) *Scheduler {
 	return &Scheduler{
-		cron:        cron.New(cron.WithLocation(loc)),
-		service:     service,
-		processCode: processCode,
-		logger:      logger,
+		cron:      cron.New(cron.WithLocation(loc)),
+		repo:      repo,
+		schedules: schedules,
+		logger:    logger,
+		byName:    make(map[string]*Job),
+		entries:   make(map[string]scheduledEntry),
+		running:   make(map[string]bool),
+		service:   service,
+		syncJobs:  approval.NewJobManager(service),
 	}
 }
 
-// Start starts the scheduler
+// SetLeases enables leader election: of all replicas, only the one holding the scheduler
+// lease runs scheduled jobs. Must be called before Start.
+func (s *Scheduler) SetLeases(leases *lease.Manager) {
+	s.leases = leases
+}
+
+// Register adds a job. Jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	if _, err := cron.ParseStandard(job.Schedule); err != nil {
+		return fmt.Errorf("job %s: invalid schedule %q: %w", job.Name, job.Schedule, err)
+	}
+	if spec, ok := s.schedules[job.Name]; ok {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return fmt.Errorf("job %s: invalid configured schedule %q: %w", job.Name, spec, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byName[job.Name]; ok {
+		return fmt.Errorf("job %s registered twice", job.Name)
+	}
+	s.jobs = append(s.jobs, &job)
+	s.byName[job.Name] = &job
+	return nil
+}
+
+// Start schedules the registered jobs and starts the scheduler
 func (s *Scheduler) Start() error {
-	// Schedule at 8AM, 11AM, 1PM, 4PM, 6PM daily (UTC+7)
-	_, err := s.cron.AddFunc("0 8,11,13,16,18 * * *", s.runSync)
-	if err != nil {
+	for name := range s.schedules {
+		if _, ok := s.byName[name]; !ok {
+			s.logger.Warn("Schedule configured for unknown job", zap.String("job", name))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	s.reload(ctx)
+
+	if _, err := s.cron.AddFunc(reloadSchedule, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		s.reload(ctx)
+	}); err != nil {
 		return err
 	}
 
 	s.cron.Start()
-	s.logger.Info("Scheduler started",
-		zap.String("schedule", "8:00, 11:00, 13:00, 16:00, 18:00 daily"))
+
+	if s.leases == nil {
+		s.setLeading(context.Background())
+		s.runStartupJobs()
+	} else {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopCampaign = cancel
+		s.campaignDone = make(chan struct{})
+		go s.campaign(ctx)
+	}
+
+	fields := make([]zap.Field, 0, len(s.entries))
+	s.mu.Lock()
+	for name, entry := range s.entries {
+		fields = append(fields, zap.String(name, entry.spec))
+	}
+	s.mu.Unlock()
+	s.logger.Info("Scheduler started", fields...)
 
 	return nil
 }
 
-// Stop stops the scheduler
+// Stop stops the scheduler and hands leadership to another replica
 func (s *Scheduler) Stop() {
+	if s.stopCampaign != nil {
+		s.stopCampaign()
+		<-s.campaignDone
+	}
 	s.cron.Stop()
 	s.logger.Info("Scheduler stopped")
 }
 
-// RunManualSync runs a manual sync
-func (s *Scheduler) RunManualSync(ctx context.Context) (*approval.SyncLog, error) {
-	s.logger.Info("Running manual sync")
-	return s.service.SyncApprovals(ctx, s.processCode, "manual")
+// IsLeader reports whether this replica runs scheduled jobs
+func (s *Scheduler) IsLeader() bool {
+	return s.leader.Load()
 }
 
-// runSync is the scheduled sync job
-func (s *Scheduler) runSync() {
-	s.logger.Info("Running scheduled sync")
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-	defer cancel()
+// setLeading records the context scheduled runs derive from; nil when leadership ends
+func (s *Scheduler) setLeading(ctx context.Context) {
+	s.mu.Lock()
+	s.leading = ctx
+	s.mu.Unlock()
+	s.leader.Store(ctx != nil)
+}
 
-	if _, err := s.service.SyncApprovals(ctx, s.processCode, "scheduled"); err != nil {
-		s.logger.Error("Scheduled sync failed", zap.Error(err))
+// leadership returns the context scheduled runs derive from, or nil if this replica isn't the leader
+func (s *Scheduler) leadership() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leading == nil || s.leading.Err() != nil {
+		return nil
 	}
+	return s.leading
+}
+
+// Leader returns the instance ID of the replica running scheduled jobs; empty if there is none
+// right now (e.g. during failover)
+func (s *Scheduler) Leader(ctx context.Context) (string, error) {
+	if s.leases == nil {
+		return lease.InstanceID(), nil
+	}
+	current, err := s.leases.Get(ctx, leaderLeaseName)
+	if err != nil || current == nil {
+		return "", err
+	}
+	return current.Holder, nil
+}
+
+// campaign tries to become the leader until ctx is done, leading whenever it holds the lease
+func (s *Scheduler) campaign(ctx context.Context) {
+	defer close(s.campaignDone)
+
+	holder := lease.InstanceID()
+	for {
+		acquired, err := s.leases.TryAcquire(ctx, leaderLeaseName, holder, holder, leaderLeaseTTL)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Warn("Failed to acquire scheduler leader lease", zap.Error(err))
+		}
+		if acquired {
+			s.lead(ctx, holder)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(leaderRetryInterval):
+		}
+	}
+}
+
+// lead runs scheduled jobs while the leader lease is kept. Returns when it is lost or ctx is done;
+// scheduled runs still in flight are cancelled either way.
+func (s *Scheduler) lead(ctx context.Context, holder string) {
+	leadCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(errLeadershipLost)
+
+	s.setLeading(leadCtx)
+	s.logger.Info("Became scheduler leader", zap.String("instance", holder))
+	s.runStartupJobs()
+
+	s.leases.Keep(ctx, leaderLeaseName, holder, leaderLeaseTTL, func() {
+		s.logger.Warn("Lost scheduler leader lease, cancelling scheduled runs", zap.String("instance", holder))
+		cancel(errLeadershipLost)
+	})
+
+	s.setLeading(nil)
+	s.logger.Info("No longer scheduler leader", zap.String("instance", holder))
+}
+
+// runStartupJobs starts the jobs that run when a replica takes over scheduling
+func (s *Scheduler) runStartupJobs() {
+	for _, job := range s.jobs {
+		if job.RunOnStart {
+			go s.execute(job, TriggerStartup)
+		}
+	}
+}
+
+// reload applies the current schedule of every job, replacing cron entries whose schedule changed.
+// If the overrides can't be read, the current entries are kept.
+func (s *Scheduler) reload(ctx context.Context) {
+	settings, err := s.repo.ListSettings(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Error("Failed to load job settings", zap.Error(err))
+		if len(s.entries) > 0 {
+			return
+		}
+		// First load: fall back to config and defaults
+	}
+
+	for _, job := range s.jobs {
+		spec, _ := s.effectiveSchedule(job, settings)
+		entry, ok := s.entries[job.Name]
+		if ok && entry.spec == spec {
+			continue
+		}
+		if ok {
+			s.cron.Remove(entry.id)
+		}
+
+		job := job
+		id, err := s.cron.AddFunc(spec, func() { s.execute(job, TriggerScheduled) })
+		if err != nil {
+			// Only reachable for database overrides, which are validated when set
+			s.logger.Error("Failed to schedule job", zap.String("job", job.Name), zap.String("schedule", spec), zap.Error(err))
+			delete(s.entries, job.Name)
+			continue
+		}
+		s.entries[job.Name] = scheduledEntry{id: id, spec: spec}
+		if ok {
+			s.logger.Info("Job rescheduled", zap.String("job", job.Name), zap.String("schedule", spec))
+		}
+	}
+}
+
+// effectiveSchedule picks a job's schedule: the database override, then config, then the default
+func (s *Scheduler) effectiveSchedule(job *Job, settings map[string]JobSetting) (string, string) {
+	if setting, ok := settings[job.Name]; ok && setting.Schedule != "" {
+		if _, err := cron.ParseStandard(setting.Schedule); err == nil {
+			return setting.Schedule, SourceDatabase
+		}
+	}
+	if spec, ok := s.schedules[job.Name]; ok && spec != "" {
+		return spec, SourceConfig
+	}
+	return job.Schedule, SourceDefault
+}
+
+// execute runs a job for its schedule (or startup) if this replica is the leader, unless the
+// job is paused or still running. The run is cancelled if leadership is lost.
+func (s *Scheduler) execute(job *Job, trigger string) {
+	leadCtx := s.leadership()
+	if leadCtx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	setting, err := s.repo.GetSetting(ctx, job.Name)
+	cancel()
+	if err != nil {
+		s.logger.Warn("Failed to read job setting, running anyway", zap.String("job", job.Name), zap.Error(err))
+	}
+	if setting != nil && setting.Paused {
+		s.logger.Info("Skipping paused job", zap.String("job", job.Name))
+		return
+	}
+
+	run, err := s.begin(leadCtx, job, trigger)
+	if errors.Is(err, ErrJobRunning) {
+		s.logger.Info("Skipping job, previous run still in progress", zap.String("job", job.Name))
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to start job", zap.String("job", job.Name), zap.Error(err))
+		return
+	}
+	s.complete(leadCtx, job, run)
+}
+
+// begin marks a job as running, on every replica if leases are enabled, and records the start
+// of its run
+func (s *Scheduler) begin(ctx context.Context, job *Job, trigger string) (*JobRun, error) {
+	s.mu.Lock()
+	if s.running[job.Name] {
+		s.mu.Unlock()
+		return nil, ErrJobRunning
+	}
+	s.running[job.Name] = true
+	s.mu.Unlock()
+
+	runID := uuid.New()
+	if s.leases != nil {
+		acquired, err := s.leases.TryAcquire(ctx, jobLeaseName(job.Name), lease.InstanceID(), runID.String(), jobLeaseTTL)
+		if err != nil || !acquired {
+			s.mu.Lock()
+			delete(s.running, job.Name)
+			s.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return nil, ErrJobRunning
+		}
+	}
+
+	run := &JobRun{
+		ID:        runID,
+		JobName:   job.Name,
+		Trigger:   trigger,
+		Status:    RunRunning,
+		Instance:  lease.InstanceID(),
+		StartedAt: time.Now(),
+	}
+	if err := s.repo.CreateRun(context.Background(), run); err != nil {
+		s.logger.Error("Failed to record job run", zap.String("job", job.Name), zap.Error(err))
+	}
+	return run, nil
+}
+
+// complete runs the job under parent, keeping its job lease until it finishes, then records its
+// outcome. The run is cancelled if the job lease is lost.
+func (s *Scheduler) complete(parent context.Context, job *Job, run *JobRun) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.Name)
+		s.mu.Unlock()
+	}()
+
+	s.logger.Info("Running job", zap.String("job", job.Name), zap.String("trigger", run.Trigger))
+
+	runCtx, cancelRun := context.WithCancelCause(parent)
+	defer cancelRun(nil)
+	if s.leases != nil {
+		keepCtx, stopKeep := context.WithCancel(context.Background())
+		kept := make(chan struct{})
+		go func() {
+			defer close(kept)
+			s.leases.Keep(keepCtx, jobLeaseName(job.Name), lease.InstanceID(), jobLeaseTTL, func() {
+				s.logger.Error("Lost job lease, cancelling run", zap.String("job", job.Name))
+				cancelRun(errJobLeaseLost)
+			})
+		}()
+		// Released once the run is recorded
+		defer func() {
+			stopKeep()
+			<-kept
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(runCtx, job.Timeout)
+	result, err := s.safeRun(ctx, job)
+	if cause := context.Cause(runCtx); err != nil && cause != nil && !errors.Is(err, cause) {
+		err = fmt.Errorf("%w: %v", cause, err)
+	}
+	cancel()
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.DurationMs = finished.Sub(run.StartedAt).Milliseconds()
+	if result != nil {
+		if data, marshalErr := json.Marshal(result); marshalErr == nil {
+			run.Result = data
+		}
+	}
+
+	switch {
+	case err == nil:
+		run.Status = RunSucceeded
+		s.logger.Info("Job finished", zap.String("job", job.Name), zap.Int64("duration_ms", run.DurationMs))
+	case errors.Is(err, ErrSkipped):
+		run.Status = RunSkipped
+		run.ErrorMessage = err.Error()
+		s.logger.Info("Job skipped", zap.String("job", job.Name), zap.String("reason", err.Error()))
+	default:
+		run.Status = RunFailed
+		run.ErrorMessage = err.Error()
+		s.logger.Error("Job failed", zap.String("job", job.Name), zap.Error(err))
+	}
+
+	if err := s.repo.FinishRun(context.Background(), run); err != nil {
+		s.logger.Error("Failed to record job result", zap.String("job", job.Name), zap.Error(err))
+	}
+}
+
+// safeRun runs a job, turning a panic into an error so one broken job can't stop the scheduler
+func (s *Scheduler) safeRun(ctx context.Context, job *Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// job looks up a registered job
+func (s *Scheduler) job(name string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.byName[name]
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	return job, nil
+}
+
+// Jobs lists the registered jobs with their schedule, state and last run
+func (s *Scheduler) Jobs(ctx context.Context) ([]JobStatus, error) {
+	settings, err := s.repo.ListSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastRuns, err := s.repo.LastRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		statuses = append(statuses, s.statusLocked(job, settings, lastRuns))
+	}
+	return statuses, nil
+}
+
+// Job returns the status of one job
+func (s *Scheduler) Job(ctx context.Context, name string) (*JobStatus, error) {
+	job, err := s.job(name)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.repo.ListSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastRuns, err := s.repo.LastRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.statusLocked(job, settings, lastRuns)
+	return &status, nil
+}
+
+// statusLocked builds a job's status; s.mu must be held
+func (s *Scheduler) statusLocked(job *Job, settings map[string]JobSetting, lastRuns map[string]JobRun) JobStatus {
+	spec, source := s.effectiveSchedule(job, settings)
+	status := JobStatus{
+		Name:           job.Name,
+		Description:    job.Description,
+		Schedule:       spec,
+		ScheduleSource: source,
+		Paused:         settings[job.Name].Paused,
+		Running:        s.running[job.Name],
+	}
+	if entry, ok := s.entries[job.Name]; ok {
+		if next := s.cron.Entry(entry.id).Next; !next.IsZero() {
+			status.NextRun = &next
+		}
+	}
+	if run, ok := lastRuns[job.Name]; ok {
+		status.LastRun = &run
+	}
+	return status
+}
+
+// Runs returns a job's run history, newest first
+func (s *Scheduler) Runs(ctx context.Context, name string, page, pageSize int) ([]JobRun, int64, error) {
+	if _, err := s.job(name); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListRuns(ctx, name, page, pageSize)
+}
+
+// RunNow starts a job in the background on this replica, even if it is paused, and returns its
+// run. The job lease keeps it from overlapping a run on the leader or another replica.
+func (s *Scheduler) RunNow(name string) (*JobRun, error) {
+	job, err := s.job(name)
+	if err != nil {
+		return nil, err
+	}
+	run, err := s.begin(context.Background(), job, TriggerManual)
+	if err != nil {
+		return nil, err
+	}
+	go s.complete(context.Background(), job, run)
+	return run, nil
+}
+
+// Pause stops a job from running on its schedule, on every replica
+func (s *Scheduler) Pause(ctx context.Context, name string) (*JobStatus, error) {
+	if _, err := s.job(name); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPaused(ctx, name, true); err != nil {
+		return nil, err
+	}
+	return s.Job(ctx, name)
+}
+
+// Resume lets a paused job run on its schedule again
+func (s *Scheduler) Resume(ctx context.Context, name string) (*JobStatus, error) {
+	if _, err := s.job(name); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetPaused(ctx, name, false); err != nil {
+		return nil, err
+	}
+	return s.Job(ctx, name)
+}
+
+// SetSchedule overrides a job's schedule with a cron spec. An empty spec removes the
+// override, restoring the configured or default schedule.
+func (s *Scheduler) SetSchedule(ctx context.Context, name, spec string) (*JobStatus, error) {
+	if _, err := s.job(name); err != nil {
+		return nil, err
+	}
+	if spec != "" {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidSchedule, spec, err)
+		}
+	}
+	if err := s.repo.SetSchedule(ctx, name, spec); err != nil {
+		return nil, err
+	}
+	s.reload(ctx)
+	return s.Job(ctx, name)
+}
+
+// StartManualSync starts a manual sync of a process code in the background and returns its job.
+// If a sync of it is already running, its log (and job, if it runs here) is returned with
+// approval.ErrSyncInProgress.
+func (s *Scheduler) StartManualSync(processCode string, opts approval.SyncOptions) (*approval.SyncJob, *approval.SyncLog, error) {
+	s.logger.Info("Starting manual sync",
+		zap.String("process_code", processCode),
+		zap.Bool("force", opts.Force),
+		zap.Bool("running_only", opts.RunningOnly))
+	return s.syncJobs.Start(processCode, "manual", opts)
+}
+
+// SyncJob returns a background sync job running on this server
+func (s *Scheduler) SyncJob(id uuid.UUID) (*approval.SyncJob, bool) {
+	return s.syncJobs.Get(id)
 }
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a key does not exist in the store
+var ErrNotFound = errors.New("object not found")
+
+// Store is a blob store for downloaded attachments. Objects are immutable once written.
+type Store interface {
+	// Put stores size bytes from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the object stored under key, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists reports whether key is stored
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// ContentKey returns the content-addressed key of an object from its SHA-256 hex digest
+func ContentKey(sha256Hex string) string {
+	return "sha256/" + sha256Hex[:2] + "/" + sha256Hex[2:4] + "/" + sha256Hex
+}
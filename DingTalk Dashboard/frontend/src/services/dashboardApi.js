@@ -44,6 +44,37 @@ export const dashboardService = {
         return response.data;
     },
 
+    // Get the DingTalk form schema new NCRs are validated against
+    getFormSchema: async (source = '') => {
+        const response = await dashboardApi.get('/approvals/form-schema', { params: source ? { source } : {} });
+        return response.data;
+    },
+
+    // Create an NCR in DingTalk from fields keyed by column (e.g. kategori, nama_project)
+    createApproval: async (fields, source = '') => {
+        const response = await dashboardApi.post('/approvals', fields, { params: source ? { source } : {} });
+        return response.data;
+    },
+
+    // Post a comment to the approval in DingTalk, optionally with a file
+    addComment: async (id, text, file = null) => {
+        const form = new FormData();
+        form.append('text', text);
+        if (file) {
+            form.append('file', file);
+        }
+        const response = await dashboardApi.post(`/approvals/${id}/comments`, form, {
+            headers: { 'Content-Type': 'multipart/form-data' },
+        });
+        return response.data;
+    },
+
+    // Re-fetch an approval from DingTalk; the result lists the fields that changed
+    refreshApproval: async (id) => {
+        const response = await dashboardApi.post(`/approvals/${id}/refresh`);
+        return response.data;
+    },
+
     // Get dashboard statistics
     getStats: async (filters = {}) => {
         const response = await dashboardApi.get('/approvals/stats', { params: filters });
@@ -51,8 +82,8 @@ export const dashboardService = {
     },
 
     // Get filter options (distinct values for dropdowns)
-    getFilterOptions: async () => {
-        const response = await dashboardApi.get('/approvals/filter-options');
+    getFilterOptions: async (source = '') => {
+        const response = await dashboardApi.get('/approvals/filter-options', { params: source ? { source } : {} });
         return response.data;
     },
 
@@ -84,8 +115,70 @@ export const dashboardService = {
     },
 
     // Trigger manual sync
-    triggerSync: async () => {
-        const response = await dashboardApi.post('/sync/trigger');
+    // Start a sync and wait for it to finish. onProgress receives progress snapshots.
+    triggerSync: async (onProgress, source = '') => {
+        const response = await dashboardApi.post('/sync/trigger', null, { params: source ? { source } : {} });
+        const jobId = response.data?.data?.job_id;
+        if (!jobId) {
+            return response.data;
+        }
+        return dashboardService.watchSyncJob(jobId, onProgress);
+    },
+
+    // Follow a sync job's event stream until its "done" event
+    watchSyncJob: async (jobId, onProgress) => {
+        const token = localStorage.getItem('access_token');
+        const response = await fetch(`/api/v1/sync/jobs/${jobId}/events`, {
+            headers: token ? { Authorization: `Bearer ${token}` } : {},
+        });
+        if (!response.ok) {
+            throw new Error(`Failed to follow sync job: ${response.status}`);
+        }
+
+        const reader = response.body.getReader();
+        const decoder = new TextDecoder();
+        let buffer = '';
+
+        for (;;) {
+            const { value, done } = await reader.read();
+            if (done) {
+                return null;
+            }
+            buffer += decoder.decode(value, { stream: true });
+
+            let boundary;
+            while ((boundary = buffer.indexOf('\n\n')) !== -1) {
+                const chunk = buffer.slice(0, boundary);
+                buffer = buffer.slice(boundary + 2);
+
+                let event = 'message';
+                let data = '';
+                for (const line of chunk.split('\n')) {
+                    if (line.startsWith('event: ')) event = line.slice(7);
+                    else if (line.startsWith('data: ')) data += line.slice(6);
+                }
+                if (!data) continue;
+
+                const payload = JSON.parse(data);
+                if (event === 'progress' && onProgress) {
+                    onProgress(payload);
+                } else if (event === 'done') {
+                    reader.cancel();
+                    return payload;
+                }
+            }
+        }
+    },
+
+    // Re-fetch instances by process instance ID or business ID
+    syncInstances: async (instanceIds, source = '') => {
+        const response = await dashboardApi.post('/sync/instances', { instance_ids: instanceIds, source });
+        return response.data;
+    },
+
+    // Cancel a running sync job
+    cancelSyncJob: async (jobId) => {
+        const response = await dashboardApi.delete(`/sync/jobs/${jobId}`);
         return response.data;
     },
 };